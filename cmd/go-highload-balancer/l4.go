@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/health"
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/config"
+	"github.com/xhaklaaa/go-highload-balancer/internal/l4"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxy"
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxyproto"
+)
+
+// buildTCPProxy создает TCP-листенер с балансировщиком и проверками
+// бэкендов установкой соединения
+func buildTCPProxy(
+	ctx context.Context,
+	cfg *config.Config,
+	lc config.TCPListenerConfig,
+	history *health.History,
+	log logger.Logger,
+) (*l4.TCPProxy, error) {
+	lb, err := newBalancer(cfg, interfaces.AlgorithmType(lc.Algorithm), lc.Backends, history, log)
+	if err != nil {
+		return nil, err
+	}
+	if configurer, ok := lb.(interfaces.HealthProbeConfigurer); ok {
+		configurer.SetHealthProbe("", lc.HealthCheck.Timeout)
+	}
+	if healthChecker, ok := lb.(interfaces.HealthChecker); ok {
+		go healthChecker.StartHealthChecks(ctx, lc.HealthCheck.Interval)
+	}
+
+	tcpCfg := l4.TCPConfig{
+		Name:               lc.Name,
+		Addr:               lc.Listen,
+		ConnectTimeout:     lc.ConnectTimeout,
+		IdleTimeout:        lc.IdleTimeout,
+		ProxyHeaderTimeout: cfg.ProxyProtocol.HeaderTimeout,
+	}
+	if lc.ProxyProtocol.Accept {
+		if tcpCfg.ProxyProtocolTrusted, err = proxy.ParseCIDRs(cfg.ProxyProtocol.TrustedCIDRs); err != nil {
+			return nil, err
+		}
+	}
+	if tcpCfg.SendProxyProtocol, err = proxyproto.ParseVersion(lc.ProxyProtocol.Send); err != nil {
+		return nil, err
+	}
+	return l4.NewTCPProxy(tcpCfg, lb, log), nil
+}
+
+// buildUDPProxy создает UDP-листенер с балансировщиком и проверками
+// бэкендов пробной датаграммой. Алгоритм hash закрепляет клиентов по IP.
+func buildUDPProxy(
+	ctx context.Context,
+	cfg *config.Config,
+	lc config.UDPListenerConfig,
+	history *health.History,
+	log logger.Logger,
+) (*l4.UDPProxy, error) {
+	algorithm := interfaces.AlgorithmType(lc.Algorithm)
+	hash := lc.Algorithm == "hash"
+	if hash {
+		algorithm = interfaces.RoundRobin
+	}
+	lb, err := newBalancer(cfg, algorithm, lc.Backends, history, log)
+	if err != nil {
+		return nil, err
+	}
+	if configurer, ok := lb.(interfaces.HealthProbeConfigurer); ok {
+		configurer.SetHealthProbe("", lc.HealthCheck.Timeout)
+	}
+	if healthChecker, ok := lb.(interfaces.HealthChecker); ok {
+		go healthChecker.StartHealthChecks(ctx, lc.HealthCheck.Interval)
+	}
+
+	return l4.NewUDPProxy(l4.UDPConfig{
+		Name:           lc.Name,
+		Addr:           lc.Listen,
+		SessionTimeout: lc.SessionTimeout,
+		MaxSessions:    lc.MaxSessions,
+		Hash:           hash,
+	}, lb, log), nil
+}
@@ -4,18 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"os/signal"
+	"syscall"
 	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 
-	"github.com/xhaklaaa/go-highload-balancer/internal/balancer"
-	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/api/handler"
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/health"
+	"github.com/xhaklaaa/go-highload-balancer/internal/cache"
 	"github.com/xhaklaaa/go-highload-balancer/internal/config"
+	"github.com/xhaklaaa/go-highload-balancer/internal/l4"
 	"github.com/xhaklaaa/go-highload-balancer/internal/limiter"
 	"github.com/xhaklaaa/go-highload-balancer/internal/limiter/store"
 	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
 	"github.com/xhaklaaa/go-highload-balancer/internal/migrations"
 	"github.com/xhaklaaa/go-highload-balancer/internal/proxy"
+	"github.com/xhaklaaa/go-highload-balancer/internal/routing"
 	"github.com/xhaklaaa/go-highload-balancer/internal/server"
 )
 
@@ -47,33 +52,70 @@ func main() {
 		log.Fatalf("Migrations failed: %v", err)
 	}
 
-	// Инициализация балансировщика
-	factory := balancer.NewStrategyFactory(log)
-	lb, err := factory.New(
-		interfaces.AlgorithmType(cfg.Balancing.Algorithm),
-		cfg.Backends,
-	)
+	// История переходов состояния бэкендов
+	healthHistory := health.NewHistory(cfg.HealthCheck.HistorySize)
+	if cfg.HealthCheck.Persist {
+		sink := health.NewPostgresSink(db, log)
+		defer sink.Close()
+		healthHistory.AddSink(sink)
+	}
+
+	// Сигнал остановки завершает и фоновые проверки бэкендов
+	stopCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Инициализация пулов бэкендов и таблицы маршрутизации
+	proxyCfg, err := proxyConfig(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create balancer: %v", err)
+		log.Fatalf("Invalid proxy config: %v", err)
 	}
 
-	if healthChecker, ok := lb.(interfaces.HealthChecker); ok {
-		ctx := context.Background()
-		go healthChecker.StartHealthChecks(ctx, 30*time.Second)
-	} else {
-		log.Warnf("Balancer does not support health checks")
+	pools := make([]*routing.Pool, 0, len(cfg.Pools))
+	for _, poolCfg := range cfg.Pools {
+		pool, err := buildPool(stopCtx, cfg, poolCfg, proxyCfg, healthHistory, log)
+		if err != nil {
+			log.Fatalf("Failed to create pool %s: %v", poolCfg.Name, err)
+		}
+		pools = append(pools, pool)
+	}
+
+	routes, err := routing.NewTable(buildRoutes(cfg), pools)
+	if err != nil {
+		log.Fatalf("Invalid routing table: %v", err)
+	}
+
+	// TCP- и UDP-листенеры работают рядом с HTTP-сервером
+	tcpProxies := make([]*l4.TCPProxy, 0, len(cfg.TCP.Listeners))
+	for _, lc := range cfg.TCP.Listeners {
+		tcpProxy, err := buildTCPProxy(stopCtx, cfg, lc, healthHistory, log)
+		if err != nil {
+			log.Fatalf("Failed to create TCP listener %s: %v", lc.Name, err)
+		}
+		if err := tcpProxy.Start(); err != nil {
+			log.Fatalf("Failed to start TCP listener %s: %v", lc.Name, err)
+		}
+		tcpProxies = append(tcpProxies, tcpProxy)
+	}
+	udpProxies := make([]*l4.UDPProxy, 0, len(cfg.UDP.Listeners))
+	for _, lc := range cfg.UDP.Listeners {
+		udpProxy, err := buildUDPProxy(stopCtx, cfg, lc, healthHistory, log)
+		if err != nil {
+			log.Fatalf("Failed to create UDP listener %s: %v", lc.Name, err)
+		}
+		if err := udpProxy.Start(); err != nil {
+			log.Fatalf("Failed to start UDP listener %s: %v", lc.Name, err)
+		}
+		udpProxies = append(udpProxies, udpProxy)
 	}
 
-	// Инициализация прокси
-	proxyHandler := proxy.NewHandler(lb, log)
 	// Инициализация rate limiter
 	var rateStore limiter.ConfigStore
-	defaultRateConfig := limiter.RateConfig{
-		Capacity:   cfg.RateLimiting.Default.Capacity,
-		RefillRate: cfg.RateLimiting.Default.Rate,
-	}
+	defaultRateConfig := defaultRateConfig(cfg)
 
 	if cfg.RateLimiting.Enabled {
+		if err := defaultRateConfig.Validate(); err != nil {
+			log.Fatalf("Invalid rate_limiting.default: %v", err)
+		}
 		if cfg.RateLimiting.Type == "postgres" {
 			pgStore, err := store.NewPostgresStore(store.PostgresConfig{
 				Host:     cfg.RateLimiting.Postgres.Host,
@@ -92,19 +134,136 @@ func main() {
 		}
 	}
 
-	rateLimiter := limiter.NewTokenBucket(rateStore, defaultRateConfig)
+	// В распределенном режиме корзины клиентов общие для всех экземпляров
+	var sharedStore limiter.SharedStore
+	if cfg.RateLimiting.Enabled && cfg.RateLimiting.Distributed.Enabled {
+		sharedStore, err = buildSharedStore(cfg, log)
+		if err != nil {
+			log.Fatalf("Failed to init shared rate limit store: %v", err)
+		}
+		defer sharedStore.Close()
+	}
+	newLimiter := rateLimiters(cfg, sharedStore, rateStore, log)
+	rateLimiter := newLimiter("", defaultRateConfig)
 
 	srv := server.NewServer(
-		lb,
-		proxyHandler,
+		routes,
 		cfg.Port,
 		log,
 		rateLimiter,
 		rateStore,
 		cfg.RateLimiting.Enabled,
 	)
+	srv.RegisterAdminRoutes(handler.NewHealthHandler(healthHistory, log))
+	srv.RegisterAdminRoutes(handler.NewProxyHandler(routes, log))
+	srv.RegisterAdminRoutes(handler.NewRoutingHandler(routes, log))
+	srv.RegisterAdminRoutes(handler.NewL4Handler(tcpProxies, udpProxies, log))
+
+	// Лимиты снаружи остальных обработчиков: отклоненный запрос не доходит
+	// ни до кэша, ни до бэкенда
+	var ratePolicies *limiter.RoutePolicies
+	if cfg.RateLimiting.Enabled {
+		ratePolicies, err = buildRatePolicies(cfg, routes, newLimiter, rateLimiter)
+		if err != nil {
+			log.Fatalf("Invalid rate limiting config: %v", err)
+		}
+		srv.UseProxyMiddleware(ratePolicies.Middleware)
+	}
+
+	// Сжатие снаружи кэша: в кэше хранятся несжатые ответы
+	if cfg.Compression.Enabled {
+		compressor, err := proxy.NewCompressor(proxy.CompressionConfig{
+			Encodings:    cfg.Compression.Encodings,
+			ContentTypes: cfg.Compression.ContentTypes,
+			MinSize:      cfg.Compression.MinSize,
+		})
+		if err != nil {
+			log.Fatalf("Invalid compression config: %v", err)
+		}
+		srv.UseProxyMiddleware(compressor.Middleware)
+	}
+
+	// Кэш стоит перед объединением запросов: к бэкенду уходят только промахи
+	var responseCache *cache.Cache
+	if cfg.Cache.Enabled {
+		responseCache, err = cache.New(cache.Config{
+			MaxBytes:          cfg.Cache.MaxBytes,
+			MaxEntryBytes:     cfg.Cache.MaxEntryBytes,
+			Key:               cfg.Cache.Key,
+			RevalidateTimeout: cfg.Cache.RevalidateTimeout,
+		}, log)
+		if err != nil {
+			log.Fatalf("Invalid cache config: %v", err)
+		}
+		srv.UseProxyMiddleware(responseCache.Middleware)
+	}
+
+	var coalescer *cache.Coalescer
+	if cfg.Coalescing.Enabled {
+		coalescer, err = cache.NewCoalescer(cache.CoalesceConfig{
+			Key:          cfg.Coalescing.Key,
+			WaitTimeout:  cfg.Coalescing.WaitTimeout,
+			MaxBodyBytes: cfg.Coalescing.MaxBodyBytes,
+		})
+		if err != nil {
+			log.Fatalf("Invalid coalescing config: %v", err)
+		}
+		srv.UseProxyMiddleware(coalescer.Middleware)
+	}
 
-	if err := srv.Start(); err != nil {
+	if responseCache != nil || coalescer != nil {
+		srv.RegisterAdminRoutes(handler.NewCacheHandler(responseCache, coalescer, log))
+	}
+
+	if cfg.H2C {
+		srv.EnableH2C()
+	}
+
+	if cfg.ProxyProtocol.Enabled {
+		trusted, err := proxy.ParseCIDRs(cfg.ProxyProtocol.TrustedCIDRs)
+		if err != nil {
+			log.Fatalf("Invalid proxy_protocol.trusted_cidrs: %v", err)
+		}
+		srv.EnableProxyProtocol(trusted, cfg.ProxyProtocol.HeaderTimeout)
+	}
+
+	if cfg.TLS.Enabled {
+		tlsConfig, err := buildTLSConfig(cfg, log)
+		if err != nil {
+			log.Fatalf("Invalid TLS config: %v", err)
+		}
+		srv.EnableTLS(tlsConfig, cfg.TLS.Port, cfg.TLS.RedirectHTTP)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Start() }()
+	select {
+	case err := <-errCh:
 		log.Fatalf("Server error: %v", err)
+	case <-stopCtx.Done():
+	}
+
+	// Лимитеры останавливаются после текущих запросов и до закрытия общего
+	// хранилища: накопленный учет SyncedLimiter успевает в него попасть
+	log.Infof("Shutting down")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if err := srv.Stop(shutdownCtx); err != nil {
+		log.Errorf("Server shutdown error: %v", err)
+	}
+	for _, tcpProxy := range tcpProxies {
+		if err := tcpProxy.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("TCP listener shutdown error: %v", err)
+		}
+	}
+	for _, udpProxy := range udpProxies {
+		if err := udpProxy.Close(); err != nil {
+			log.Errorf("UDP listener shutdown error: %v", err)
+		}
+	}
+	if ratePolicies != nil {
+		if err := ratePolicies.Stop(); err != nil {
+			log.Errorf("Route rate limiters shutdown error: %v", err)
+		}
 	}
 }
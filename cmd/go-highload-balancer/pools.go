@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer"
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/health"
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/config"
+	"github.com/xhaklaaa/go-highload-balancer/internal/core"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxy"
+	"github.com/xhaklaaa/go-highload-balancer/internal/routing"
+	"github.com/xhaklaaa/go-highload-balancer/internal/tlsutil"
+)
+
+// proxyConfig собирает общие настройки прокси из конфигурации
+func proxyConfig(cfg *config.Config) (proxy.Config, error) {
+	trustedProxies, err := proxy.ParseCIDRs(cfg.Proxy.TrustedProxies)
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	grpcRetryCodes, err := proxy.ParseGRPCCodes(cfg.Proxy.Retry.GRPCStatusCodes)
+	if err != nil {
+		return proxy.Config{}, err
+	}
+
+	return proxy.Config{
+		Timeout:            cfg.Proxy.Timeout,
+		MaxReplayBytes:     cfg.Proxy.MaxReplayBytes,
+		SpoolLargeBodies:   cfg.Proxy.SpoolLargeBodies,
+		SpoolDir:           cfg.Proxy.SpoolDir,
+		MaxSpoolBytes:      cfg.Proxy.MaxSpoolBytes,
+		UpgradeIdleTimeout: cfg.Proxy.UpgradeIdle,
+		TrustedProxies:     trustedProxies,
+		PreserveHost:       cfg.Proxy.PreserveHost,
+		Via:                cfg.Proxy.Via,
+		Retry: proxy.RetryPolicy{
+			MaxAttempts:        cfg.Proxy.Retry.MaxAttempts,
+			RetryOn:            cfg.Proxy.Retry.RetryOn,
+			StatusCodes:        cfg.Proxy.Retry.StatusCodes,
+			GRPCStatusCodes:    grpcRetryCodes,
+			Methods:            cfg.Proxy.Retry.Methods,
+			PerTryTimeout:      cfg.Proxy.Retry.PerTryTimeout,
+			BackoffBase:        cfg.Proxy.Retry.BackoffBase,
+			BackoffMax:         cfg.Proxy.Retry.BackoffMax,
+			BudgetPercent:      cfg.Proxy.Retry.BudgetPercent,
+			BudgetMinPerSecond: cfg.Proxy.Retry.BudgetMinPerSecond,
+		},
+		Queue: proxy.QueueConfig{
+			Size:    cfg.ConnectionLimits.QueueSize,
+			Timeout: cfg.ConnectionLimits.QueueTimeout,
+		},
+	}, nil
+}
+
+// newBalancer создает балансировщик и подключает к нему circuit breaker,
+// лимиты соединений и историю health checks
+func newBalancer(cfg *config.Config, algorithm interfaces.AlgorithmType, backends []string, history *health.History, log logger.Logger) (interfaces.Balancer, error) {
+	factory := balancer.NewStrategyFactory(log)
+	lb, err := factory.New(algorithm, backends)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CircuitBreaker.Enabled {
+		balancer.AttachCircuitBreakers(lb, core.BreakerConfig{
+			Window:                cfg.CircuitBreaker.Window,
+			MinRequests:           cfg.CircuitBreaker.MinRequests,
+			ErrorRateThreshold:    cfg.CircuitBreaker.ErrorRateThreshold,
+			SlowCallDuration:      cfg.CircuitBreaker.SlowCallDuration,
+			SlowCallRateThreshold: cfg.CircuitBreaker.SlowCallRateThreshold,
+			OpenDuration:          cfg.CircuitBreaker.OpenDuration,
+			HalfOpenRequests:      cfg.CircuitBreaker.HalfOpenRequests,
+		})
+	}
+
+	perBackendLimits := make(map[string]int64)
+	for _, b := range cfg.ConnectionLimits.Backends {
+		perBackendLimits[b.URL] = b.MaxConnections
+	}
+	balancer.ApplyConnectionLimits(lb, cfg.ConnectionLimits.DefaultMaxConnections, perBackendLimits)
+
+	if observable, ok := lb.(interfaces.HealthObservable); ok {
+		observable.SetHealthRecorder(history)
+	}
+	return lb, nil
+}
+
+// buildPool создает балансировщик пула с health checks и прокси с таймаутом пула
+func buildPool(
+	ctx context.Context,
+	cfg *config.Config,
+	poolCfg config.PoolConfig,
+	proxyCfg proxy.Config,
+	history *health.History,
+	log logger.Logger,
+) (*routing.Pool, error) {
+	algorithm := interfaces.AlgorithmType(poolCfg.Algorithm)
+	lb, err := newBalancer(cfg, algorithm, poolCfg.Backends, history, log)
+	if err != nil {
+		return nil, err
+	}
+	if configurer, ok := lb.(interfaces.HealthProbeConfigurer); ok {
+		configurer.SetHealthProbe(poolCfg.HealthCheck.Path, poolCfg.HealthCheck.Timeout)
+	}
+
+	proxyCfg.Timeout = poolCfg.Timeout
+	proxyCfg.Upstream = proxy.UpstreamConfig{
+		Protocol:             poolCfg.Protocol,
+		MaxConcurrentStreams: poolCfg.HTTP2.MaxConcurrentStreams,
+		PingInterval:         poolCfg.HTTP2.PingInterval,
+		PingTimeout:          poolCfg.HTTP2.PingTimeout,
+	}
+	if poolCfg.TLS.Enabled() {
+		clientTLS, err := tlsutil.NewClientTLS(tlsutil.ClientConfig{
+			CAFile:             poolCfg.TLS.CAFile,
+			CertFile:           poolCfg.TLS.CertFile,
+			KeyFile:            poolCfg.TLS.KeyFile,
+			ServerName:         poolCfg.TLS.ServerName,
+			InsecureSkipVerify: poolCfg.TLS.InsecureSkipVerify,
+		}, log)
+		if err != nil {
+			return nil, err
+		}
+		if err := clientTLS.Watch(ctx); err != nil {
+			return nil, err
+		}
+		if poolCfg.TLS.InsecureSkipVerify {
+			log.Warnf("Pool %s: backend certificate verification is disabled", poolCfg.Name)
+		}
+		proxyCfg.Upstream.TLSForHost = clientTLS.ConfigFor
+	}
+
+	handler := proxy.NewHandler(lb, log, proxyCfg)
+	// Активные проверки идут через тот же транспорт, что и трафик
+	if configurer, ok := lb.(interfaces.HealthTransportConfigurer); ok {
+		configurer.SetHealthTransport(handler.Transport())
+	}
+
+	if healthChecker, ok := lb.(interfaces.HealthChecker); ok {
+		go healthChecker.StartHealthChecks(ctx, poolCfg.HealthCheck.Interval)
+	} else {
+		log.Warnf("Balancer of pool %s does not support health checks", poolCfg.Name)
+	}
+
+	return &routing.Pool{
+		Name:      poolCfg.Name,
+		Algorithm: algorithm,
+		Balancer:  lb,
+		Handler:   handler,
+	}, nil
+}
+
+func buildRoutes(cfg *config.Config) []routing.Route {
+	routes := make([]routing.Route, 0, len(cfg.Routes))
+	for _, r := range cfg.Routes {
+		route := routing.Route{
+			Name:     r.Name,
+			Priority: r.Priority,
+			Pool:     r.Pool,
+			Match: routing.Match{
+				Host:       r.Match.Host,
+				PathPrefix: r.Match.PathPrefix,
+				PathRegex:  r.Match.PathRegex,
+				Methods:    r.Match.Methods,
+				Headers:    r.Match.Headers,
+			},
+		}
+		if len(r.Split.Variants) > 0 {
+			split := &routing.Split{
+				OverrideHeader: r.Split.OverrideHeader,
+				OverrideCookie: r.Split.OverrideCookie,
+				StickyHeader:   r.Split.Sticky.Header,
+				StickyCookie:   r.Split.Sticky.Cookie,
+			}
+			for _, v := range r.Split.Variants {
+				split.Variants = append(split.Variants, routing.Variant{Pool: v.Pool, Weight: v.Weight})
+			}
+			route.Split = split
+		}
+		if r.Mirror.Pool != "" {
+			route.Mirror = &routing.Mirror{
+				Pool: r.Mirror.Pool,
+				MirrorConfig: proxy.MirrorConfig{
+					SamplePercent: r.Mirror.SamplePercent,
+					Timeout:       r.Mirror.Timeout,
+					MaxBodyBytes:  r.Mirror.MaxBodyBytes,
+					CompareStatus: r.Mirror.CompareStatus,
+					MaxInFlight:   r.Mirror.MaxInFlight,
+				},
+			}
+		}
+		if r.Hedge.Enabled {
+			route.Hedge = &proxy.HedgeConfig{
+				Delay:           r.Hedge.Delay,
+				DelayPercentile: r.Hedge.DelayPercentile,
+				MaxPercent:      r.Hedge.MaxPercent,
+			}
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/config"
+	"github.com/xhaklaaa/go-highload-balancer/internal/limiter"
+	"github.com/xhaklaaa/go-highload-balancer/internal/limiter/store"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxy"
+	"github.com/xhaklaaa/go-highload-balancer/internal/routing"
+)
+
+// defaultRateConfig лимит клиентов без персональных настроек
+func defaultRateConfig(cfg *config.Config) limiter.RateConfig {
+	return limiter.RateConfig{
+		Capacity:   cfg.RateLimiting.Default.Capacity,
+		RefillRate: cfg.RateLimiting.Default.Rate,
+		Algorithm:  limiter.Algorithm(cfg.RateLimiting.Default.Algorithm),
+		Window:     cfg.RateLimiting.Default.Window,
+	}
+}
+
+// buildSharedStore подключает хранилище общего состояния лимитов
+func buildSharedStore(cfg *config.Config, log logger.Logger) (limiter.SharedStore, error) {
+	if cfg.RateLimiting.Distributed.Backend == "redis" {
+		return store.NewRedisStateStore(store.RedisConfig{
+			Addr:     cfg.RateLimiting.Redis.Addr,
+			Password: cfg.RateLimiting.Redis.Password,
+			DB:       cfg.RateLimiting.Redis.DB,
+			PoolSize: cfg.RateLimiting.Redis.PoolSize,
+		})
+	}
+	return store.NewPostgresStateStore(store.PostgresConfig{
+		Host:     cfg.RateLimiting.Postgres.Host,
+		Port:     cfg.RateLimiting.Postgres.Port,
+		User:     cfg.RateLimiting.Postgres.User,
+		Password: cfg.RateLimiting.Postgres.Password,
+		DBName:   cfg.RateLimiting.Postgres.DBName,
+		SSLMode:  "disable",
+	}, log)
+}
+
+// newLimiterFunc создает лимитер с собственными корзинами. scope отделяет
+// ключи лимитеров маршрутов в общем хранилище.
+type newLimiterFunc func(scope string, rate limiter.RateConfig) limiter.RateLimiter
+
+// rateLimiters лимитеры с общим состоянием в shared; без shared - локальные
+func rateLimiters(cfg *config.Config, shared limiter.SharedStore, rateStore limiter.ConfigStore, log logger.Logger) newLimiterFunc {
+	d := cfg.RateLimiting.Distributed
+	return func(scope string, rate limiter.RateConfig) limiter.RateLimiter {
+		if shared == nil {
+			return limiter.NewLimiter(rateStore, rate)
+		}
+		opts := limiter.SharedOptions{
+			KeyPrefix:    d.KeyPrefix + scope,
+			Timeout:      d.Timeout,
+			SyncInterval: d.SyncInterval,
+		}
+		if d.Mode == "sync" {
+			return limiter.NewSyncedLimiter(shared, rateStore, rate, opts, log)
+		}
+		return limiter.NewDistributedLimiter(shared, rateStore, rate, opts, log)
+	}
+}
+
+// buildRatePolicies собирает лимиты проксируемого трафика: общий лимитер
+// и отдельные лимитеры маршрутов с rate_limit
+func buildRatePolicies(
+	cfg *config.Config,
+	routes *routing.Table,
+	newLimiter newLimiterFunc,
+	defaultLimiter limiter.RateLimiter,
+) (*limiter.RoutePolicies, error) {
+	trustedProxies, err := proxy.ParseCIDRs(cfg.Proxy.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	opts := limiter.ClientIDOptions{
+		TrustedProxies: trustedProxies,
+		IPv4Prefix:     cfg.RateLimiting.IPv4Prefix,
+		IPv6Prefix:     cfg.RateLimiting.IPv6Prefix,
+	}
+	clientID, err := limiter.NewClientID(cfg.RateLimiting.ClientID, opts)
+	if err != nil {
+		return nil, fmt.Errorf("rate_limiting.client_id: %w", err)
+	}
+
+	policies := &limiter.RoutePolicies{
+		Default:       limiter.Policy{Limiter: defaultLimiter, ClientID: clientID},
+		Routes:        make(map[string]limiter.Policy),
+		Route:         routes.RouteName,
+		LegacyHeaders: cfg.RateLimiting.LegacyHeaders,
+	}
+	for _, r := range cfg.Routes {
+		rl := r.RateLimit
+		switch {
+		case rl.Disabled:
+			policies.Routes[r.Name] = limiter.Policy{}
+		case rl.Enabled():
+			routeClientID := clientID
+			if len(rl.ClientID) > 0 {
+				if routeClientID, err = limiter.NewClientID(rl.ClientID, opts); err != nil {
+					return nil, fmt.Errorf("route %s: rate_limit.client_id: %w", r.Name, err)
+				}
+			}
+			rate := defaultRateConfig(cfg)
+			if rl.Capacity > 0 {
+				rate.Capacity = rl.Capacity
+			}
+			// Скорость маршрута задается либо rate, либо window
+			if rl.Rate > 0 || rl.Window > 0 {
+				rate.RefillRate, rate.Window = rl.Rate, rl.Window
+			}
+			if rl.Algorithm != "" {
+				rate.Algorithm = limiter.Algorithm(rl.Algorithm)
+			}
+			if err := rate.Validate(); err != nil {
+				return nil, fmt.Errorf("route %s: rate_limit: %w", r.Name, err)
+			}
+			policies.Routes[r.Name] = limiter.Policy{
+				Limiter:  newLimiter("route:"+r.Name+":", rate),
+				ClientID: routeClientID,
+			}
+		}
+	}
+	return policies, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/config"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+	"github.com/xhaklaaa/go-highload-balancer/internal/tlsutil"
+)
+
+// buildTLSConfig загружает сертификаты HTTPS-листенера и следит за их обновлением
+func buildTLSConfig(cfg *config.Config, log logger.Logger) (*tls.Config, error) {
+	pairs := make([]tlsutil.CertPair, 0, len(cfg.TLS.Certificates))
+	for _, c := range cfg.TLS.Certificates {
+		pairs = append(pairs, tlsutil.CertPair{CertFile: c.CertFile, KeyFile: c.KeyFile})
+	}
+
+	certs, err := tlsutil.NewCertStore(pairs, log)
+	if err != nil {
+		return nil, err
+	}
+	if err := certs.Watch(context.Background()); err != nil {
+		return nil, err
+	}
+
+	minVersion, err := tlsutil.ParseVersion(cfg.TLS.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := tlsutil.ParseCipherSuites(cfg.TLS.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+	}, nil
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/xhaklaaa/go-highload-balancer/internal/cache"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+)
+
+// CacheHandler управляет кэшем ответов и показывает статистику объединения запросов.
+// Любой из компонентов может быть выключен (nil).
+type CacheHandler struct {
+	cache     *cache.Cache
+	coalescer *cache.Coalescer
+	logger    logger.Logger
+}
+
+func NewCacheHandler(c *cache.Cache, coalescer *cache.Coalescer, logger logger.Logger) *CacheHandler {
+	return &CacheHandler{
+		cache:     c,
+		coalescer: coalescer,
+		logger:    logger,
+	}
+}
+
+func (h *CacheHandler) RegisterRoutes(router *mux.Router) {
+	if h.cache != nil {
+		router.HandleFunc("/cache", h.purge).Methods("DELETE")
+	}
+	router.HandleFunc("/cache/stats", h.getStats).Methods("GET")
+}
+
+type cacheStatsResponse struct {
+	Cache      *cache.Stats         `json:"cache,omitempty"`
+	Coalescing *cache.CoalesceStats `json:"coalescing,omitempty"`
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// purge удаляет ответы по точному ключу (?key=) или префиксу ключа (?prefix=)
+func (h *CacheHandler) purge(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key, prefix := query.Get("key"), query.Get("prefix")
+
+	var purged int
+	switch {
+	case key != "" && prefix == "":
+		purged = h.cache.Purge(key)
+	case prefix != "" && key == "":
+		purged = h.cache.PurgePrefix(prefix)
+	default:
+		h.respondError(w, http.StatusBadRequest, "exactly one of key or prefix is required")
+		return
+	}
+
+	h.logger.Infof("Cache purge key=%q prefix=%q: %d entries", key, prefix, purged)
+	h.respondJSON(w, http.StatusOK, purgeResponse{Purged: purged})
+}
+
+func (h *CacheHandler) getStats(w http.ResponseWriter, r *http.Request) {
+	var response cacheStatsResponse
+	if h.cache != nil {
+		stats := h.cache.Stats()
+		response.Cache = &stats
+	}
+	if h.coalescer != nil {
+		stats := h.coalescer.Stats()
+		response.Coalescing = &stats
+	}
+	h.respondJSON(w, http.StatusOK, response)
+}
+
+func (h *CacheHandler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+func (h *CacheHandler) respondError(w http.ResponseWriter, code int, message string) {
+	resp := ErrorResponse{}
+	resp.Error.Code = code
+	resp.Error.Message = message
+
+	h.respondJSON(w, code, resp)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
@@ -27,13 +28,59 @@ func NewClientHandler(store limiter.ConfigStore, logger logger.Logger) *ClientHa
 type ClientRequest struct {
 	ID       string  `json:"client_id" validate:"required,alphanum"`
 	Capacity int64   `json:"capacity" validate:"required,gt=0"`
-	Rate     float64 `json:"rate_per_sec" validate:"required,gt=0"`
+	Rate     float64 `json:"rate_per_sec" validate:"gte=0"`
+	// Алгоритм лимита; пусто - token_bucket
+	Algorithm string `json:"algorithm,omitempty"`
+	// Окно в формате time.ParseDuration, например "1m", вместо rate_per_sec
+	Window string `json:"window,omitempty"`
 }
 
 type ClientResponse struct {
-	ID       string  `json:"client_id"`
-	Capacity int64   `json:"capacity"`
-	Rate     float64 `json:"rate_per_sec"`
+	ID        string  `json:"client_id"`
+	Capacity  int64   `json:"capacity"`
+	Rate      float64 `json:"rate_per_sec"`
+	Algorithm string  `json:"algorithm"`
+	Window    string  `json:"window,omitempty"`
+}
+
+// rateConfig переводит запрос в лимит и проверяет его
+func (req ClientRequest) rateConfig() (limiter.RateConfig, *validationError) {
+	config := limiter.RateConfig{
+		Capacity:   req.Capacity,
+		RefillRate: req.Rate,
+		Algorithm:  limiter.Algorithm(req.Algorithm),
+	}
+	if req.Window != "" {
+		window, err := time.ParseDuration(req.Window)
+		if err != nil {
+			return config, &validationError{Code: http.StatusUnprocessableEntity, Message: "field Window: invalid duration"}
+		}
+		// Хранилище держит окно в миллисекундах: "500us" превратилось бы в 0
+		if window%time.Millisecond != 0 {
+			return config, &validationError{Code: http.StatusUnprocessableEntity, Message: "field Window: must be a whole number of milliseconds"}
+		}
+		config.Window = window
+	}
+	if err := config.Validate(); err != nil {
+		return config, &validationError{Code: http.StatusUnprocessableEntity, Message: err.Error()}
+	}
+	return config, nil
+}
+
+func newClientResponse(id string, config limiter.RateConfig) ClientResponse {
+	resp := ClientResponse{
+		ID:        id,
+		Capacity:  config.Capacity,
+		Rate:      config.RefillRate,
+		Algorithm: string(config.Algorithm),
+	}
+	if resp.Algorithm == "" {
+		resp.Algorithm = string(limiter.TokenBucket)
+	}
+	if config.Window > 0 {
+		resp.Window = config.Window.String()
+	}
+	return resp
 }
 
 type ErrorResponse struct {
@@ -62,9 +109,10 @@ func (h *ClientHandler) createClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	config := limiter.RateConfig{
-		Capacity:   req.Capacity,
-		RefillRate: req.Rate,
+	config, verr := req.rateConfig()
+	if verr != nil {
+		h.respondError(w, verr.Code, verr.Message)
+		return
 	}
 
 	if err := h.store.UpsertConfig(r.Context(), req.ID, config); err != nil {
@@ -73,11 +121,7 @@ func (h *ClientHandler) createClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	h.logger.Infof("Client created: %s", req.ID)
-	h.respondJSON(w, http.StatusCreated, ClientResponse{
-		ID:       req.ID,
-		Capacity: config.Capacity,
-		Rate:     config.RefillRate,
-	})
+	h.respondJSON(w, http.StatusCreated, newClientResponse(req.ID, config))
 }
 
 func (h *ClientHandler) getClient(w http.ResponseWriter, r *http.Request) {
@@ -94,11 +138,7 @@ func (h *ClientHandler) getClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, ClientResponse{
-		ID:       clientID,
-		Capacity: config.Capacity,
-		Rate:     config.RefillRate,
-	})
+	h.respondJSON(w, http.StatusOK, newClientResponse(clientID, config))
 }
 
 func (h *ClientHandler) updateClient(w http.ResponseWriter, r *http.Request) {
@@ -115,9 +155,10 @@ func (h *ClientHandler) updateClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	config := limiter.RateConfig{
-		Capacity:   req.Capacity,
-		RefillRate: req.Rate,
+	config, verr := req.rateConfig()
+	if verr != nil {
+		h.respondError(w, verr.Code, verr.Message)
+		return
 	}
 
 	if err := h.store.UpsertConfig(r.Context(), clientID, config); err != nil {
@@ -126,11 +167,7 @@ func (h *ClientHandler) updateClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, ClientResponse{
-		ID:       clientID,
-		Capacity: config.Capacity,
-		Rate:     config.RefillRate,
-	})
+	h.respondJSON(w, http.StatusOK, newClientResponse(clientID, config))
 }
 
 func (h *ClientHandler) deleteClient(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/health"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+)
+
+const sseHeartbeatInterval = 15 * time.Second
+
+type HealthHandler struct {
+	history *health.History
+	logger  logger.Logger
+}
+
+func NewHealthHandler(history *health.History, logger logger.Logger) *HealthHandler {
+	return &HealthHandler{
+		history: history,
+		logger:  logger,
+	}
+}
+
+func (h *HealthHandler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/health/history", h.getHistory).Methods("GET")
+	router.HandleFunc("/health/events", h.streamEvents).Methods("GET")
+}
+
+// getHistory отдает историю переходов.
+// Фильтры: backend, state, since, until (RFC3339), limit.
+func (h *HealthHandler) getHistory(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHealthFilter(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, h.history.Query(filter))
+}
+
+// streamEvents транслирует новые переходы как Server-Sent Events
+func (h *HealthHandler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.respondError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	// Поток живет дольше WriteTimeout сервера
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.Warnf("Failed to reset write deadline for SSE: %v", err)
+	}
+
+	filter, err := parseHealthFilter(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, unsubscribe := h.history.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if filter.Backend != "" && e.Backend != filter.Backend {
+				continue
+			}
+			if filter.State != "" && e.NewState != filter.State {
+				continue
+			}
+
+			data, err := json.Marshal(e)
+			if err != nil {
+				h.logger.Errorf("Failed to encode health event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: transition\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func parseHealthFilter(r *http.Request) (health.Filter, error) {
+	q := r.URL.Query()
+	filter := health.Filter{
+		Backend: q.Get("backend"),
+		State:   q.Get("state"),
+	}
+
+	if filter.State != "" && filter.State != health.StateHealthy && filter.State != health.StateUnhealthy {
+		return filter, fmt.Errorf("invalid state: %s", filter.State)
+	}
+
+	var err error
+	if v := q.Get("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			return filter, fmt.Errorf("invalid limit: %s", v)
+		}
+	}
+
+	return filter, nil
+}
+
+func (h *HealthHandler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+func (h *HealthHandler) respondError(w http.ResponseWriter, code int, message string) {
+	resp := ErrorResponse{}
+	resp.Error.Code = code
+	resp.Error.Message = message
+
+	h.respondJSON(w, code, resp)
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/xhaklaaa/go-highload-balancer/internal/l4"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+)
+
+type L4Handler struct {
+	tcp    []*l4.TCPProxy
+	udp    []*l4.UDPProxy
+	logger logger.Logger
+}
+
+func NewL4Handler(tcp []*l4.TCPProxy, udp []*l4.UDPProxy, logger logger.Logger) *L4Handler {
+	return &L4Handler{
+		tcp:    tcp,
+		udp:    udp,
+		logger: logger,
+	}
+}
+
+func (h *L4Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/l4", h.getStatus).Methods("GET")
+}
+
+type l4Response struct {
+	TCP []l4.TCPStatus `json:"tcp"`
+	UDP []l4.UDPStatus `json:"udp"`
+}
+
+// getStatus возвращает L4-листенеры с их счетчиками и бэкендами
+func (h *L4Handler) getStatus(w http.ResponseWriter, r *http.Request) {
+	response := l4Response{
+		TCP: make([]l4.TCPStatus, 0, len(h.tcp)),
+		UDP: make([]l4.UDPStatus, 0, len(h.udp)),
+	}
+	for _, p := range h.tcp {
+		response.TCP = append(response.TCP, p.Status())
+	}
+	for _, p := range h.udp {
+		response.UDP = append(response.UDP, p.Status())
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Errorf("Failed to encode response: %v", err)
+	}
+}
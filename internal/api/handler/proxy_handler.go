@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxy"
+	"github.com/xhaklaaa/go-highload-balancer/internal/routing"
+)
+
+type ProxyHandler struct {
+	routes *routing.Table
+	logger logger.Logger
+}
+
+func NewProxyHandler(routes *routing.Table, logger logger.Logger) *ProxyHandler {
+	return &ProxyHandler{
+		routes: routes,
+		logger: logger,
+	}
+}
+
+func (h *ProxyHandler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/proxy/stats", h.getStats).Methods("GET")
+}
+
+// getStats возвращает статистику прокси по каждому пулу
+func (h *ProxyHandler) getStats(w http.ResponseWriter, r *http.Request) {
+	stats := make(map[string]proxy.Stats)
+	for _, pool := range h.routes.Pools() {
+		stats[pool.Name] = pool.Handler.Stats()
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		h.logger.Errorf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+	"github.com/xhaklaaa/go-highload-balancer/internal/routing"
+)
+
+type RoutingHandler struct {
+	routes *routing.Table
+	logger logger.Logger
+}
+
+func NewRoutingHandler(routes *routing.Table, logger logger.Logger) *RoutingHandler {
+	return &RoutingHandler{
+		routes: routes,
+		logger: logger,
+	}
+}
+
+func (h *RoutingHandler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/routes", h.getRoutes).Methods("GET")
+	router.HandleFunc("/routes/{name}/split", h.getSplit).Methods("GET")
+	router.HandleFunc("/routes/{name}/split", h.updateSplit).Methods("PUT")
+	router.HandleFunc("/routes/{name}/mirror", h.getMirror).Methods("GET")
+}
+
+// SplitWeightsRequest новые веса вариантов: имя пула -> вес
+type SplitWeightsRequest struct {
+	Weights map[string]int `json:"weights"`
+}
+
+type poolResponse struct {
+	Name      string                   `json:"name"`
+	Algorithm interfaces.AlgorithmType `json:"algorithm"`
+	Backends  []string                 `json:"backends"`
+}
+
+type routingResponse struct {
+	Routes []routing.Route `json:"routes"`
+	Pools  []poolResponse  `json:"pools"`
+}
+
+// getRoutes возвращает действующую таблицу маршрутизации в порядке проверки
+func (h *RoutingHandler) getRoutes(w http.ResponseWriter, r *http.Request) {
+	response := routingResponse{Routes: h.routes.Routes()}
+	for _, pool := range h.routes.Pools() {
+		backends := make([]string, 0)
+		for _, b := range pool.Balancer.GetAll() {
+			backends = append(backends, b.URL.String())
+		}
+		response.Pools = append(response.Pools, poolResponse{
+			Name:      pool.Name,
+			Algorithm: pool.Algorithm,
+			Backends:  backends,
+		})
+	}
+
+	h.respondJSON(w, http.StatusOK, response)
+}
+
+// getSplit возвращает веса и показатели вариантов маршрута
+func (h *RoutingHandler) getSplit(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.routes.SplitStats(mux.Vars(r)["name"])
+	if err != nil {
+		h.respondRouteError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, stats)
+}
+
+// updateSplit меняет веса вариантов маршрута без перезапуска
+func (h *RoutingHandler) updateSplit(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var req SplitWeightsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Weights) == 0 {
+		h.respondError(w, http.StatusBadRequest, "invalid JSON format")
+		return
+	}
+
+	split, err := h.routes.SetSplitWeights(name, req.Weights)
+	if err != nil {
+		h.respondRouteError(w, err)
+		return
+	}
+	h.logger.Infof("Split weights of route %s updated: %v", name, req.Weights)
+	h.respondJSON(w, http.StatusOK, split)
+}
+
+// getMirror возвращает счетчики зеркалирования и сравнение кодов ответа
+func (h *RoutingHandler) getMirror(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.routes.MirrorStats(mux.Vars(r)["name"])
+	if err != nil {
+		h.respondRouteError(w, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, stats)
+}
+
+func (h *RoutingHandler) respondRouteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, routing.ErrRouteNotFound):
+		h.respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, routing.ErrNotSplitRoute), errors.Is(err, routing.ErrNotMirroredRoute):
+		h.respondError(w, http.StatusConflict, err.Error())
+	default:
+		h.respondError(w, http.StatusUnprocessableEntity, err.Error())
+	}
+}
+
+func (h *RoutingHandler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+func (h *RoutingHandler) respondError(w http.ResponseWriter, code int, message string) {
+	resp := ErrorResponse{}
+	resp.Error.Code = code
+	resp.Error.Message = message
+
+	h.respondJSON(w, code, resp)
+}
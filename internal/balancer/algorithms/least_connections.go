@@ -9,6 +9,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/health"
 	"github.com/xhaklaaa/go-highload-balancer/internal/core"
 	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
 )
@@ -20,6 +21,10 @@ type LeastConnectionsBalancer struct {
 	mu       sync.RWMutex
 	logger   logger.Logger
 	client   *http.Client
+	recorder health.Recorder
+
+	healthPath    string
+	healthTimeout time.Duration
 }
 
 func NewLeastConnectionsBalancer(
@@ -32,6 +37,8 @@ func NewLeastConnectionsBalancer(
 		client: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		healthPath:    "/health",
+		healthTimeout: 3 * time.Second,
 	}
 
 	for i, rawURL := range backendURLs {
@@ -56,26 +63,50 @@ func (lc *LeastConnectionsBalancer) Next(r *http.Request) (*url.URL, error) {
 	lc.mu.RLock()
 	defer lc.mu.RUnlock()
 
-	var (
-		minConnections int64 = math.MaxInt64
-		selected       *core.Backend
-	)
+	// Лимит соединений или пробные слоты circuit breaker могли закончиться
+	// между проверкой и резервированием: такой бэкенд исключаем и выбираем заново
+	var skipped map[*core.Backend]bool
+	anyBusy := false
+	for len(skipped) < len(lc.backends) {
+		var (
+			minConnections int64 = math.MaxInt64
+			selected       *core.Backend
+		)
+
+		for _, backend := range lc.backends {
+			if skipped[backend] || !backend.AcceptsTraffic() {
+				continue
+			}
+			if backend.AtCapacity() {
+				anyBusy = true
+				continue
+			}
+			if connections := atomic.LoadInt64(&backend.ActiveConnections); connections < minConnections {
+				minConnections = connections
+				selected = backend
+			}
+		}
 
-	for _, backend := range lc.backends {
-		connections := atomic.LoadInt64(&backend.ActiveConnections)
-		if backend.IsHealthy() && connections < minConnections {
-			minConnections = connections
-			selected = backend
+		if selected == nil {
+			break
 		}
-	}
 
-	if selected == nil {
-		lc.logger.Warnf("All backends are unavailable")
-		return nil, core.ErrNoAvailableBackend
+		reserved, busy := selected.Reserve()
+		if reserved {
+			return selected.URL, nil
+		}
+		anyBusy = anyBusy || busy
+		if skipped == nil {
+			skipped = make(map[*core.Backend]bool)
+		}
+		skipped[selected] = true
 	}
 
-	atomic.AddInt64(&selected.ActiveConnections, 1)
-	return selected.URL, nil
+	if anyBusy {
+		return nil, core.ErrAllBackendsBusy
+	}
+	lc.logger.Warnf("All backends are unavailable")
+	return nil, core.ErrNoAvailableBackend
 }
 
 func (lc *LeastConnectionsBalancer) ReleaseConnection(urlStr string) {
@@ -83,8 +114,7 @@ func (lc *LeastConnectionsBalancer) ReleaseConnection(urlStr string) {
 	defer lc.mu.RUnlock()
 
 	if idx, exists := lc.indexMap[urlStr]; exists {
-		backend := lc.backends[idx]
-		atomic.AddInt64(&backend.ActiveConnections, -1)
+		lc.backends[idx].ReleaseConnection()
 	}
 }
 
@@ -94,7 +124,7 @@ func (lc *LeastConnectionsBalancer) MarkBackendStatus(urlStr string, healthy boo
 
 	if idx, exists := lc.indexMap[urlStr]; exists {
 		backend := lc.backends[idx]
-		backend.SetHealthy(healthy)
+		lc.setHealth(backend, healthy, health.SourceStatusUpdate, health.ProbeResult{})
 		lc.logger.Infof("Backend status changed: %s -> %v", urlStr, healthy)
 	}
 }
@@ -129,23 +159,36 @@ func (lc *LeastConnectionsBalancer) checkAllBackends() {
 }
 
 func (lc *LeastConnectionsBalancer) checkBackendHealth(backend *core.Backend) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), lc.healthTimeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", backend.URL.String()+"/health", nil)
-	if err != nil {
-		backend.SetHealthy(false)
-		return
-	}
+	res := health.Probe(ctx, lc.client, backend.URL, lc.healthPath)
+	lc.setHealth(backend, res.Healthy, health.SourceProbe, res)
+}
 
-	resp, err := lc.client.Do(req)
-	if err != nil {
-		backend.SetHealthy(false)
+// setHealth меняет состояние бэкенда и сообщает о переходе recorder'у
+func (lc *LeastConnectionsBalancer) setHealth(backend *core.Backend, healthy bool, source string, res health.ProbeResult) {
+	old := backend.SwapHealthy(healthy)
+	if old == healthy || lc.recorder == nil {
 		return
 	}
-	defer resp.Body.Close()
+	lc.recorder.Record(health.NewEvent(backend.URL.String(), old, healthy, source, res))
+}
+
+// SetHealthTransport задает транспорт активных проверок
+func (lc *LeastConnectionsBalancer) SetHealthTransport(rt http.RoundTripper) {
+	lc.client.Transport = rt
+}
+
+// SetHealthProbe задает путь и таймаут активной проверки
+func (lc *LeastConnectionsBalancer) SetHealthProbe(path string, timeout time.Duration) {
+	lc.healthPath = path
+	lc.healthTimeout = timeout
+}
 
-	backend.SetHealthy(resp.StatusCode == http.StatusOK)
+// SetHealthRecorder подключает запись истории переходов
+func (lc *LeastConnectionsBalancer) SetHealthRecorder(r health.Recorder) {
+	lc.recorder = r
 }
 
 func (lc *LeastConnectionsBalancer) GetAll() []*core.Backend {
@@ -8,6 +8,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/health"
 	"github.com/xhaklaaa/go-highload-balancer/internal/core"
 	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
 )
@@ -31,6 +32,10 @@ type RoundRobinBalancer struct {
 	indexMap map[string]int
 	Logger   logger.Logger
 	client   *http.Client
+	recorder health.Recorder
+
+	healthPath    string
+	healthTimeout time.Duration
 }
 
 func NewRoundRobinBalancer(
@@ -43,6 +48,8 @@ func NewRoundRobinBalancer(
 		client: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		healthPath:    "/health",
+		healthTimeout: 3 * time.Second,
 	}
 
 	for i, rawURL := range backendURLs {
@@ -75,27 +82,42 @@ func (b *RoundRobinBalancer) Next(r *http.Request) (*url.URL, error) {
 
 	start := atomic.LoadUint32(&b.Current)
 	next := start
+	anyBusy := false
 
 	for i := 0; i < len(b.Backends); i++ {
 		next = (next + 1) % uint32(len(b.Backends))
 		backend := b.Backends[next]
 
-		if backend.IsHealthy() {
+		reserved, busy := backend.Reserve()
+		if reserved {
 			atomic.StoreUint32(&b.Current, next)
 			return backend.URL, nil
 		}
+		anyBusy = anyBusy || busy
 	}
 
+	if anyBusy {
+		return nil, core.ErrAllBackendsBusy
+	}
 	b.Logger.Warnf("All backends are unavailable")
 	return nil, core.ErrNoAvailableBackend
 }
 
+func (b *RoundRobinBalancer) ReleaseConnection(url string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if idx, exists := b.indexMap[url]; exists {
+		b.Backends[idx].ReleaseConnection()
+	}
+}
+
 func (b *RoundRobinBalancer) MarkBackendStatus(url string, alive bool) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	if idx, exists := b.indexMap[url]; exists {
-		b.Backends[idx].SetAlive(alive)
+		b.setHealth(b.Backends[idx], alive, health.SourceStatusUpdate, health.ProbeResult{})
 		b.Logger.Infof("Backend status changed: %s -> %v", url, alive)
 	}
 }
@@ -130,23 +152,36 @@ func (b *RoundRobinBalancer) checkAllBackends() {
 }
 
 func (b *RoundRobinBalancer) checkBackendHealth(backend *core.Backend) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), b.healthTimeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", backend.URL.String()+"/health", nil)
-	if err != nil {
-		backend.SetHealthy(false)
-		return
-	}
+	res := health.Probe(ctx, b.client, backend.URL, b.healthPath)
+	b.setHealth(backend, res.Healthy, health.SourceProbe, res)
+}
 
-	resp, err := b.client.Do(req)
-	if err != nil {
-		backend.SetHealthy(false)
+// setHealth меняет состояние бэкенда и сообщает о переходе recorder'у
+func (b *RoundRobinBalancer) setHealth(backend *core.Backend, healthy bool, source string, res health.ProbeResult) {
+	old := backend.SwapHealthy(healthy)
+	if old == healthy || b.recorder == nil {
 		return
 	}
-	defer resp.Body.Close()
+	b.recorder.Record(health.NewEvent(backend.URL.String(), old, healthy, source, res))
+}
+
+// SetHealthTransport задает транспорт активных проверок
+func (b *RoundRobinBalancer) SetHealthTransport(rt http.RoundTripper) {
+	b.client.Transport = rt
+}
+
+// SetHealthProbe задает путь и таймаут активной проверки
+func (b *RoundRobinBalancer) SetHealthProbe(path string, timeout time.Duration) {
+	b.healthPath = path
+	b.healthTimeout = timeout
+}
 
-	backend.SetHealthy(resp.StatusCode == http.StatusOK)
+// SetHealthRecorder подключает запись истории переходов
+func (b *RoundRobinBalancer) SetHealthRecorder(r health.Recorder) {
+	b.recorder = r
 }
 
 func (rr *RoundRobinBalancer) GetAll() []*core.Backend {
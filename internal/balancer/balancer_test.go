@@ -7,8 +7,10 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/algorithms"
+	"github.com/xhaklaaa/go-highload-balancer/internal/core"
 	"github.com/xhaklaaa/go-highload-balancer/internal/proxy"
 	"gopkg.in/go-playground/assert.v1"
 )
@@ -125,3 +127,44 @@ func TestBalancerWithUnhealthyBackend(t *testing.T) {
 	handler.ServeHTTP(rr, req)
 	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
 }
+
+// Тест пропуска бэкенда с разомкнутой цепью
+func TestRoundRobinBalancer_SkipsOpenCircuit(t *testing.T) {
+	lb := algorithms.NewRoundRobinBalancer([]string{"http://backend1", "http://backend2"}, &MockLogger{})
+	AttachCircuitBreakers(lb, core.BreakerConfig{
+		Window:             10 * time.Second,
+		MinRequests:        2,
+		ErrorRateThreshold: 50,
+		OpenDuration:       50 * time.Millisecond,
+		HalfOpenRequests:   1,
+	})
+
+	broken := lb.GetAll()[0]
+	broken.Breaker.Record(false, time.Millisecond)
+	broken.Breaker.Record(false, time.Millisecond)
+	assert.Equal(t, core.BreakerOpen, broken.CircuitState())
+
+	for i := 0; i < 4; i++ {
+		selected, err := lb.Next(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "http://backend2", selected.String())
+	}
+
+	// После OpenDuration пропускается ровно один пробный запрос
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, core.BreakerHalfOpen, broken.CircuitState())
+
+	trials := 0
+	for i := 0; i < 4; i++ {
+		selected, _ := lb.Next(nil)
+		if selected.String() == "http://backend1" {
+			trials++
+		}
+	}
+	assert.Equal(t, 1, trials)
+
+	broken.Breaker.Record(true, 0)
+	assert.Equal(t, core.BreakerClosed, broken.CircuitState())
+}
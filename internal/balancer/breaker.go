@@ -0,0 +1,14 @@
+package balancer
+
+import (
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/core"
+)
+
+// AttachCircuitBreakers включает circuit breaker для всех бэкендов балансировщика.
+// Вызывается до начала обработки трафика.
+func AttachCircuitBreakers(lb interfaces.Balancer, cfg core.BreakerConfig) {
+	for _, backend := range lb.GetAll() {
+		backend.Breaker = core.NewCircuitBreaker(cfg)
+	}
+}
@@ -0,0 +1,174 @@
+package health
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	StateHealthy   = "healthy"
+	StateUnhealthy = "unhealthy"
+
+	// SourceProbe переход по результату активной проверки
+	SourceProbe = "probe"
+	// SourceStatusUpdate переход через MarkBackendStatus (админка, ошибки прокси)
+	SourceStatusUpdate = "status_update"
+)
+
+// Event описывает одну смену состояния бэкенда
+type Event struct {
+	Time       time.Time `json:"time"`
+	Backend    string    `json:"backend"`
+	OldState   string    `json:"old_state"`
+	NewState   string    `json:"new_state"`
+	Source     string    `json:"source"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LatencyMs  float64   `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Recorder принимает события о смене состояния бэкендов
+type Recorder interface {
+	Record(e Event)
+}
+
+// Sink сохраняет события во внешнее хранилище
+type Sink interface {
+	Save(e Event)
+}
+
+// Filter параметры выборки из истории
+type Filter struct {
+	Backend string
+	State   string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+// History хранит последние события в кольцевом буфере
+// и раздает их подписчикам в реальном времени
+type History struct {
+	mu          sync.RWMutex
+	events      []Event
+	next        int
+	full        bool
+	subscribers map[chan Event]struct{}
+	sinks       []Sink
+}
+
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = 1000
+	}
+	return &History{
+		events:      make([]Event, size),
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// NewEvent собирает событие перехода из результата проверки
+func NewEvent(backend string, oldHealthy, newHealthy bool, source string, res ProbeResult) Event {
+	e := Event{
+		Time:       time.Now(),
+		Backend:    backend,
+		OldState:   stateName(oldHealthy),
+		NewState:   stateName(newHealthy),
+		Source:     source,
+		StatusCode: res.StatusCode,
+		LatencyMs:  float64(res.Latency) / float64(time.Millisecond),
+	}
+	if res.Err != nil {
+		e.Error = res.Err.Error()
+	}
+	return e
+}
+
+func stateName(healthy bool) string {
+	if healthy {
+		return StateHealthy
+	}
+	return StateUnhealthy
+}
+
+func (h *History) AddSink(s Sink) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sinks = append(h.sinks, s)
+}
+
+func (h *History) Record(e Event) {
+	h.mu.Lock()
+	h.events[h.next] = e
+	h.next = (h.next + 1) % len(h.events)
+	if h.next == 0 {
+		h.full = true
+	}
+
+	// Медленный подписчик не должен тормозить health checks
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	sinks := h.sinks
+	h.mu.Unlock()
+
+	for _, s := range sinks {
+		s.Save(e)
+	}
+}
+
+// Query возвращает события от старых к новым с учетом фильтра.
+// При заданном Limit возвращаются последние Limit событий.
+func (h *History) Query(f Filter) []Event {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	start, count := 0, h.next
+	if h.full {
+		start, count = h.next, len(h.events)
+	}
+
+	result := make([]Event, 0)
+	for i := 0; i < count; i++ {
+		e := h.events[(start+i)%len(h.events)]
+		if f.Backend != "" && e.Backend != f.Backend {
+			continue
+		}
+		if f.State != "" && e.NewState != f.State {
+			continue
+		}
+		if !f.Since.IsZero() && e.Time.Before(f.Since) {
+			continue
+		}
+		if !f.Until.IsZero() && e.Time.After(f.Until) {
+			continue
+		}
+		result = append(result, e)
+	}
+
+	if f.Limit > 0 && len(result) > f.Limit {
+		result = result[len(result)-f.Limit:]
+	}
+	return result
+}
+
+// Subscribe возвращает канал новых событий и функцию отписки
+func (h *History) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
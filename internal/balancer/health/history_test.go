@@ -0,0 +1,94 @@
+package health
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testStart = time.Unix(1_700_000_000, 0)
+
+// record добавляет событие с временем testStart+i секунд
+func record(h *History, i int, backend, state string) {
+	h.Record(Event{
+		Time:     testStart.Add(time.Duration(i) * time.Second),
+		Backend:  backend,
+		NewState: state,
+	})
+}
+
+func times(events []Event) []int {
+	result := make([]int, 0, len(events))
+	for _, e := range events {
+		result = append(result, int(e.Time.Sub(testStart)/time.Second))
+	}
+	return result
+}
+
+func expectTimes(t *testing.T, events []Event, want ...int) {
+	t.Helper()
+	if got := times(events); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+}
+
+func TestHistory_OrderBeforeWraparound(t *testing.T) {
+	h := NewHistory(5)
+	expectTimes(t, h.Query(Filter{}))
+
+	for i := 1; i <= 3; i++ {
+		record(h, i, "a", StateHealthy)
+	}
+	expectTimes(t, h.Query(Filter{}), 1, 2, 3)
+}
+
+// После заполнения буфера старые события вытесняются, порядок сохраняется
+func TestHistory_Wraparound(t *testing.T) {
+	h := NewHistory(3)
+	for i := 1; i <= 3; i++ {
+		record(h, i, "a", StateHealthy)
+	}
+	expectTimes(t, h.Query(Filter{}), 1, 2, 3)
+
+	for i := 4; i <= 8; i++ {
+		record(h, i, "a", StateHealthy)
+	}
+	expectTimes(t, h.Query(Filter{}), 6, 7, 8)
+}
+
+// Limit вместе с фильтром по бэкенду возвращает последние события этого бэкенда
+func TestHistory_PerBackendLimit(t *testing.T) {
+	h := NewHistory(10)
+	for i := 1; i <= 8; i++ {
+		backend := "a"
+		if i%2 == 0 {
+			backend = "b"
+		}
+		record(h, i, backend, StateHealthy)
+	}
+
+	expectTimes(t, h.Query(Filter{Backend: "a"}), 1, 3, 5, 7)
+	expectTimes(t, h.Query(Filter{Backend: "b", Limit: 2}), 6, 8)
+	expectTimes(t, h.Query(Filter{Limit: 3}), 6, 7, 8)
+	// Limit больше числа событий возвращает все
+	expectTimes(t, h.Query(Filter{Backend: "a", Limit: 10}), 1, 3, 5, 7)
+	expectTimes(t, h.Query(Filter{Backend: "c", Limit: 2}))
+}
+
+func TestHistory_Filter(t *testing.T) {
+	h := NewHistory(4)
+	for i := 1; i <= 6; i++ {
+		state := StateHealthy
+		if i%3 == 0 {
+			state = StateUnhealthy
+		}
+		record(h, i, "a", state)
+	}
+
+	// В буфере остались события 3..6
+	expectTimes(t, h.Query(Filter{State: StateUnhealthy}), 3, 6)
+	expectTimes(t, h.Query(Filter{
+		Since: testStart.Add(4 * time.Second),
+		Until: testStart.Add(5 * time.Second),
+	}), 4, 5)
+}
@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+)
+
+// PostgresSink асинхронно пишет события в таблицу health_events.
+// Таблица создается миграцией из internal/migrations.
+type PostgresSink struct {
+	db     *sql.DB
+	logger logger.Logger
+	queue  chan Event
+	done   chan struct{}
+}
+
+func NewPostgresSink(db *sql.DB, logger logger.Logger) *PostgresSink {
+	s := &PostgresSink{
+		db:     db,
+		logger: logger,
+		queue:  make(chan Event, 256),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *PostgresSink) Save(e Event) {
+	select {
+	case s.queue <- e:
+	default:
+		s.logger.Warnf("Health event queue is full, dropping event for %s", e.Backend)
+	}
+}
+
+func (s *PostgresSink) Close() error {
+	close(s.queue)
+	<-s.done
+	return nil
+}
+
+func (s *PostgresSink) run() {
+	defer close(s.done)
+
+	for e := range s.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO health_events
+				(occurred_at, backend, old_state, new_state, source, status_code, latency_ms, error)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, e.Time, e.Backend, e.OldState, e.NewState, e.Source, e.StatusCode, e.LatencyMs, e.Error)
+		cancel()
+		if err != nil {
+			s.logger.Errorf("Failed to persist health event: %v", err)
+		}
+	}
+}
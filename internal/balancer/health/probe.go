@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ProbeResult результат одной проверки бэкенда
+type ProbeResult struct {
+	Healthy    bool
+	StatusCode int
+	Latency    time.Duration
+	Err        error
+}
+
+// Probe выполняет GET-запрос к health-эндпоинту бэкенда.
+// Бэкенды tcp:// проверяются установкой соединения, udp:// - пустой датаграммой.
+func Probe(ctx context.Context, client *http.Client, backend *url.URL, path string) ProbeResult {
+	switch backend.Scheme {
+	case "tcp":
+		return probeTCP(ctx, backend.Host)
+	case "udp":
+		return probeUDP(ctx, backend.Host)
+	}
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, backend.String()+path, nil)
+	if err != nil {
+		return ProbeResult{Err: err, Latency: time.Since(start)}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ProbeResult{Err: err, Latency: time.Since(start)}
+	}
+	defer resp.Body.Close()
+
+	return ProbeResult{
+		Healthy:    resp.StatusCode == http.StatusOK,
+		StatusCode: resp.StatusCode,
+		Latency:    time.Since(start),
+	}
+}
+
+func probeTCP(ctx context.Context, addr string) ProbeResult {
+	start := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return ProbeResult{Err: err, Latency: time.Since(start)}
+	}
+	conn.Close()
+	return ProbeResult{Healthy: true, Latency: time.Since(start)}
+}
+
+// udpProbeWait сколько ждать ICMP port unreachable после отправки датаграммы
+const udpProbeWait = 500 * time.Millisecond
+
+// probeUDP отправляет пустую датаграмму. Бэкенд считается недоступным, если
+// пришел ICMP port unreachable; ответ или тишина означают, что порт открыт.
+func probeUDP(ctx context.Context, addr string) ProbeResult {
+	start := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return ProbeResult{Err: err, Latency: time.Since(start)}
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(udpProbeWait)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write(nil); err != nil {
+		return ProbeResult{Err: err, Latency: time.Since(start)}
+	}
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		return ProbeResult{Err: err, Latency: time.Since(start)}
+	}
+	return ProbeResult{Healthy: true, Latency: time.Since(start)}
+}
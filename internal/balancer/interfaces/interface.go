@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/health"
 	"github.com/xhaklaaa/go-highload-balancer/internal/core"
 )
 
@@ -26,6 +27,27 @@ type HealthChecker interface {
 	StartHealthChecks(ctx context.Context, interval time.Duration)
 }
 
+// HealthProbeConfigurer балансировщик с настраиваемой активной проверкой
+type HealthProbeConfigurer interface {
+	SetHealthProbe(path string, timeout time.Duration)
+}
+
+// HealthTransportConfigurer балансировщик, проверяющий бэкенды
+// через заданный транспорт (TLS и протокол пула)
+type HealthTransportConfigurer interface {
+	SetHealthTransport(rt http.RoundTripper)
+}
+
+// ConnectionTracker балансировщик, считающий активные соединения
+type ConnectionTracker interface {
+	ReleaseConnection(url string)
+}
+
+// HealthObservable балансировщик, сообщающий о смене состояния бэкендов
+type HealthObservable interface {
+	SetHealthRecorder(r health.Recorder)
+}
+
 type Backend struct {
 	URL               *url.URL
 	Healthy           bool
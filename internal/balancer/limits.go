@@ -0,0 +1,17 @@
+package balancer
+
+import (
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+)
+
+// ApplyConnectionLimits задает бэкендам лимит одновременных запросов.
+// perBackend переопределяет значение по умолчанию для конкретных URL.
+// Вызывается до начала обработки трафика.
+func ApplyConnectionLimits(lb interfaces.Balancer, defaultMax int64, perBackend map[string]int64) {
+	for _, backend := range lb.GetAll() {
+		backend.MaxConnections = defaultMax
+		if limit, ok := perBackend[backend.URL.String()]; ok {
+			backend.MaxConnections = limit
+		}
+	}
+}
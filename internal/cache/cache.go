@@ -0,0 +1,299 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+)
+
+// Config настройки кэша ответов
+type Config struct {
+	// Суммарный размер сохраненных ответов, при превышении вытесняются давно не использованные
+	MaxBytes int64
+	// Ответы больше лимита не кэшируются
+	MaxEntryBytes int64
+	// Компоненты ключа, см. NewKeyFunc
+	Key []string
+	// Таймаут фонового обновления при stale-while-revalidate
+	RevalidateTimeout time.Duration
+}
+
+// Cache кэш ответов перед балансировщиком. Учитывает Cache-Control, Expires и Vary,
+// поддерживает stale-while-revalidate и stale-if-error.
+type Cache struct {
+	cfg    Config
+	key    KeyFunc
+	store  *store
+	logger logger.Logger
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+}
+
+func New(cfg Config, logger logger.Logger) (*Cache, error) {
+	key, err := NewKeyFunc(cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{
+		cfg:          cfg,
+		key:          key,
+		store:        newStore(cfg.MaxBytes),
+		logger:       logger,
+		revalidating: make(map[string]bool),
+	}, nil
+}
+
+// Key возвращает ключ кэша для запроса
+func (c *Cache) Key(r *http.Request) string {
+	return c.key(r)
+}
+
+// Purge удаляет ответы по ключу (все варианты Vary)
+func (c *Cache) Purge(key string) int {
+	return c.store.purge(key)
+}
+
+// PurgePrefix удаляет ответы, ключ которых начинается с prefix
+func (c *Cache) PurgePrefix(prefix string) int {
+	return c.store.purgePrefix(prefix)
+}
+
+func (c *Cache) Stats() Stats {
+	return c.store.stats()
+}
+
+// Middleware обслуживает кэшируемые запросы из кэша, остальные передает next
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return &handler{cache: c, next: next}
+}
+
+type handler struct {
+	cache *Cache
+	next  http.Handler
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c := h.cache
+	if !cacheableRequest(r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	key := c.key(r)
+	var stale *entry
+	if e := c.store.get(key, r); e != nil {
+		age := e.age(time.Now())
+		switch {
+		case age < e.freshFor:
+			c.store.record(true, false)
+			serveEntry(w, e, age, "HIT")
+			return
+		case age < e.freshFor+e.staleWhileRevalidate:
+			c.store.record(true, true)
+			serveEntry(w, e, age, "STALE")
+			h.revalidate(key, r)
+			return
+		case age < e.freshFor+e.staleIfError:
+			stale = e
+		}
+	}
+
+	// Пока есть устаревший ответ для stale-if-error, ошибку бэкенда клиенту не отдаем
+	cw := newCaptureWriter(w, c.cfg.MaxEntryBytes, stale != nil)
+	cw.Header().Set("X-Cache", "MISS")
+	h.next.ServeHTTP(cw, r)
+
+	if cw.suppressed {
+		c.store.record(true, true)
+		serveEntry(w, stale, stale.age(time.Now()), "STALE")
+		return
+	}
+	c.store.record(false, false)
+	c.save(key, r, cw)
+}
+
+// revalidate обновляет ответ в фоне; одновременно - не более одного обновления на ключ
+func (h *handler) revalidate(key string, r *http.Request) {
+	c := h.cache
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	req := r.Clone(context.Background())
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.cfg.RevalidateTimeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+
+		cw := newCaptureWriter(&discardWriter{header: make(http.Header)}, c.cfg.MaxEntryBytes, false)
+		h.next.ServeHTTP(cw, req)
+		if ctx.Err() != nil {
+			c.logger.Warnf("Cache revalidation of %s timed out", key)
+			return
+		}
+		c.save(key, req, cw)
+	}()
+}
+
+// save сохраняет полученный ответ, если он кэшируемый и уместился в лимит
+func (c *Cache) save(key string, r *http.Request, cw *captureWriter) {
+	if cw.status == 0 || cw.overflow {
+		return
+	}
+	now := time.Now()
+	fresh, swr, sie, ok := freshness(r, cw.status, cw.header, now)
+	if !ok {
+		return
+	}
+
+	header := cw.header.Clone()
+	header.Del("X-Cache")
+	header.Del("Age")
+
+	vary := varyNames(cw.header)
+	body := cw.buf.Bytes()
+	e := &entry{
+		key:                  key,
+		variant:              variantOf(vary, r),
+		status:               cw.status,
+		header:               header,
+		body:                 body,
+		size:                 int64(len(body)) + headerSize(header),
+		storedAt:             now,
+		initialAge:           initialAge(cw.header),
+		freshFor:             fresh,
+		staleWhileRevalidate: swr,
+		staleIfError:         sie,
+	}
+	c.store.set(e, vary)
+}
+
+func serveEntry(w http.ResponseWriter, e *entry, age time.Duration, status string) {
+	h := w.Header()
+	for k, vs := range e.header {
+		h[k] = append([]string(nil), vs...)
+	}
+	h.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	h.Set("X-Cache", status)
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+func headerSize(h http.Header) int64 {
+	var n int64
+	for k, vs := range h {
+		for _, v := range vs {
+			n += int64(len(k) + len(v) + 4)
+		}
+	}
+	return n
+}
+
+// captureWriter передает ответ клиенту и копирует тело для сохранения.
+// При suppressErrors ответ 5xx не отправляется: вместо него отдается устаревший.
+type captureWriter struct {
+	w              http.ResponseWriter
+	header         http.Header
+	status         int
+	limit          int64
+	buf            bytes.Buffer
+	overflow       bool
+	suppressErrors bool
+	suppressed     bool
+	// Ошибка записи клиенту: тело могло быть получено не полностью
+	writeErr error
+}
+
+func newCaptureWriter(w http.ResponseWriter, limit int64, suppressErrors bool) *captureWriter {
+	return &captureWriter{
+		w:              w,
+		header:         make(http.Header),
+		limit:          limit,
+		suppressErrors: suppressErrors,
+	}
+}
+
+func (cw *captureWriter) Header() http.Header {
+	return cw.header
+}
+
+func (cw *captureWriter) WriteHeader(code int) {
+	if cw.status != 0 || code < http.StatusOK {
+		return
+	}
+	cw.status = code
+	if cw.suppressErrors && code >= http.StatusInternalServerError {
+		cw.suppressed = true
+		return
+	}
+
+	dst := cw.w.Header()
+	for k, vs := range cw.header {
+		dst[k] = vs
+	}
+	cw.w.WriteHeader(code)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.suppressed {
+		return len(b), nil
+	}
+	if !cw.overflow {
+		if int64(cw.buf.Len()+len(b)) > cw.limit {
+			cw.overflow = true
+			cw.buf = bytes.Buffer{}
+		} else {
+			cw.buf.Write(b)
+		}
+	}
+	n, err := cw.w.Write(b)
+	if err != nil && cw.writeErr == nil {
+		cw.writeErr = err
+	}
+	return n, err
+}
+
+func (cw *captureWriter) FlushError() error {
+	if cw.suppressed || cw.status == 0 {
+		return nil
+	}
+	return http.NewResponseController(cw.w).Flush()
+}
+
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.w
+}
+
+// discardWriter отбрасывает ответ фонового обновления
+type discardWriter struct {
+	header http.Header
+}
+
+func (d *discardWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *discardWriter) WriteHeader(int) {}
+
+func (d *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testLogger struct{}
+
+func (testLogger) Infof(string, ...interface{})  {}
+func (testLogger) Warnf(string, ...interface{})  {}
+func (testLogger) Errorf(string, ...interface{}) {}
+func (testLogger) Fatalf(string, ...interface{}) {}
+
+func newTestCache(t *testing.T, maxBytes int64) *Cache {
+	c, err := New(Config{
+		MaxBytes:          maxBytes,
+		MaxEntryBytes:     1024,
+		RevalidateTimeout: time.Second,
+	}, testLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func get(h http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCache_FreshHitAndVary(t *testing.T) {
+	var calls atomic.Int64
+	h := newTestCache(t, 1<<20).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "%s-%d", r.Header.Get("Accept-Language"), n)
+	}))
+
+	en := http.Header{"Accept-Language": {"en"}}
+	if rr := get(h, "/page", en); rr.Body.String() != "en-1" || rr.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("unexpected first response: %q %q", rr.Body.String(), rr.Header().Get("X-Cache"))
+	}
+	if rr := get(h, "/page", en); rr.Body.String() != "en-1" || rr.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("expected cache hit, got %q %q", rr.Body.String(), rr.Header().Get("X-Cache"))
+	}
+	if rr := get(h, "/page", http.Header{"Accept-Language": {"ru"}}); rr.Body.String() != "ru-2" {
+		t.Fatalf("Vary ignored: %q", rr.Body.String())
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected 2 upstream calls, got %d", calls.Load())
+	}
+}
+
+func TestCache_NotStored(t *testing.T) {
+	cases := map[string]http.Header{
+		"no-store":   {"Cache-Control": {"no-store, max-age=60"}},
+		"private":    {"Cache-Control": {"private, max-age=60"}},
+		"no-expiry":  {},
+		"set-cookie": {"Cache-Control": {"max-age=60"}, "Set-Cookie": {"a=b"}},
+		"vary-star":  {"Cache-Control": {"max-age=60"}, "Vary": {"*"}},
+	}
+	for name, respHeader := range cases {
+		var calls atomic.Int64
+		h := newTestCache(t, 1<<20).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			for k, v := range respHeader {
+				w.Header()[k] = v
+			}
+			w.Write([]byte("body"))
+		}))
+		get(h, "/", nil)
+		get(h, "/", nil)
+		if calls.Load() != 2 {
+			t.Fatalf("%s: response was cached", name)
+		}
+	}
+}
+
+func TestCache_StaleIfErrorAndWhileRevalidate(t *testing.T) {
+	var failing atomic.Bool
+	var calls atomic.Int64
+	h := newTestCache(t, 1<<20).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if failing.Load() {
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+		fmt.Fprintf(w, "v%d", n)
+	}))
+
+	// Ответ сразу устаревает, но может отдаваться при ошибке бэкендов
+	get(h, "/sie?cc=max-age=0,stale-if-error=60", nil)
+	failing.Store(true)
+	rr := get(h, "/sie?cc=max-age=0,stale-if-error=60", nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != "v1" || rr.Header().Get("X-Cache") != "STALE" {
+		t.Fatalf("expected stale response on error, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	failing.Store(false)
+	get(h, "/swr?cc=max-age=0,stale-while-revalidate=60", nil)
+	before := calls.Load()
+	rr = get(h, "/swr?cc=max-age=0,stale-while-revalidate=60", nil)
+	if rr.Header().Get("X-Cache") != "STALE" {
+		t.Fatalf("expected stale-while-revalidate response, got %q", rr.Header().Get("X-Cache"))
+	}
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() == before {
+		if time.Now().After(deadline) {
+			t.Fatal("background revalidation did not happen")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCache_EvictionAndPurge(t *testing.T) {
+	c := newTestCache(t, 1000)
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(strings.Repeat("x", 300)))
+	}))
+
+	for _, p := range []string{"/catalog/1", "/catalog/2", "/catalog/3", "/other"} {
+		get(h, p, nil)
+	}
+	stats := c.Stats()
+	if stats.Bytes > 1000 || stats.Evictions == 0 {
+		t.Fatalf("LRU limit not enforced: %+v", stats)
+	}
+	// Первая запись вытеснена как самая старая
+	if rr := get(h, "/catalog/1", nil); rr.Header().Get("X-Cache") != "MISS" {
+		t.Fatal("oldest entry was not evicted")
+	}
+
+	if n := c.PurgePrefix("GET example.com/catalog/"); n == 0 {
+		t.Fatal("prefix purge removed nothing")
+	}
+	if rr := get(h, "/other", nil); rr.Header().Get("X-Cache") != "HIT" {
+		t.Fatal("purge removed entry outside prefix")
+	}
+	if n := c.Purge("GET example.com/other"); n != 1 {
+		t.Fatalf("expected to purge 1 entry, got %d", n)
+	}
+}
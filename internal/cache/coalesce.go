@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CoalesceConfig настройки объединения одинаковых одновременных запросов
+type CoalesceConfig struct {
+	// Компоненты ключа, см. NewKeyFunc
+	Key []string
+	// Сколько ожидающий ждет ответа ведущего запроса, затем идет к бэкенду сам
+	WaitTimeout time.Duration
+	// Ответы больше лимита не раздаются ожидающим
+	MaxBodyBytes int64
+}
+
+// CoalesceStats счетчики объединения запросов
+type CoalesceStats struct {
+	InFlight    int   `json:"in_flight"`
+	Leaders     int64 `json:"leaders"`
+	Coalesced   int64 `json:"coalesced"`
+	FallThrough int64 `json:"fall_through"`
+}
+
+// Coalescer отправляет к бэкенду один запрос из группы одновременных
+// одинаковых GET и раздает его ответ остальным
+type Coalescer struct {
+	cfg CoalesceConfig
+	key KeyFunc
+
+	mu    sync.Mutex
+	calls map[string]*call
+
+	leaders     atomic.Int64
+	coalesced   atomic.Int64
+	fallThrough atomic.Int64
+}
+
+// call ведущий запрос группы; resp заполняется до закрытия done
+type call struct {
+	done    chan struct{}
+	request *http.Request
+	resp    *captureWriter
+	shared  bool
+}
+
+func NewCoalescer(cfg CoalesceConfig) (*Coalescer, error) {
+	key, err := NewKeyFunc(cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &Coalescer{
+		cfg:   cfg,
+		key:   key,
+		calls: make(map[string]*call),
+	}, nil
+}
+
+func (co *Coalescer) Stats() CoalesceStats {
+	co.mu.Lock()
+	inFlight := len(co.calls)
+	co.mu.Unlock()
+
+	return CoalesceStats{
+		InFlight:    inFlight,
+		Leaders:     co.leaders.Load(),
+		Coalesced:   co.coalesced.Load(),
+		FallThrough: co.fallThrough.Load(),
+	}
+}
+
+func (co *Coalescer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cacheableRequest(r) || hasCredentials(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := co.key(r)
+		co.mu.Lock()
+		if c, ok := co.calls[key]; ok {
+			co.mu.Unlock()
+			co.wait(c, w, r, next)
+			return
+		}
+		c := &call{done: make(chan struct{}), request: r}
+		co.calls[key] = c
+		co.mu.Unlock()
+
+		co.leaders.Add(1)
+		co.lead(c, key, w, r, next)
+	})
+}
+
+// lead выполняет запрос и отдает ответ клиенту, сохраняя копию для ожидающих
+func (co *Coalescer) lead(c *call, key string, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	cw := newCaptureWriter(w, co.cfg.MaxBodyBytes, false)
+	defer func() {
+		co.mu.Lock()
+		delete(co.calls, key)
+		co.mu.Unlock()
+
+		c.resp = cw
+		c.shared = cw.status != 0 && !cw.overflow && cw.writeErr == nil &&
+			r.Context().Err() == nil && shareable(cw.header)
+		close(c.done)
+	}()
+	next.ServeHTTP(cw, r)
+}
+
+// wait ждет ответа ведущего запроса; по таймауту или если ответ
+// нельзя разделить, выполняет свой запрос
+func (co *Coalescer) wait(c *call, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	timer := time.NewTimer(co.cfg.WaitTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-c.done:
+		if c.shared && sameVariant(c.resp.header, c.request, r) {
+			co.coalesced.Add(1)
+			writeShared(w, c.resp)
+			return
+		}
+	case <-timer.C:
+	case <-r.Context().Done():
+		return
+	}
+
+	co.fallThrough.Add(1)
+	next.ServeHTTP(w, r)
+}
+
+// hasCredentials запрос от конкретного пользователя: ответ на него
+// может быть персональным, даже если бэкенд не пометил его private
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+// shareable ответ не содержит данных конкретного клиента
+func shareable(h http.Header) bool {
+	if h.Get("Set-Cookie") != "" || hasVaryStar(h) {
+		return false
+	}
+	cc := parseCacheControl(h)
+	return !cc.has("private") && !cc.has("no-store")
+}
+
+// sameVariant запросы совпадают по заголовкам из Vary ответа
+func sameVariant(h http.Header, a, b *http.Request) bool {
+	names := varyNames(h)
+	return variantOf(names, a) == variantOf(names, b)
+}
+
+func writeShared(w http.ResponseWriter, resp *captureWriter) {
+	dst := w.Header()
+	for k, vs := range resp.header {
+		dst[k] = append([]string(nil), vs...)
+	}
+	w.WriteHeader(resp.status)
+	w.Write(resp.buf.Bytes())
+}
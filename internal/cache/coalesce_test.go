@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescer_SharesUpstreamRequest(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int64
+	co, err := NewCoalescer(CoalesceConfig{WaitTimeout: 2 * time.Second, MaxBodyBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := co.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		<-release
+		fmt.Fprintf(w, "response-%d", n)
+	}))
+
+	const clients = 10
+	bodies := make([]string, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = get(h, "/item", nil).Body.String()
+		}(i)
+		if i == 0 {
+			for co.Stats().InFlight == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected one upstream request, got %d", calls.Load())
+	}
+	for i, body := range bodies {
+		if body != "response-1" {
+			t.Fatalf("client %d got %q", i, body)
+		}
+	}
+	if stats := co.Stats(); stats.Coalesced != clients-1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCoalescer_WaiterFallsThroughAfterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int64
+	co, err := NewCoalescer(CoalesceConfig{WaitTimeout: 20 * time.Millisecond, MaxBodyBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := co.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-release
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		get(h, "/slow", nil)
+		close(done)
+	}()
+	for co.Stats().InFlight == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if rr := get(h, "/slow", nil); rr.Body.String() != "ok" {
+		t.Fatalf("waiter got %q", rr.Body.String())
+	}
+	close(release)
+	<-done
+
+	if calls.Load() != 2 || co.Stats().FallThrough != 1 {
+		t.Fatalf("waiter did not fall through: calls=%d stats=%+v", calls.Load(), co.Stats())
+	}
+}
+
+// Запросы разных пользователей не объединяются, даже если ответ не private
+func TestCoalescer_SkipsCredentialedRequests(t *testing.T) {
+	release := make(chan struct{})
+	co, err := NewCoalescer(CoalesceConfig{WaitTimeout: 2 * time.Second, MaxBodyBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls atomic.Int64
+	h := co.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+
+	users := []string{"Bearer alice", "Bearer bob"}
+	bodies := make([]string, len(users))
+	var wg sync.WaitGroup
+	for i, auth := range users {
+		wg.Add(1)
+		go func(i int, auth string) {
+			defer wg.Done()
+			bodies[i] = get(h, "/me", http.Header{"Authorization": {auth}}).Body.String()
+		}(i, auth)
+	}
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() < int64(len(users)) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	for i, auth := range users {
+		if bodies[i] != auth {
+			t.Fatalf("user %q got %q", auth, bodies[i])
+		}
+	}
+	if stats := co.Stats(); stats.Leaders != 0 || stats.Coalesced != 0 {
+		t.Fatalf("credentialed requests coalesced: %+v", stats)
+	}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// KeyFunc строит ключ кэша по запросу
+type KeyFunc func(r *http.Request) string
+
+// DefaultKey компоненты ключа по умолчанию: "GET example.com/path?query"
+var DefaultKey = []string{"method", "host", "path", "query"}
+
+// NewKeyFunc собирает ключ из компонентов: method, host, path, query,
+// header:<имя> и cookie:<имя>. Компоненты добавляются в заданном порядке,
+// поэтому префикс ключа вида "GET example.com/catalog/" охватывает весь раздел.
+func NewKeyFunc(components []string) (KeyFunc, error) {
+	if len(components) == 0 {
+		components = DefaultKey
+	}
+
+	parts := make([]func(*strings.Builder, *http.Request), 0, len(components))
+	for _, c := range components {
+		kind, name, _ := strings.Cut(c, ":")
+		switch strings.ToLower(kind) {
+		case "method":
+			parts = append(parts, func(b *strings.Builder, r *http.Request) {
+				b.WriteString(r.Method)
+				b.WriteByte(' ')
+			})
+		case "host":
+			parts = append(parts, func(b *strings.Builder, r *http.Request) {
+				b.WriteString(strings.ToLower(r.Host))
+			})
+		case "path":
+			parts = append(parts, func(b *strings.Builder, r *http.Request) {
+				b.WriteString(r.URL.EscapedPath())
+			})
+		case "query":
+			parts = append(parts, func(b *strings.Builder, r *http.Request) {
+				if r.URL.RawQuery != "" {
+					b.WriteByte('?')
+					b.WriteString(r.URL.RawQuery)
+				}
+			})
+		case "header":
+			if name == "" {
+				return nil, fmt.Errorf("cache key component %q: header name required", c)
+			}
+			parts = append(parts, func(b *strings.Builder, r *http.Request) {
+				fmt.Fprintf(b, " %s=%s", name, r.Header.Get(name))
+			})
+		case "cookie":
+			if name == "" {
+				return nil, fmt.Errorf("cache key component %q: cookie name required", c)
+			}
+			parts = append(parts, func(b *strings.Builder, r *http.Request) {
+				value := ""
+				if cookie, err := r.Cookie(name); err == nil {
+					value = cookie.Value
+				}
+				fmt.Fprintf(b, " cookie:%s=%s", name, value)
+			})
+		default:
+			return nil, fmt.Errorf("unknown cache key component %q", c)
+		}
+	}
+
+	return func(r *http.Request) string {
+		var b strings.Builder
+		for _, part := range parts {
+			part(&b, r)
+		}
+		return b.String()
+	}, nil
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl разобранный заголовок Cache-Control
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, value := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, arg, _ := strings.Cut(directive, "=")
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// cacheableStatus коды ответа, кэшируемые при явном сроке свежести
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+	http.StatusPermanentRedirect:    true,
+}
+
+// cacheableRequest запрос может быть обслужен из кэша
+func cacheableRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	if r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	cc := parseCacheControl(r.Header)
+	return !cc.has("no-store") && !cc.has("no-cache")
+}
+
+// freshness вычисляет срок свежести ответа для общего кэша.
+// false - ответ не может быть сохранен. Эвристическая свежесть не используется.
+func freshness(r *http.Request, status int, h http.Header, now time.Time) (fresh, swr, sie time.Duration, ok bool) {
+	if !cacheableStatus[status] {
+		return 0, 0, 0, false
+	}
+	if h.Get("Set-Cookie") != "" || hasVaryStar(h) {
+		return 0, 0, 0, false
+	}
+
+	reqCC := parseCacheControl(r.Header)
+	cc := parseCacheControl(h)
+	if reqCC.has("no-store") || cc.has("no-store") || cc.has("private") || cc.has("no-cache") {
+		return 0, 0, 0, false
+	}
+	// Ответы на запросы с авторизацией хранятся только с явным разрешением
+	if r.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return 0, 0, 0, false
+	}
+
+	if d, ok := cc.seconds("s-maxage"); ok {
+		fresh = d
+	} else if d, ok := cc.seconds("max-age"); ok {
+		fresh = d
+	} else if expires := h.Get("Expires"); expires != "" {
+		exp, err := http.ParseTime(expires)
+		if err != nil {
+			// Неверный Expires означает уже истекший ответ
+			return 0, 0, 0, false
+		}
+		date := now
+		if d, err := http.ParseTime(h.Get("Date")); err == nil {
+			date = d
+		}
+		fresh = exp.Sub(date)
+	} else {
+		return 0, 0, 0, false
+	}
+	if fresh <= 0 {
+		fresh = 0
+	}
+
+	// must-revalidate и proxy-revalidate запрещают отдавать устаревший ответ
+	if !cc.has("must-revalidate") && !cc.has("proxy-revalidate") {
+		swr, _ = cc.seconds("stale-while-revalidate")
+		sie, _ = cc.seconds("stale-if-error")
+	}
+	if fresh == 0 && swr == 0 && sie == 0 {
+		return 0, 0, 0, false
+	}
+	return fresh, swr, sie, true
+}
+
+func hasVaryStar(h http.Header) bool {
+	for _, name := range varyNames(h) {
+		if name == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// varyNames канонические имена заголовков из Vary в стабильном порядке
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, value := range h.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func initialAge(h http.Header) time.Duration {
+	n, err := strconv.ParseInt(h.Get("Age"), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// entry сохраненный ответ
+type entry struct {
+	key     string
+	variant string
+	status  int
+	header  http.Header
+	body    []byte
+	size    int64
+
+	// Момент получения ответа и его возраст на тот момент (заголовок Age)
+	storedAt   time.Time
+	initialAge time.Duration
+	freshFor   time.Duration
+	// stale-while-revalidate и stale-if-error
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+}
+
+func (e *entry) age(now time.Time) time.Duration {
+	age := now.Sub(e.storedAt)
+	if age < 0 {
+		age = 0
+	}
+	return age + e.initialAge
+}
+
+// Stats состояние кэша
+type Stats struct {
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"max_bytes"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Stale     int64 `json:"stale"`
+	Evictions int64 `json:"evictions"`
+}
+
+// store LRU-хранилище с ограничением по суммарному размеру.
+// Ответы с Vary хранятся как варианты одного ключа: vary - имена заголовков
+// из последнего ответа, variant - их значения в запросе.
+type store struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	lru      *list.List
+	items    map[string]*list.Element
+	vary     map[string][]string
+	variants map[string]map[string]bool
+
+	hits, misses, stale, evictions int64
+}
+
+func newStore(maxBytes int64) *store {
+	return &store{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+		vary:     make(map[string][]string),
+		variants: make(map[string]map[string]bool),
+	}
+}
+
+func itemKey(key, variant string) string {
+	return key + "\x00" + variant
+}
+
+// variantOf значения заголовков Vary в запросе
+func variantOf(names []string, r *http.Request) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (s *store) get(key string, r *http.Request) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[itemKey(key, variantOf(s.vary[key], r))]
+	if !ok {
+		return nil
+	}
+	s.lru.MoveToFront(elem)
+	return elem.Value.(*entry)
+}
+
+func (s *store) set(e *entry, vary []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.size > s.maxBytes {
+		return
+	}
+	// Набор заголовков Vary сменился: старые варианты больше не найти
+	if !equalNames(s.vary[e.key], vary) {
+		s.removeKey(e.key)
+	}
+
+	ik := itemKey(e.key, e.variant)
+	if elem, ok := s.items[ik]; ok {
+		s.removeElement(elem)
+	}
+	if len(vary) > 0 {
+		s.vary[e.key] = vary
+	}
+
+	s.items[ik] = s.lru.PushFront(e)
+	s.bytes += e.size
+	if s.variants[e.key] == nil {
+		s.variants[e.key] = make(map[string]bool)
+	}
+	s.variants[e.key][e.variant] = true
+
+	for s.bytes > s.maxBytes {
+		s.removeElement(s.lru.Back())
+		s.evictions++
+	}
+}
+
+// purge удаляет все варианты ключа
+func (s *store) purge(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeKey(key)
+}
+
+// purgePrefix удаляет все ключи с заданным префиксом
+func (s *store) purgePrefix(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for key := range s.variants {
+		if strings.HasPrefix(key, prefix) {
+			removed += s.removeKey(key)
+		}
+	}
+	return removed
+}
+
+func (s *store) removeKey(key string) int {
+	removed := 0
+	for variant := range s.variants[key] {
+		if elem, ok := s.items[itemKey(key, variant)]; ok {
+			s.removeElement(elem)
+			removed++
+		}
+	}
+	delete(s.vary, key)
+	return removed
+}
+
+func (s *store) removeElement(elem *list.Element) {
+	e := elem.Value.(*entry)
+	s.lru.Remove(elem)
+	delete(s.items, itemKey(e.key, e.variant))
+	s.bytes -= e.size
+
+	if variants := s.variants[e.key]; variants != nil {
+		delete(variants, e.variant)
+		if len(variants) == 0 {
+			delete(s.variants, e.key)
+			delete(s.vary, e.key)
+		}
+	}
+}
+
+func (s *store) record(hit, stale bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case stale:
+		s.stale++
+	case hit:
+		s.hits++
+	default:
+		s.misses++
+	}
+}
+
+func (s *store) stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		Entries:   s.lru.Len(),
+		Bytes:     s.bytes,
+		MaxBytes:  s.maxBytes,
+		Hits:      s.hits,
+		Misses:    s.misses,
+		Stale:     s.stale,
+		Evictions: s.evictions,
+	}
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
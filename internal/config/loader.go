@@ -2,16 +2,23 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Port         int      `mapstructure:"port"`
+	// Окружение: production или development
+	Environment string `mapstructure:"environment"`
+	Port        int    `mapstructure:"port"`
+	// HTTP/2 без TLS на обычном порту (клиенты gRPC)
+	H2C          bool     `mapstructure:"h2c"`
 	Backends     []string `mapstructure:"backends"`
 	RateLimiting struct {
 		Enabled  bool   `mapstructure:"enabled"`
@@ -26,19 +33,380 @@ type Config struct {
 		Default struct {
 			Capacity int64   `mapstructure:"capacity"`
 			Rate     float64 `mapstructure:"rate"`
+			// token_bucket, fixed_window, sliding_window_log,
+			// sliding_window_counter или gcra
+			Algorithm string `mapstructure:"algorithm"`
+			// Для лимитов вида "capacity запросов за window" вместо rate
+			Window time.Duration `mapstructure:"window"`
 		} `mapstructure:"default"`
+		// Цепочка источников идентификатора клиента, первый непустой побеждает:
+		// header:<имя>, bearer, jwt:<claim>, cookie:<имя>, forwarded_ip, ip
+		ClientID []string `mapstructure:"client_id"`
+		// Группировка адресов по подсетям для источников ip и forwarded_ip
+		IPv4Prefix int `mapstructure:"ipv4_prefix"`
+		IPv6Prefix int `mapstructure:"ipv6_prefix"`
+		// Дублировать RateLimit-* в X-RateLimit-* для старых клиентов
+		LegacyHeaders bool `mapstructure:"legacy_headers"`
+		// Общее состояние лимитов для нескольких экземпляров балансировщика
+		Distributed struct {
+			Enabled bool `mapstructure:"enabled"`
+			// postgres (rate_limiting.postgres) или redis (rate_limiting.redis)
+			Backend string `mapstructure:"backend"`
+			// strict - каждый запрос проверяется в хранилище;
+			// sync - локальный учет с отправкой в хранилище раз в sync_interval
+			Mode         string        `mapstructure:"mode"`
+			SyncInterval time.Duration `mapstructure:"sync_interval"`
+			// Таймаут операции с хранилищем; при ошибке лимит считается локально
+			Timeout   time.Duration `mapstructure:"timeout"`
+			KeyPrefix string        `mapstructure:"key_prefix"`
+		} `mapstructure:"distributed"`
+		Redis struct {
+			Addr     string `mapstructure:"addr"`
+			Password string `mapstructure:"password"`
+			DB       int    `mapstructure:"db"`
+			PoolSize int    `mapstructure:"pool_size"`
+		} `mapstructure:"redis"`
 	} `mapstructure:"rate_limiting"`
 	Balancing struct {
 		Algorithm string `mapstructure:"algorithm"`
 	} `mapstructure:"balancing"`
+	HealthCheck struct {
+		Interval    time.Duration `mapstructure:"interval"`
+		Timeout     time.Duration `mapstructure:"timeout"`
+		Path        string        `mapstructure:"path"`
+		HistorySize int           `mapstructure:"history_size"`
+		Persist     bool          `mapstructure:"persist"`
+	} `mapstructure:"health_check"`
+	Proxy struct {
+		Timeout          time.Duration `mapstructure:"timeout"`
+		MaxReplayBytes   int64         `mapstructure:"max_replay_bytes"`
+		SpoolLargeBodies bool          `mapstructure:"spool_large_bodies"`
+		SpoolDir         string        `mapstructure:"spool_dir"`
+		MaxSpoolBytes    int64         `mapstructure:"max_spool_bytes"`
+		UpgradeIdle      time.Duration `mapstructure:"upgrade_idle_timeout"`
+		TrustedProxies   []string      `mapstructure:"trusted_proxies"`
+		PreserveHost     bool          `mapstructure:"preserve_host"`
+		Via              string        `mapstructure:"via"`
+		Retry            struct {
+			MaxAttempts        int           `mapstructure:"max_attempts"`
+			RetryOn            []string      `mapstructure:"retry_on"`
+			StatusCodes        []int         `mapstructure:"status_codes"`
+			GRPCStatusCodes    []string      `mapstructure:"grpc_status_codes"`
+			Methods            []string      `mapstructure:"methods"`
+			PerTryTimeout      time.Duration `mapstructure:"per_try_timeout"`
+			BackoffBase        time.Duration `mapstructure:"backoff_base"`
+			BackoffMax         time.Duration `mapstructure:"backoff_max"`
+			BudgetPercent      float64       `mapstructure:"budget_percent"`
+			BudgetMinPerSecond float64       `mapstructure:"budget_min_per_second"`
+		} `mapstructure:"retry"`
+	} `mapstructure:"proxy"`
+	CircuitBreaker struct {
+		Enabled               bool          `mapstructure:"enabled"`
+		Window                time.Duration `mapstructure:"window"`
+		MinRequests           int64         `mapstructure:"min_requests"`
+		ErrorRateThreshold    float64       `mapstructure:"error_rate_threshold"`
+		SlowCallDuration      time.Duration `mapstructure:"slow_call_duration"`
+		SlowCallRateThreshold float64       `mapstructure:"slow_call_rate_threshold"`
+		OpenDuration          time.Duration `mapstructure:"open_duration"`
+		HalfOpenRequests      int           `mapstructure:"half_open_requests"`
+	} `mapstructure:"circuit_breaker"`
+	ConnectionLimits struct {
+		DefaultMaxConnections int64 `mapstructure:"default_max_connections"`
+		Backends              []struct {
+			URL            string `mapstructure:"url"`
+			MaxConnections int64  `mapstructure:"max_connections"`
+		} `mapstructure:"backends"`
+		QueueSize    int           `mapstructure:"queue_size"`
+		QueueTimeout time.Duration `mapstructure:"queue_timeout"`
+	} `mapstructure:"connection_limits"`
+	Pools  []PoolConfig  `mapstructure:"pools"`
+	Routes []RouteConfig `mapstructure:"routes"`
+	// Балансировка TCP-соединений (L4), работает рядом с HTTP-сервером
+	TCP struct {
+		Listeners []TCPListenerConfig `mapstructure:"listeners"`
+	} `mapstructure:"tcp"`
+	// Балансировка UDP-датаграмм с закреплением клиента за бэкендом
+	UDP struct {
+		Listeners []UDPListenerConfig `mapstructure:"listeners"`
+	} `mapstructure:"udp"`
+	Cache struct {
+		Enabled           bool          `mapstructure:"enabled"`
+		MaxBytes          int64         `mapstructure:"max_bytes"`
+		MaxEntryBytes     int64         `mapstructure:"max_entry_bytes"`
+		Key               []string      `mapstructure:"key"`
+		RevalidateTimeout time.Duration `mapstructure:"revalidate_timeout"`
+	} `mapstructure:"cache"`
+	Coalescing struct {
+		Enabled      bool          `mapstructure:"enabled"`
+		Key          []string      `mapstructure:"key"`
+		WaitTimeout  time.Duration `mapstructure:"wait_timeout"`
+		MaxBodyBytes int64         `mapstructure:"max_body_bytes"`
+	} `mapstructure:"coalescing"`
+	Compression struct {
+		Enabled      bool     `mapstructure:"enabled"`
+		Encodings    []string `mapstructure:"encodings"`
+		ContentTypes []string `mapstructure:"content_types"`
+		MinSize      int      `mapstructure:"min_size"`
+	} `mapstructure:"compression"`
+	TLS struct {
+		Enabled      bool `mapstructure:"enabled"`
+		Port         int  `mapstructure:"port"`
+		Certificates []struct {
+			CertFile string `mapstructure:"cert_file"`
+			KeyFile  string `mapstructure:"key_file"`
+		} `mapstructure:"certificates"`
+		MinVersion   string   `mapstructure:"min_version"`
+		CipherSuites []string `mapstructure:"cipher_suites"`
+		// Обычный HTTP-порт только перенаправляет на HTTPS
+		RedirectHTTP bool `mapstructure:"redirect_http"`
+	} `mapstructure:"tls"`
+	// PROXY protocol от L4-балансировщика перед нами: адрес клиента
+	// берется из заголовка, а не из адреса соединения
+	ProxyProtocol struct {
+		// Разбирать заголовок на HTTP- и HTTPS-портах
+		Enabled bool `mapstructure:"enabled"`
+		// Заголовок принимается только от этих адресов и обязателен для них
+		TrustedCIDRs  []string      `mapstructure:"trusted_cidrs"`
+		HeaderTimeout time.Duration `mapstructure:"header_timeout"`
+	} `mapstructure:"proxy_protocol"`
+}
+
+// PoolConfig именованный пул бэкендов; пустые поля берутся из глобальных настроек
+type PoolConfig struct {
+	Name        string   `mapstructure:"name"`
+	Algorithm   string   `mapstructure:"algorithm"`
+	Backends    []string `mapstructure:"backends"`
+	HealthCheck struct {
+		Interval time.Duration `mapstructure:"interval"`
+		Timeout  time.Duration `mapstructure:"timeout"`
+		Path     string        `mapstructure:"path"`
+	} `mapstructure:"health_check"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// TLS к бэкендам пула: применяется к проксируемым запросам и активным проверкам
+	TLS UpstreamTLSConfig `mapstructure:"tls"`
+	// Протокол к бэкендам: http1, h2 (поверх TLS) или h2c (prior knowledge)
+	Protocol string      `mapstructure:"protocol"`
+	HTTP2    HTTP2Config `mapstructure:"http2"`
+}
+
+// HTTP2Config настройки соединений HTTP/2 с бэкендами
+type HTTP2Config struct {
+	// Потоков на соединение, сверх - новое соединение; 0 - по SETTINGS бэкенда
+	MaxConcurrentStreams int           `mapstructure:"max_concurrent_streams"`
+	PingInterval         time.Duration `mapstructure:"ping_interval"`
+	PingTimeout          time.Duration `mapstructure:"ping_timeout"`
+}
+
+type UpstreamTLSConfig struct {
+	CAFile     string `mapstructure:"ca_file"`
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	ServerName string `mapstructure:"server_name"`
+	// Разрешено только при environment: development
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+}
+
+// Enabled задана ли для пула собственная TLS-конфигурация
+func (c UpstreamTLSConfig) Enabled() bool {
+	return c.CAFile != "" || c.CertFile != "" || c.ServerName != "" || c.InsecureSkipVerify
+}
+
+// TCPListenerConfig TCP-листенер со своим набором бэкендов
+type TCPListenerConfig struct {
+	Name   string `mapstructure:"name"`
+	Listen string `mapstructure:"listen"`
+	// Пусто - balancing.algorithm
+	Algorithm string `mapstructure:"algorithm"`
+	// host:port или tcp://host:port
+	Backends       []string      `mapstructure:"backends"`
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+	IdleTimeout    time.Duration `mapstructure:"idle_timeout"`
+	ProxyProtocol  struct {
+		// Принимать заголовок от proxy_protocol.trusted_cidrs
+		Accept bool `mapstructure:"accept"`
+		// Отправлять заголовок бэкендам: v1 или v2; пусто - не отправлять
+		Send string `mapstructure:"send"`
+	} `mapstructure:"proxy_protocol"`
+	// Проверка установкой TCP-соединения; пустые поля из health_check
+	HealthCheck struct {
+		Interval time.Duration `mapstructure:"interval"`
+		Timeout  time.Duration `mapstructure:"timeout"`
+	} `mapstructure:"health_check"`
+}
+
+// UDPListenerConfig UDP-листенер со своим набором бэкендов
+type UDPListenerConfig struct {
+	Name   string `mapstructure:"name"`
+	Listen string `mapstructure:"listen"`
+	// Пусто - balancing.algorithm; hash - по IP клиента
+	Algorithm string `mapstructure:"algorithm"`
+	// host:port или udp://host:port
+	Backends []string `mapstructure:"backends"`
+	// Сессия клиента закрывается после этого времени без датаграмм
+	SessionTimeout time.Duration `mapstructure:"session_timeout"`
+	MaxSessions    int           `mapstructure:"max_sessions"`
+	// Проверка пробной датаграммой; пустые поля из health_check
+	HealthCheck struct {
+		Interval time.Duration `mapstructure:"interval"`
+		Timeout  time.Duration `mapstructure:"timeout"`
+	} `mapstructure:"health_check"`
+}
+
+type RouteConfig struct {
+	Name     string `mapstructure:"name"`
+	Priority int    `mapstructure:"priority"`
+	Match    struct {
+		Host       string            `mapstructure:"host"`
+		PathPrefix string            `mapstructure:"path_prefix"`
+		PathRegex  string            `mapstructure:"path_regex"`
+		Methods    []string          `mapstructure:"methods"`
+		Headers    map[string]string `mapstructure:"headers"`
+	} `mapstructure:"match"`
+	Pool string `mapstructure:"pool"`
+	// Split делит трафик маршрута между пулами по весам вместо одного pool
+	Split SplitConfig `mapstructure:"split"`
+	// Mirror зеркалирует выборку запросов в теневой пул
+	Mirror MirrorConfig `mapstructure:"mirror"`
+	// RateLimit собственный лимит маршрута вместо rate_limiting.default
+	RateLimit RouteRateLimitConfig `mapstructure:"rate_limit"`
+	// Hedge дублирует медленные GET/HEAD запросы на второй бэкенд пула
+	Hedge HedgeConfig `mapstructure:"hedge"`
+}
+
+// RouteRateLimitConfig лимит маршрута с отдельными корзинами клиентов.
+// Действует при rate_limiting.enabled; пустые поля берутся из rate_limiting,
+// персональные лимиты клиентов из API действуют и здесь.
+type RouteRateLimitConfig struct {
+	// Не ограничивать запросы маршрута
+	Disabled  bool          `mapstructure:"disabled"`
+	Capacity  int64         `mapstructure:"capacity"`
+	Rate      float64       `mapstructure:"rate"`
+	Algorithm string        `mapstructure:"algorithm"`
+	Window    time.Duration `mapstructure:"window"`
+	ClientID  []string      `mapstructure:"client_id"`
+}
+
+// Enabled задан ли для маршрута собственный лимит
+func (c RouteRateLimitConfig) Enabled() bool {
+	return c.Capacity > 0 || c.Rate > 0 || c.Algorithm != "" || c.Window > 0 || len(c.ClientID) > 0
+}
+
+// MirrorConfig теневой трафик маршрута; пустой pool - зеркалирование выключено
+type MirrorConfig struct {
+	Pool          string        `mapstructure:"pool"`
+	SamplePercent float64       `mapstructure:"sample_percent"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+	MaxBodyBytes  int64         `mapstructure:"max_body_bytes"`
+	CompareStatus bool          `mapstructure:"compare_status"`
+	MaxInFlight   int           `mapstructure:"max_in_flight"`
+}
+
+// HedgeConfig hedged-запросы маршрута; задержка и доля считаются по маршруту
+type HedgeConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Delay           time.Duration `mapstructure:"delay"`
+	DelayPercentile float64       `mapstructure:"delay_percentile"`
+	MaxPercent      float64       `mapstructure:"max_percent"`
 }
 
+type SplitConfig struct {
+	Variants []struct {
+		Pool   string `mapstructure:"pool"`
+		Weight int    `mapstructure:"weight"`
+	} `mapstructure:"variants"`
+	// Заголовок и cookie с именем пула принудительно выбирают вариант
+	OverrideHeader string `mapstructure:"override_header"`
+	OverrideCookie string `mapstructure:"override_cookie"`
+	// Идентификатор клиента для закрепления за вариантом
+	Sticky struct {
+		Header string `mapstructure:"header"`
+		Cookie string `mapstructure:"cookie"`
+	} `mapstructure:"sticky"`
+}
+
+// DefaultPoolName пул из корневого списка backends
+const DefaultPoolName = "default"
+
+// DefaultRouteName маршрут "все запросы", который добавляет загрузчик;
+// пользовательским маршрутам это имя недоступно
+const DefaultRouteName = "default"
+
 func Load(configPath string) (*Config, error) {
 	v := viper.New()
 
+	v.SetDefault("environment", "production")
 	v.SetDefault("port", 8080)
+	v.SetDefault("h2c", false)
 	v.SetDefault("rate_limiting.enabled", false)
 	v.SetDefault("rate_limiting.type", "inmemory")
+	v.SetDefault("rate_limiting.default.algorithm", "token_bucket")
+	v.SetDefault("rate_limiting.client_id", []string{"header:X-API-Key", "ip"})
+	v.SetDefault("rate_limiting.ipv4_prefix", 32)
+	v.SetDefault("rate_limiting.ipv6_prefix", 64)
+	v.SetDefault("rate_limiting.legacy_headers", false)
+	v.SetDefault("rate_limiting.distributed.enabled", false)
+	v.SetDefault("rate_limiting.distributed.backend", "postgres")
+	v.SetDefault("rate_limiting.distributed.mode", "strict")
+	v.SetDefault("rate_limiting.distributed.sync_interval", 100*time.Millisecond)
+	v.SetDefault("rate_limiting.distributed.timeout", 50*time.Millisecond)
+	v.SetDefault("rate_limiting.distributed.key_prefix", "ratelimit:")
+	v.SetDefault("rate_limiting.redis.addr", "localhost:6379")
+	v.SetDefault("rate_limiting.redis.pool_size", 16)
+	v.SetDefault("balancing.algorithm", "round_robin")
+	v.SetDefault("health_check.interval", 30*time.Second)
+	v.SetDefault("health_check.timeout", 3*time.Second)
+	v.SetDefault("health_check.path", "/health")
+	v.SetDefault("health_check.history_size", 1000)
+	v.SetDefault("health_check.persist", false)
+	v.SetDefault("proxy.timeout", 10*time.Second)
+	v.SetDefault("proxy.max_replay_bytes", 1<<20)
+	v.SetDefault("proxy.spool_large_bodies", false)
+	v.SetDefault("proxy.max_spool_bytes", 100<<20)
+	v.SetDefault("proxy.upgrade_idle_timeout", 5*time.Minute)
+	v.SetDefault("proxy.preserve_host", false)
+	v.SetDefault("proxy.via", "go-highload-balancer")
+	v.SetDefault("proxy.retry.max_attempts", 0)
+	v.SetDefault("proxy.retry.retry_on", []string{"connect-failure", "reset", "timeout"})
+	v.SetDefault("proxy.retry.status_codes", []int{502, 503, 504})
+	v.SetDefault("proxy.retry.grpc_status_codes", []string{"unavailable"})
+	v.SetDefault("proxy.retry.methods", []string{"GET", "HEAD", "OPTIONS", "PUT", "DELETE", "TRACE"})
+	v.SetDefault("proxy.retry.backoff_base", 25*time.Millisecond)
+	v.SetDefault("proxy.retry.backoff_max", 250*time.Millisecond)
+	v.SetDefault("proxy.retry.budget_percent", 20.0)
+	v.SetDefault("proxy.retry.budget_min_per_second", 10.0)
+	v.SetDefault("circuit_breaker.enabled", false)
+	v.SetDefault("circuit_breaker.window", 10*time.Second)
+	v.SetDefault("circuit_breaker.min_requests", 20)
+	v.SetDefault("circuit_breaker.error_rate_threshold", 50.0)
+	v.SetDefault("circuit_breaker.slow_call_duration", 2*time.Second)
+	v.SetDefault("circuit_breaker.slow_call_rate_threshold", 80.0)
+	v.SetDefault("circuit_breaker.open_duration", 30*time.Second)
+	v.SetDefault("circuit_breaker.half_open_requests", 3)
+	v.SetDefault("cache.enabled", false)
+	v.SetDefault("cache.max_bytes", 64<<20)
+	v.SetDefault("cache.max_entry_bytes", 1<<20)
+	v.SetDefault("cache.key", []string{"method", "host", "path", "query"})
+	v.SetDefault("cache.revalidate_timeout", 10*time.Second)
+	v.SetDefault("coalescing.enabled", false)
+	v.SetDefault("coalescing.key", []string{"method", "host", "path", "query"})
+	v.SetDefault("coalescing.wait_timeout", 5*time.Second)
+	v.SetDefault("coalescing.max_body_bytes", 1<<20)
+	v.SetDefault("compression.enabled", false)
+	v.SetDefault("compression.encodings", []string{"br", "zstd", "gzip"})
+	v.SetDefault("compression.content_types", []string{
+		"text/", "application/json", "application/javascript",
+		"application/xml", "application/x-ndjson", "image/svg+xml",
+	})
+	v.SetDefault("compression.min_size", 1024)
+	v.SetDefault("tls.enabled", false)
+	v.SetDefault("tls.port", 8443)
+	v.SetDefault("tls.min_version", "1.2")
+	v.SetDefault("tls.redirect_http", false)
+	v.SetDefault("proxy_protocol.enabled", false)
+	v.SetDefault("proxy_protocol.header_timeout", 5*time.Second)
+	v.SetDefault("connection_limits.default_max_connections", 0)
+	v.SetDefault("connection_limits.queue_size", 100)
+	v.SetDefault("connection_limits.queue_timeout", 5*time.Second)
 
 	v.SetConfigFile(configPath)
 	v.AutomaticEnv()
@@ -62,16 +430,367 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("invalid port number: %d", cfg.Port)
 	}
 
-	if len(cfg.Backends) == 0 {
-		return nil, fmt.Errorf("no backends specified")
+	if cfg.Proxy.MaxReplayBytes < 0 {
+		return nil, fmt.Errorf("invalid proxy.max_replay_bytes: %d", cfg.Proxy.MaxReplayBytes)
+	}
+	if cfg.Proxy.MaxSpoolBytes < 0 {
+		return nil, fmt.Errorf("invalid proxy.max_spool_bytes: %d", cfg.Proxy.MaxSpoolBytes)
+	}
+
+	for _, cond := range cfg.Proxy.Retry.RetryOn {
+		switch cond {
+		case "connect-failure", "reset", "timeout":
+		default:
+			return nil, fmt.Errorf("invalid proxy.retry.retry_on condition: %s", cond)
+		}
+	}
+
+	if d := cfg.RateLimiting.Distributed; d.Enabled {
+		if d.Backend != "postgres" && d.Backend != "redis" {
+			return nil, fmt.Errorf("invalid rate_limiting.distributed.backend: %s", d.Backend)
+		}
+		if d.Mode != "strict" && d.Mode != "sync" {
+			return nil, fmt.Errorf("invalid rate_limiting.distributed.mode: %s", d.Mode)
+		}
+		if d.SyncInterval <= 0 || d.Timeout <= 0 {
+			return nil, fmt.Errorf("rate_limiting.distributed: sync_interval and timeout must be positive")
+		}
+		// Хранилище считает все лимиты как GCRA: оконные алгоритмы
+		// молча вели бы себя иначе, чем настроено
+		if !sharedAlgorithm(cfg.RateLimiting.Default.Algorithm) {
+			return nil, fmt.Errorf("rate_limiting.distributed supports token_bucket and gcra, got rate_limiting.default.algorithm %s", cfg.RateLimiting.Default.Algorithm)
+		}
+		for _, r := range cfg.Routes {
+			if !sharedAlgorithm(r.RateLimit.Algorithm) {
+				return nil, fmt.Errorf("route %s: rate_limiting.distributed supports token_bucket and gcra, got %s", r.Name, r.RateLimit.Algorithm)
+			}
+		}
+	}
+
+	for _, r := range cfg.Routes {
+		if r.RateLimit.Capacity < 0 || r.RateLimit.Rate < 0 || r.RateLimit.Window < 0 {
+			return nil, fmt.Errorf("route %s: rate_limit must not be negative", r.Name)
+		}
+	}
+
+	if cfg.ConnectionLimits.DefaultMaxConnections < 0 || cfg.ConnectionLimits.QueueSize < 0 {
+		return nil, fmt.Errorf("connection limits must not be negative")
+	}
+
+	if err := normalizePools(&cfg); err != nil {
+		return nil, err
+	}
+	if err := normalizeTCP(&cfg); err != nil {
+		return nil, err
+	}
+	if err := normalizeUDP(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.ProxyProtocol.Enabled && len(cfg.ProxyProtocol.TrustedCIDRs) == 0 {
+		return nil, fmt.Errorf("proxy_protocol.trusted_cidrs must not be empty when PROXY protocol is enabled")
+	}
+
+	if cfg.TLS.Enabled && len(cfg.TLS.Certificates) == 0 {
+		return nil, fmt.Errorf("tls.certificates must not be empty when TLS is enabled")
 	}
 
 	return &cfg, nil
 }
 
+// normalizePools строит пул по умолчанию из корневого списка backends,
+// добавляет маршрут "все запросы" и заполняет пропущенные настройки пулов
+func normalizePools(cfg *Config) error {
+	// Бэкенды верхнего уровня образуют пул по умолчанию
+	if len(cfg.Backends) > 0 {
+		cfg.Pools = append([]PoolConfig{{
+			Name:     DefaultPoolName,
+			Backends: cfg.Backends,
+		}}, cfg.Pools...)
+	}
+	if len(cfg.Pools) == 0 {
+		return fmt.Errorf("no backends specified")
+	}
+
+	names := make(map[string]bool, len(cfg.Pools))
+	for i := range cfg.Pools {
+		pool := &cfg.Pools[i]
+		if pool.Name == "" {
+			return fmt.Errorf("pool #%d has no name", i)
+		}
+		if names[pool.Name] {
+			return fmt.Errorf("duplicate pool name: %s", pool.Name)
+		}
+		names[pool.Name] = true
+		if len(pool.Backends) == 0 {
+			return fmt.Errorf("pool %s has no backends", pool.Name)
+		}
+
+		if pool.Algorithm == "" {
+			pool.Algorithm = cfg.Balancing.Algorithm
+		}
+		if pool.HealthCheck.Interval == 0 {
+			pool.HealthCheck.Interval = cfg.HealthCheck.Interval
+		}
+		if pool.HealthCheck.Timeout == 0 {
+			pool.HealthCheck.Timeout = cfg.HealthCheck.Timeout
+		}
+		if pool.HealthCheck.Path == "" {
+			pool.HealthCheck.Path = cfg.HealthCheck.Path
+		}
+		if pool.Timeout == 0 {
+			pool.Timeout = cfg.Proxy.Timeout
+		}
+		if pool.TLS.InsecureSkipVerify && cfg.Environment != "development" {
+			return fmt.Errorf("pool %s: tls.insecure_skip_verify is allowed only in development environment", pool.Name)
+		}
+		if (pool.TLS.CertFile == "") != (pool.TLS.KeyFile == "") {
+			return fmt.Errorf("pool %s: tls.cert_file and tls.key_file must be set together", pool.Name)
+		}
+		if err := normalizeProtocol(pool); err != nil {
+			return err
+		}
+	}
+
+	// Запросы, не подошедшие ни одному маршруту, уходят в пул по умолчанию
+	for _, route := range cfg.Routes {
+		if route.Name == DefaultRouteName {
+			return fmt.Errorf("route name %s is reserved", DefaultRouteName)
+		}
+	}
+	if names[DefaultPoolName] || len(cfg.Routes) == 0 {
+		cfg.Routes = append(cfg.Routes, RouteConfig{
+			Name:     DefaultRouteName,
+			Priority: math.MinInt32,
+			Pool:     cfg.Pools[0].Name,
+		})
+	}
+	routeNames := make(map[string]bool, len(cfg.Routes))
+	for i := range cfg.Routes {
+		route := &cfg.Routes[i]
+		if routeNames[route.Name] {
+			return fmt.Errorf("duplicate route name: %s", route.Name)
+		}
+		routeNames[route.Name] = true
+
+		if err := normalizeMirror(route); err != nil {
+			return err
+		}
+		if err := normalizeHedge(route); err != nil {
+			return err
+		}
+		if route.Mirror.Pool != "" && !names[route.Mirror.Pool] {
+			return fmt.Errorf("route %s: mirror references unknown pool %s", route.Name, route.Mirror.Pool)
+		}
+
+		if len(route.Split.Variants) == 0 {
+			if !names[route.Pool] {
+				return fmt.Errorf("route %s references unknown pool %s", route.Name, route.Pool)
+			}
+			continue
+		}
+		if route.Pool != "" {
+			return fmt.Errorf("route %s: pool and split are mutually exclusive", route.Name)
+		}
+		total := 0
+		for _, v := range route.Split.Variants {
+			if !names[v.Pool] {
+				return fmt.Errorf("route %s: split references unknown pool %s", route.Name, v.Pool)
+			}
+			if v.Weight < 0 {
+				return fmt.Errorf("route %s: negative weight for pool %s", route.Name, v.Pool)
+			}
+			total += v.Weight
+		}
+		if total == 0 {
+			return fmt.Errorf("route %s: split weights sum to zero", route.Name)
+		}
+	}
+	return nil
+}
+
+// normalizeTCP проверяет TCP-листенеры и приводит бэкенды к виду tcp://host:port
+func normalizeTCP(cfg *Config) error {
+	names := make(map[string]bool, len(cfg.TCP.Listeners))
+	for i := range cfg.TCP.Listeners {
+		l := &cfg.TCP.Listeners[i]
+		if l.Name == "" {
+			return fmt.Errorf("tcp listener #%d has no name", i)
+		}
+		if names[l.Name] {
+			return fmt.Errorf("duplicate tcp listener name: %s", l.Name)
+		}
+		names[l.Name] = true
+		if l.Listen == "" {
+			return fmt.Errorf("tcp listener %s: listen address is required", l.Name)
+		}
+		if len(l.Backends) == 0 {
+			return fmt.Errorf("tcp listener %s has no backends", l.Name)
+		}
+		for j, b := range l.Backends {
+			addr := strings.TrimPrefix(b, "tcp://")
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				return fmt.Errorf("tcp listener %s: invalid backend %s: %w", l.Name, b, err)
+			}
+			l.Backends[j] = "tcp://" + addr
+		}
+
+		if l.ProxyProtocol.Accept && len(cfg.ProxyProtocol.TrustedCIDRs) == 0 {
+			return fmt.Errorf("tcp listener %s: proxy_protocol.accept requires proxy_protocol.trusted_cidrs", l.Name)
+		}
+		switch l.ProxyProtocol.Send {
+		case "", "v1", "v2":
+		default:
+			return fmt.Errorf("tcp listener %s: unknown proxy_protocol.send %q (expected v1 or v2)", l.Name, l.ProxyProtocol.Send)
+		}
+
+		if l.Algorithm == "" {
+			l.Algorithm = cfg.Balancing.Algorithm
+		}
+		if l.ConnectTimeout == 0 {
+			l.ConnectTimeout = 5 * time.Second
+		}
+		if l.IdleTimeout == 0 {
+			l.IdleTimeout = 10 * time.Minute
+		}
+		if l.HealthCheck.Interval == 0 {
+			l.HealthCheck.Interval = cfg.HealthCheck.Interval
+		}
+		if l.HealthCheck.Timeout == 0 {
+			l.HealthCheck.Timeout = cfg.HealthCheck.Timeout
+		}
+	}
+	return nil
+}
+
+// normalizeUDP проверяет UDP-листенеры и приводит бэкенды к виду udp://host:port
+func normalizeUDP(cfg *Config) error {
+	names := make(map[string]bool, len(cfg.UDP.Listeners))
+	for i := range cfg.UDP.Listeners {
+		l := &cfg.UDP.Listeners[i]
+		if l.Name == "" {
+			return fmt.Errorf("udp listener #%d has no name", i)
+		}
+		if names[l.Name] {
+			return fmt.Errorf("duplicate udp listener name: %s", l.Name)
+		}
+		names[l.Name] = true
+		if l.Listen == "" {
+			return fmt.Errorf("udp listener %s: listen address is required", l.Name)
+		}
+		if len(l.Backends) == 0 {
+			return fmt.Errorf("udp listener %s has no backends", l.Name)
+		}
+		for j, b := range l.Backends {
+			addr := strings.TrimPrefix(b, "udp://")
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				return fmt.Errorf("udp listener %s: invalid backend %s: %w", l.Name, b, err)
+			}
+			l.Backends[j] = "udp://" + addr
+		}
+		if l.MaxSessions < 0 {
+			return fmt.Errorf("udp listener %s: max_sessions must not be negative", l.Name)
+		}
+
+		if l.Algorithm == "" {
+			l.Algorithm = cfg.Balancing.Algorithm
+		}
+		if l.SessionTimeout == 0 {
+			l.SessionTimeout = time.Minute
+		}
+		if l.MaxSessions == 0 {
+			l.MaxSessions = 10000
+		}
+		if l.HealthCheck.Interval == 0 {
+			l.HealthCheck.Interval = cfg.HealthCheck.Interval
+		}
+		if l.HealthCheck.Timeout == 0 {
+			l.HealthCheck.Timeout = cfg.HealthCheck.Timeout
+		}
+	}
+	return nil
+}
+
+// normalizeProtocol проверяет протокол пула и схемы его бэкендов
+func normalizeProtocol(pool *PoolConfig) error {
+	var scheme string
+	switch pool.Protocol {
+	case "":
+		pool.Protocol = "http1"
+	case "http1":
+	case "h2":
+		scheme = "https://"
+	case "h2c":
+		scheme = "http://"
+	default:
+		return fmt.Errorf("pool %s: unknown protocol %q (expected http1, h2 or h2c)", pool.Name, pool.Protocol)
+	}
+	if scheme != "" {
+		for _, b := range pool.Backends {
+			if !strings.HasPrefix(b, scheme) {
+				return fmt.Errorf("pool %s: backend %s must use %s with protocol %s", pool.Name, b, scheme, pool.Protocol)
+			}
+		}
+	}
+
+	if pool.HTTP2.MaxConcurrentStreams < 0 {
+		return fmt.Errorf("pool %s: invalid http2.max_concurrent_streams: %d", pool.Name, pool.HTTP2.MaxConcurrentStreams)
+	}
+	if pool.HTTP2.PingInterval > 0 && pool.HTTP2.PingTimeout == 0 {
+		pool.HTTP2.PingTimeout = 15 * time.Second
+	}
+	return nil
+}
+
+func normalizeMirror(route *RouteConfig) error {
+	m := &route.Mirror
+	if m.Pool == "" {
+		return nil
+	}
+	if m.SamplePercent < 0 || m.SamplePercent > 100 {
+		return fmt.Errorf("route %s: mirror sample_percent must be within 0..100", route.Name)
+	}
+	if m.Timeout == 0 {
+		m.Timeout = 5 * time.Second
+	}
+	if m.MaxBodyBytes == 0 {
+		m.MaxBodyBytes = 64 << 10
+	}
+	if m.MaxInFlight == 0 {
+		m.MaxInFlight = 100
+	}
+	return nil
+}
+
+func normalizeHedge(route *RouteConfig) error {
+	h := &route.Hedge
+	if !h.Enabled {
+		return nil
+	}
+	if h.DelayPercentile < 0 || h.DelayPercentile > 100 {
+		return fmt.Errorf("route %s: hedge delay_percentile must be within 0..100", route.Name)
+	}
+	if h.Delay < 0 || h.MaxPercent < 0 {
+		return fmt.Errorf("route %s: hedge delay and max_percent must not be negative", route.Name)
+	}
+	if h.Delay == 0 {
+		h.Delay = 50 * time.Millisecond
+	}
+	if h.MaxPercent == 0 {
+		h.MaxPercent = 10
+	}
+	return nil
+}
+
 func GetConfigPath() string {
 	if path := os.Getenv("CONFIG_PATH"); path != "" {
 		return path
 	}
 	return filepath.Join("configs", "config.yaml")
 }
+
+// sharedAlgorithm алгоритм, который распределенный лимит считает точно;
+// пустой - наследуется от rate_limiting.default
+func sharedAlgorithm(algorithm string) bool {
+	return algorithm == "" || algorithm == "token_bucket" || algorithm == "gcra"
+}
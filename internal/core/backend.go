@@ -4,11 +4,13 @@ import (
 	"errors"
 	"net/url"
 	"sync"
+	"sync/atomic"
 )
 
 var (
 	ErrNoAvailableBackend = errors.New("no available backends")
 	ErrInvalidAlgorithm   = errors.New("invalid load balancing algorithm")
+	ErrAllBackendsBusy    = errors.New("all available backends are at max connections")
 )
 
 type Backend struct {
@@ -16,7 +18,11 @@ type Backend struct {
 	IsAlive           bool
 	Healthy           bool
 	ActiveConnections int64
-	mu                sync.RWMutex
+	// MaxConnections лимит одновременных запросов, 0 - без ограничения
+	MaxConnections int64
+	// Breaker circuit breaker бэкенда, nil - выключен
+	Breaker *CircuitBreaker
+	mu      sync.RWMutex
 }
 
 func (b *Backend) SetAlive(alive bool) {
@@ -42,3 +48,69 @@ func (b *Backend) IsHealthy() bool {
 	defer b.mu.RUnlock()
 	return b.Healthy
 }
+
+// SwapHealthy выставляет состояние здоровья и возвращает предыдущее
+func (b *Backend) SwapHealthy(healthy bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := b.Healthy
+	b.Healthy = healthy
+	return old
+}
+
+// AcceptsTraffic проверяет здоровье бэкенда и состояние circuit breaker
+func (b *Backend) AcceptsTraffic() bool {
+	return b.IsHealthy() && (b.Breaker == nil || b.Breaker.Available())
+}
+
+// AcquireCircuit резервирует запрос в circuit breaker
+func (b *Backend) AcquireCircuit() bool {
+	return b.Breaker == nil || b.Breaker.Acquire()
+}
+
+// CircuitState возвращает состояние circuit breaker
+func (b *Backend) CircuitState() BreakerState {
+	if b.Breaker == nil {
+		return BreakerClosed
+	}
+	return b.Breaker.State()
+}
+
+// TryAcquireConnection занимает слот соединения, если лимит не исчерпан
+func (b *Backend) TryAcquireConnection() bool {
+	for {
+		current := atomic.LoadInt64(&b.ActiveConnections)
+		if b.MaxConnections > 0 && current >= b.MaxConnections {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.ActiveConnections, current, current+1) {
+			return true
+		}
+	}
+}
+
+// ReleaseConnection освобождает слот соединения
+func (b *Backend) ReleaseConnection() {
+	atomic.AddInt64(&b.ActiveConnections, -1)
+}
+
+// AtCapacity сообщает, исчерпан ли лимит соединений
+func (b *Backend) AtCapacity() bool {
+	return b.MaxConnections > 0 && atomic.LoadInt64(&b.ActiveConnections) >= b.MaxConnections
+}
+
+// Reserve занимает слот соединения и запрос в circuit breaker.
+// busy=true, если бэкенд исправен, но его лимит соединений исчерпан.
+func (b *Backend) Reserve() (reserved bool, busy bool) {
+	if !b.AcceptsTraffic() {
+		return false, false
+	}
+	if !b.TryAcquireConnection() {
+		return false, true
+	}
+	if !b.AcquireCircuit() {
+		b.ReleaseConnection()
+		return false, false
+	}
+	return true, false
+}
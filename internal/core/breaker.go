@@ -0,0 +1,221 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerConfig настройки circuit breaker
+type BreakerConfig struct {
+	// Длина скользящего окна статистики (шаг - секунда)
+	Window time.Duration
+	// Минимум запросов в окне для принятия решения
+	MinRequests int64
+	// Доля ошибок в процентах, при которой цепь размыкается
+	ErrorRateThreshold float64
+	// Запрос медленнее этого порога считается медленным
+	SlowCallDuration time.Duration
+	// Доля медленных запросов в процентах, при которой цепь размыкается
+	SlowCallRateThreshold float64
+	// Сколько цепь остается разомкнутой до пробных запросов
+	OpenDuration time.Duration
+	// Количество пробных запросов в полуоткрытом состоянии
+	HalfOpenRequests int
+}
+
+type breakerBucket struct {
+	second   int64
+	total    int64
+	failures int64
+	slow     int64
+}
+
+// CircuitBreaker размыкает цепь при высокой доле ошибок или медленных ответов.
+// Пробные запросы в полуоткрытом состоянии резервируются через Acquire.
+// Результат резервирования сопровождается временем, прошедшим с Acquire:
+// по нему отличаются пробные запросы от взятых до перехода в полуоткрытое состояние.
+type CircuitBreaker struct {
+	mu         sync.Mutex
+	cfg        BreakerConfig
+	state      BreakerState
+	openedAt   time.Time
+	halfOpenAt time.Time
+	buckets    []breakerBucket
+
+	// Допущенные пробные запросы; успех слот не освобождает
+	trials    int
+	successes int
+
+	now func() time.Time // Часы; подменяются в тестах
+}
+
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	seconds := int(cfg.Window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	if cfg.HalfOpenRequests < 1 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{
+		cfg:     cfg,
+		state:   BreakerClosed,
+		buckets: make([]breakerBucket, seconds),
+		now:     time.Now,
+	}
+}
+
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.advance(cb.now())
+	return cb.state
+}
+
+// Available сообщает, можно ли сейчас отправить запрос, не резервируя его
+func (cb *CircuitBreaker) Available() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.advance(cb.now())
+
+	switch cb.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return cb.trials < cb.cfg.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// Acquire резервирует запрос; в полуоткрытом состоянии занимает пробный слот.
+// Каждый успешный Acquire завершается Record или Release.
+func (cb *CircuitBreaker) Acquire() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.advance(cb.now())
+
+	switch cb.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if cb.trials >= cb.cfg.HalfOpenRequests {
+			return false
+		}
+		cb.trials++
+	}
+	return true
+}
+
+// Release возвращает зарезервированный запрос без результата.
+// elapsed - время с момента Acquire.
+func (cb *CircuitBreaker) Release(elapsed time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+	cb.advance(now)
+	if cb.isTrial(now, elapsed) && cb.trials > 0 {
+		cb.trials--
+	}
+}
+
+// Record учитывает результат запроса; duration отсчитывается от Acquire
+func (cb *CircuitBreaker) Record(success bool, duration time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+	cb.advance(now)
+	slow := cb.cfg.SlowCallDuration > 0 && duration >= cb.cfg.SlowCallDuration
+
+	switch cb.state {
+	case BreakerHalfOpen:
+		// Запросы, взятые до полуоткрытого состояния, не решают судьбу цепи
+		if !cb.isTrial(now, duration) {
+			return
+		}
+		if !success || slow {
+			cb.open(now)
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.cfg.HalfOpenRequests {
+			cb.close()
+		}
+	case BreakerClosed:
+		bk := cb.bucket(now.Unix())
+		bk.total++
+		if !success {
+			bk.failures++
+		}
+		if slow {
+			bk.slow++
+		}
+		if cb.shouldOpen(now.Unix()) {
+			cb.open(now)
+		}
+	}
+}
+
+func (cb *CircuitBreaker) shouldOpen(now int64) bool {
+	var total, failures, slow int64
+	for _, bk := range cb.buckets {
+		if now-bk.second < int64(len(cb.buckets)) {
+			total += bk.total
+			failures += bk.failures
+			slow += bk.slow
+		}
+	}
+	if total == 0 || total < cb.cfg.MinRequests {
+		return false
+	}
+	if cb.cfg.ErrorRateThreshold > 0 && float64(failures)*100/float64(total) >= cb.cfg.ErrorRateThreshold {
+		return true
+	}
+	return cb.cfg.SlowCallRateThreshold > 0 && float64(slow)*100/float64(total) >= cb.cfg.SlowCallRateThreshold
+}
+
+// isTrial сообщает, занимал ли запрос, зарезервированный elapsed назад,
+// пробный слот текущего полуоткрытого состояния
+func (cb *CircuitBreaker) isTrial(now time.Time, elapsed time.Duration) bool {
+	return cb.state == BreakerHalfOpen && !now.Add(-elapsed).Before(cb.halfOpenAt)
+}
+
+// advance переводит разомкнутую цепь в полуоткрытую по истечении OpenDuration
+func (cb *CircuitBreaker) advance(now time.Time) {
+	if cb.state == BreakerOpen && now.Sub(cb.openedAt) >= cb.cfg.OpenDuration {
+		cb.state = BreakerHalfOpen
+		cb.halfOpenAt = now
+		cb.trials = 0
+		cb.successes = 0
+	}
+}
+
+func (cb *CircuitBreaker) open(now time.Time) {
+	cb.state = BreakerOpen
+	cb.openedAt = now
+}
+
+func (cb *CircuitBreaker) close() {
+	cb.state = BreakerClosed
+	for i := range cb.buckets {
+		cb.buckets[i] = breakerBucket{}
+	}
+}
+
+func (cb *CircuitBreaker) bucket(now int64) *breakerBucket {
+	bk := &cb.buckets[now%int64(len(cb.buckets))]
+	if bk.second != now {
+		*bk = breakerBucket{second: now}
+	}
+	return bk
+}
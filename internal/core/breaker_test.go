@@ -0,0 +1,160 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestBreaker circuit breaker с ручными часами
+func newTestBreaker(cfg BreakerConfig) (*CircuitBreaker, *time.Time) {
+	cb := NewCircuitBreaker(cfg)
+	now := time.Unix(1_700_000_000, 0)
+	cb.now = func() time.Time { return now }
+	return cb, &now
+}
+
+func expectState(t *testing.T, cb *CircuitBreaker, want BreakerState) {
+	t.Helper()
+	if got := cb.State(); got != want {
+		t.Fatalf("state %s, want %s", got, want)
+	}
+}
+
+// Ошибки, вышедшие за окно, не учитываются
+func TestBreaker_ErrorRateWindow(t *testing.T) {
+	cb, now := newTestBreaker(BreakerConfig{
+		Window:             3 * time.Second,
+		MinRequests:        4,
+		ErrorRateThreshold: 50,
+		OpenDuration:       time.Second,
+	})
+
+	cb.Record(false, 0)
+	cb.Record(false, 0)
+	*now = now.Add(3 * time.Second)
+	// Старые ошибки выпали из окна: 1 ошибка из 4 ниже порога
+	cb.Record(false, 0)
+	cb.Record(true, 0)
+	cb.Record(true, 0)
+	cb.Record(true, 0)
+	expectState(t, cb, BreakerClosed)
+
+	*now = now.Add(time.Second)
+	cb.Record(false, 0)
+	cb.Record(false, 0)
+	expectState(t, cb, BreakerOpen)
+	if cb.Acquire() {
+		t.Fatal("acquired open circuit")
+	}
+}
+
+func TestBreaker_SlowCallRate(t *testing.T) {
+	cb, _ := newTestBreaker(BreakerConfig{
+		Window:                10 * time.Second,
+		MinRequests:           4,
+		SlowCallDuration:      100 * time.Millisecond,
+		SlowCallRateThreshold: 50,
+		OpenDuration:          time.Second,
+	})
+
+	cb.Record(true, 10*time.Millisecond)
+	cb.Record(true, 10*time.Millisecond)
+	cb.Record(true, 200*time.Millisecond)
+	expectState(t, cb, BreakerClosed)
+
+	// Медленный успешный ответ тоже размыкает цепь
+	cb.Record(true, 100*time.Millisecond)
+	expectState(t, cb, BreakerOpen)
+}
+
+// В полуоткрытом состоянии допускается не больше HalfOpenRequests пробных запросов,
+// даже если часть из них уже завершилась успешно
+func TestBreaker_HalfOpenLimit(t *testing.T) {
+	cb, now := newTestBreaker(BreakerConfig{
+		Window:             10 * time.Second,
+		MinRequests:        1,
+		ErrorRateThreshold: 50,
+		OpenDuration:       time.Second,
+		HalfOpenRequests:   2,
+	})
+
+	cb.Record(false, 0)
+	expectState(t, cb, BreakerOpen)
+	*now = now.Add(time.Second)
+	expectState(t, cb, BreakerHalfOpen)
+
+	if !cb.Acquire() || !cb.Acquire() {
+		t.Fatal("trial slots not granted")
+	}
+	cb.Record(true, 0)
+	if cb.Available() || cb.Acquire() {
+		t.Fatal("third trial admitted after a successful one")
+	}
+	expectState(t, cb, BreakerHalfOpen)
+
+	cb.Record(true, 0)
+	expectState(t, cb, BreakerClosed)
+	if !cb.Acquire() {
+		t.Fatal("closed circuit rejected request")
+	}
+}
+
+// Release пробного запроса освобождает слот, неудачная проба снова размыкает цепь
+func TestBreaker_HalfOpenReleaseAndFailure(t *testing.T) {
+	cb, now := newTestBreaker(BreakerConfig{
+		Window:             10 * time.Second,
+		MinRequests:        1,
+		ErrorRateThreshold: 50,
+		OpenDuration:       time.Second,
+		HalfOpenRequests:   1,
+	})
+
+	cb.Record(false, 0)
+	*now = now.Add(time.Second)
+
+	if !cb.Acquire() || cb.Acquire() {
+		t.Fatal("want exactly one trial slot")
+	}
+	cb.Release(0)
+	if !cb.Acquire() {
+		t.Fatal("released trial slot not reusable")
+	}
+	*now = now.Add(10 * time.Millisecond)
+	cb.Record(false, 10*time.Millisecond)
+	expectState(t, cb, BreakerOpen)
+}
+
+// Запросы, зарезервированные до полуоткрытого состояния, не занимают
+// и не освобождают пробные слоты
+func TestBreaker_StaleReservations(t *testing.T) {
+	cb, now := newTestBreaker(BreakerConfig{
+		Window:             10 * time.Second,
+		MinRequests:        1,
+		ErrorRateThreshold: 50,
+		OpenDuration:       time.Second,
+		HalfOpenRequests:   1,
+	})
+
+	// Два запроса взяты в замкнутом состоянии, затем цепь разомкнулась
+	cb.Acquire()
+	cb.Acquire()
+	reserved := *now
+	cb.Record(false, 0)
+	*now = now.Add(time.Second)
+
+	if !cb.Acquire() {
+		t.Fatal("trial slot not granted")
+	}
+	cb.Release(now.Sub(reserved))
+	if cb.Acquire() {
+		t.Fatal("stale release freed the trial slot")
+	}
+	// Результат старого запроса не закрывает и не размыкает цепь
+	cb.Record(true, now.Sub(reserved))
+	expectState(t, cb, BreakerHalfOpen)
+	cb.Record(false, now.Sub(reserved))
+	expectState(t, cb, BreakerHalfOpen)
+
+	cb.Record(true, 0)
+	expectState(t, cb, BreakerClosed)
+}
@@ -0,0 +1,63 @@
+package l4
+
+import (
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/core"
+)
+
+// BackendStatus состояние бэкенда L4-листенера
+type BackendStatus struct {
+	URL               string            `json:"url"`
+	Healthy           bool              `json:"healthy"`
+	ActiveConnections int64             `json:"active_connections"`
+	CircuitState      core.BreakerState `json:"circuit_state"`
+}
+
+func backendStatuses(b interfaces.Balancer) []BackendStatus {
+	backends := b.GetAll()
+	out := make([]BackendStatus, 0, len(backends))
+	for _, be := range backends {
+		out = append(out, BackendStatus{
+			URL:               be.URL.String(),
+			Healthy:           be.IsHealthy(),
+			ActiveConnections: atomic.LoadInt64(&be.ActiveConnections),
+			CircuitState:      be.CircuitState(),
+		})
+	}
+	return out
+}
+
+func backendFor(b interfaces.Balancer, u *url.URL) *core.Backend {
+	target := u.String()
+	for _, be := range b.GetAll() {
+		if be.URL.String() == target {
+			return be
+		}
+	}
+	return nil
+}
+
+// recordOutcome сообщает circuit breaker результат подключения к бэкенду
+func recordOutcome(b interfaces.Balancer, u *url.URL, success bool, d time.Duration) {
+	if be := backendFor(b, u); be != nil && be.Breaker != nil {
+		be.Breaker.Record(success, d)
+	}
+}
+
+// releaseCircuit возвращает слот circuit breaker, если результата так и не было
+func releaseCircuit(b interfaces.Balancer, u *url.URL, d time.Duration) {
+	if be := backendFor(b, u); be != nil && be.Breaker != nil {
+		be.Breaker.Release(d)
+	}
+}
+
+// release освобождает слот соединения, занятый при выборе бэкенда
+func release(b interfaces.Balancer, u *url.URL) {
+	if tracker, ok := b.(interfaces.ConnectionTracker); ok {
+		tracker.ReleaseConnection(u.String())
+	}
+}
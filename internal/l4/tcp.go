@@ -0,0 +1,370 @@
+package l4
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/core"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxyproto"
+)
+
+// TCPConfig настройки TCP-листенера
+type TCPConfig struct {
+	Name string
+	// Адрес прослушивания, например ":5432"
+	Addr string
+	// Таймаут установки соединения с бэкендом
+	ConnectTimeout time.Duration
+	// Соединение закрывается, если данные не шли ни в одну сторону дольше
+	// этого времени; 0 - без ограничения
+	IdleTimeout time.Duration
+	// Адреса балансировщиков, от которых принимается PROXY-заголовок
+	// с адресом клиента; пусто - заголовок не ожидается
+	ProxyProtocolTrusted []*net.IPNet
+	ProxyHeaderTimeout   time.Duration
+	// Версия PROXY-заголовка для бэкендов (1 или 2); 0 - не отправлять
+	SendProxyProtocol int
+}
+
+// TCPStats счетчики TCP-листенера
+type TCPStats struct {
+	Active   int64 `json:"active"`
+	Accepted int64 `json:"accepted"`
+	// Соединения, для которых не нашлось доступного бэкенда
+	Failed int64 `json:"failed"`
+	// Байты от клиентов к бэкендам и обратно
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+}
+
+// TCPStatus состояние листенера для админки
+type TCPStatus struct {
+	Name     string          `json:"name"`
+	Listen   string          `json:"listen"`
+	Stats    TCPStats        `json:"stats"`
+	Backends []BackendStatus `json:"backends"`
+}
+
+const copyBufferSize = 32 * 1024
+
+var copyBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// TCPProxy принимает TCP-соединения и соединяет их с бэкендами,
+// выбранными балансировщиком. Одно соединение клиента - один выбор бэкенда.
+type TCPProxy struct {
+	cfg      TCPConfig
+	balancer interfaces.Balancer
+	logger   logger.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closing  bool
+	wg       sync.WaitGroup
+
+	active   atomic.Int64
+	accepted atomic.Int64
+	failed   atomic.Int64
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+func NewTCPProxy(cfg TCPConfig, b interfaces.Balancer, logger logger.Logger) *TCPProxy {
+	return &TCPProxy{
+		cfg:      cfg,
+		balancer: b,
+		logger:   logger,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Start открывает листенер и принимает соединения в фоне
+func (p *TCPProxy) Start() error {
+	l, err := net.Listen("tcp", p.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	if len(p.cfg.ProxyProtocolTrusted) > 0 {
+		l = proxyproto.NewListener(l, p.cfg.ProxyProtocolTrusted, p.cfg.ProxyHeaderTimeout)
+	}
+	p.mu.Lock()
+	p.listener = l
+	p.mu.Unlock()
+
+	p.logger.Infof("TCP listener %s started on %s", p.cfg.Name, l.Addr())
+	go p.serve(l)
+	return nil
+}
+
+// Addr адрес листенера после Start
+func (p *TCPProxy) Addr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listener == nil {
+		return nil
+	}
+	return p.listener.Addr()
+}
+
+func (p *TCPProxy) serve(l net.Listener) {
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Временные ошибки (например, исчерпаны дескрипторы) пережидаем
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else {
+				delay = min(delay*2, time.Second)
+			}
+			p.logger.Errorf("TCP listener %s accept error: %v; retrying in %v", p.cfg.Name, err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		p.mu.Lock()
+		if p.closing {
+			p.mu.Unlock()
+			conn.Close()
+			return
+		}
+		p.conns[conn] = struct{}{}
+		p.wg.Add(1)
+		p.mu.Unlock()
+
+		p.accepted.Add(1)
+		go p.handle(conn)
+	}
+}
+
+func (p *TCPProxy) track(conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closing {
+		return false
+	}
+	p.conns[conn] = struct{}{}
+	return true
+}
+
+func (p *TCPProxy) untrack(conn net.Conn) {
+	p.mu.Lock()
+	delete(p.conns, conn)
+	p.mu.Unlock()
+	conn.Close()
+}
+
+func (p *TCPProxy) handle(client net.Conn) {
+	defer p.wg.Done()
+	defer p.untrack(client)
+
+	if pc, ok := client.(*proxyproto.Conn); ok {
+		if _, err := pc.Header(); err != nil {
+			p.failed.Add(1)
+			p.logger.Warnf("TCP listener %s: invalid PROXY header from %s: %v", p.cfg.Name, pc.Conn.RemoteAddr(), err)
+			return
+		}
+	}
+
+	backend, backendURL, err := p.dial()
+	if err != nil {
+		p.failed.Add(1)
+		p.logger.Warnf("TCP listener %s: no backend for %s: %v", p.cfg.Name, client.RemoteAddr(), err)
+		return
+	}
+	defer release(p.balancer, backendURL)
+	if !p.track(backend) {
+		backend.Close()
+		return
+	}
+	defer p.untrack(backend)
+
+	if p.cfg.SendProxyProtocol > 0 {
+		if err := p.sendProxyHeader(backend, client); err != nil {
+			p.logger.Errorf("TCP listener %s: error sending PROXY header to %s: %v", p.cfg.Name, backendURL, err)
+			return
+		}
+	}
+
+	p.active.Add(1)
+	defer p.active.Add(-1)
+
+	var activity atomic.Int64
+	activity.Store(time.Now().UnixNano())
+
+	errc := make(chan error, 2)
+	go func() { errc <- p.pipe(backend, client, &activity, &p.bytesIn) }()
+	go func() { errc <- p.pipe(client, backend, &activity, &p.bytesOut) }()
+
+	// После EOF в одну сторону другая продолжает работать (half-close),
+	// при ошибке закрываются оба соединения
+	if err := <-errc; err != nil {
+		client.Close()
+		backend.Close()
+	}
+	<-errc
+}
+
+// dial подключается к бэкенду, при ошибке пробует следующий
+func (p *TCPProxy) dial() (net.Conn, *url.URL, error) {
+	lastErr := core.ErrNoAvailableBackend
+	for attempt := 0; attempt < len(p.balancer.GetAll()); attempt++ {
+		backendURL, err := p.balancer.Next(nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", backendURL.Host, p.cfg.ConnectTimeout)
+		recordOutcome(p.balancer, backendURL, err == nil, time.Since(start))
+		if err == nil {
+			return conn, backendURL, nil
+		}
+
+		p.logger.Errorf("TCP listener %s: error reaching backend %s: %v", p.cfg.Name, backendURL, err)
+		p.balancer.MarkBackendStatus(backendURL.String(), false)
+		release(p.balancer, backendURL)
+		lastErr = err
+	}
+	return nil, nil, lastErr
+}
+
+// sendProxyHeader передает бэкенду адрес клиента (реальный, если он
+// пришел в PROXY-заголовке от балансировщика перед нами)
+func (p *TCPProxy) sendProxyHeader(backend, client net.Conn) error {
+	h := &proxyproto.Header{Version: p.cfg.SendProxyProtocol}
+	if src, ok := client.RemoteAddr().(*net.TCPAddr); ok {
+		if dst, ok := client.LocalAddr().(*net.TCPAddr); ok {
+			h.Source, h.Destination = src, dst
+		}
+	}
+	raw, err := h.Format()
+	if err != nil {
+		return err
+	}
+	if p.cfg.ConnectTimeout > 0 {
+		backend.SetWriteDeadline(time.Now().Add(p.cfg.ConnectTimeout))
+		defer backend.SetWriteDeadline(time.Time{})
+	}
+	_, err = backend.Write(raw)
+	return err
+}
+
+// pipe копирует данные из src в dst. Таймаут простоя общий для обоих
+// направлений: молчащая сторона не закрывается, пока идут данные в другую.
+func (p *TCPProxy) pipe(dst, src net.Conn, activity, counter *atomic.Int64) error {
+	bufp := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(bufp)
+	buf := *bufp
+
+	idle := p.cfg.IdleTimeout
+	for {
+		if idle > 0 {
+			src.SetReadDeadline(time.Now().Add(idle))
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			activity.Store(time.Now().UnixNano())
+			counter.Add(int64(n))
+			if idle > 0 {
+				dst.SetWriteDeadline(time.Now().Add(idle))
+			}
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == nil {
+			continue
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && time.Since(time.Unix(0, activity.Load())) < idle {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			closeWrite(dst)
+			return nil
+		}
+		return err
+	}
+}
+
+// closeWrite передает EOF дальше, не закрывая соединение на чтение
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	conn.Close()
+}
+
+// Shutdown прекращает прием соединений и ждет завершения текущих.
+// По истечении ctx оставшиеся соединения закрываются принудительно.
+func (p *TCPProxy) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closing = true
+	var err error
+	if p.listener != nil {
+		err = p.listener.Close()
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		p.mu.Lock()
+		for conn := range p.conns {
+			conn.Close()
+		}
+		p.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *TCPProxy) Stats() TCPStats {
+	return TCPStats{
+		Active:   p.active.Load(),
+		Accepted: p.accepted.Load(),
+		Failed:   p.failed.Load(),
+		BytesIn:  p.bytesIn.Load(),
+		BytesOut: p.bytesOut.Load(),
+	}
+}
+
+func (p *TCPProxy) Status() TCPStatus {
+	listen := p.cfg.Addr
+	if addr := p.Addr(); addr != nil {
+		listen = addr.String()
+	}
+	return TCPStatus{
+		Name:     p.cfg.Name,
+		Listen:   listen,
+		Stats:    p.Stats(),
+		Backends: backendStatuses(p.balancer),
+	}
+}
@@ -0,0 +1,201 @@
+package l4
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/algorithms"
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxyproto"
+)
+
+type testLogger struct{}
+
+func (testLogger) Infof(format string, args ...interface{})  {}
+func (testLogger) Warnf(format string, args ...interface{})  {}
+func (testLogger) Errorf(format string, args ...interface{}) {}
+func (testLogger) Fatalf(format string, args ...interface{}) {}
+
+// tcpBackend отвечает на каждую строку своим именем и строкой,
+// после EOF от клиента дописывает "bye" и закрывает соединение
+func tcpBackend(t *testing.T, name string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sc := bufio.NewScanner(conn)
+				for sc.Scan() {
+					io.WriteString(conn, name+":"+sc.Text()+"\n")
+				}
+				io.WriteString(conn, name+":bye\n")
+			}()
+		}
+	}()
+	return "tcp://" + l.Addr().String()
+}
+
+func startTCPProxy(t *testing.T, cfg TCPConfig, backends ...string) *TCPProxy {
+	t.Helper()
+	cfg.Addr = "127.0.0.1:0"
+	if cfg.ConnectTimeout == 0 {
+		cfg.ConnectTimeout = time.Second
+	}
+	p := NewTCPProxy(cfg, algorithms.NewRoundRobinBalancer(backends, testLogger{}), testLogger{})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		p.Shutdown(ctx)
+	})
+	return p
+}
+
+// exchange отправляет строку, закрывает запись и читает ответ до EOF
+func exchange(t *testing.T, addr net.Addr, line string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	io.WriteString(conn, line+"\n")
+	// Half-close: бэкенд видит EOF, но ответ еще должен дойти
+	conn.(*net.TCPConn).CloseWrite()
+	out, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(out)
+}
+
+func TestTCPProxy_BalancesAndHalfCloses(t *testing.T) {
+	p := startTCPProxy(t, TCPConfig{Name: "test"}, tcpBackend(t, "a"), tcpBackend(t, "b"))
+
+	got := map[string]int{}
+	for i := 0; i < 4; i++ {
+		out := exchange(t, p.Addr(), "ping")
+		name, _, _ := strings.Cut(out, ":")
+		if out != name+":ping\n"+name+":bye\n" {
+			t.Fatalf("unexpected response %q", out)
+		}
+		got[name]++
+	}
+	if got["a"] != 2 || got["b"] != 2 {
+		t.Fatalf("connections per backend: %v", got)
+	}
+
+	s := p.Stats()
+	if s.Accepted != 4 || s.Failed != 0 || s.BytesIn != 4*5 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestTCPProxy_FailoverToHealthyBackend(t *testing.T) {
+	dead := "tcp://127.0.0.1:1"
+	p := startTCPProxy(t, TCPConfig{Name: "test"}, dead, tcpBackend(t, "a"))
+
+	for i := 0; i < 2; i++ {
+		if out := exchange(t, p.Addr(), "x"); out != "a:x\na:bye\n" {
+			t.Fatalf("attempt %d: got %q", i, out)
+		}
+	}
+	for _, b := range p.Status().Backends {
+		if b.URL == dead && b.Healthy {
+			t.Fatal("unreachable backend still marked healthy")
+		}
+		if b.ActiveConnections != 0 {
+			t.Fatalf("backend %s leaked %d connections", b.URL, b.ActiveConnections)
+		}
+	}
+}
+
+func TestTCPProxy_IdleTimeout(t *testing.T) {
+	p := startTCPProxy(t, TCPConfig{Name: "test", IdleTimeout: 100 * time.Millisecond}, tcpBackend(t, "a"))
+
+	conn, err := net.Dial("tcp", p.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// Пока идет обмен, соединение живет дольше таймаута простоя
+	r := bufio.NewReader(conn)
+	for i := 0; i < 4; i++ {
+		io.WriteString(conn, "ping\n")
+		if line, err := r.ReadString('\n'); err != nil || line != "a:ping\n" {
+			t.Fatalf("exchange %d: %q %v", i, line, err)
+		}
+		time.Sleep(60 * time.Millisecond)
+	}
+
+	start := time.Now()
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Fatal("expected connection to be closed after idle timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("idle connection closed after %v", elapsed)
+	}
+}
+
+func TestTCPProxy_ProxyProtocol(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+
+	// Бэкенд сам принимает PROXY-заголовок и отвечает адресом клиента
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := proxyproto.NewListener(inner, []*net.IPNet{loopback}, time.Second)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			io.WriteString(conn, conn.RemoteAddr().String()+"\n")
+			conn.Close()
+		}
+	}()
+
+	p := startTCPProxy(t, TCPConfig{
+		Name:                 "test",
+		ProxyProtocolTrusted: []*net.IPNet{loopback},
+		ProxyHeaderTimeout:   time.Second,
+		SendProxyProtocol:    2,
+	}, "tcp://"+inner.Addr().String())
+
+	// Адрес из заголовка балансировщика перед прокси доходит до бэкенда
+	// (exchange дописывает \n к строке)
+	out := exchange(t, p.Addr(), "PROXY TCP4 203.0.113.7 127.0.0.1 40000 5432\r")
+	if out != "203.0.113.7:40000\n" {
+		t.Fatalf("backend saw client %q", out)
+	}
+
+	// Без заголовка от доверенного адреса соединение отклоняется
+	if out := exchange(t, p.Addr(), "hello"); out != "" {
+		t.Fatalf("connection without PROXY header got %q", out)
+	}
+	if s := p.Stats(); s.Failed != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
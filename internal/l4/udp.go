@@ -0,0 +1,416 @@
+package l4
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/core"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+)
+
+// UDPConfig настройки UDP-листенера
+type UDPConfig struct {
+	Name string
+	// Адрес прослушивания, например ":53"
+	Addr string
+	// Сессия клиента удаляется, если датаграмм не было ни в одну сторону дольше
+	SessionTimeout time.Duration
+	// Максимум одновременных сессий; датаграммы новых клиентов сверх него отбрасываются
+	MaxSessions int
+	// Выбирать бэкенд по хешу IP клиента вместо алгоритма балансировщика
+	Hash bool
+}
+
+// UDPStats счетчики UDP-листенера
+type UDPStats struct {
+	Sessions int64 `json:"sessions"`
+	Created  int64 `json:"created"`
+	Expired  int64 `json:"expired"`
+	// Датаграммы от клиентов и ответы бэкендов
+	PacketsIn  int64 `json:"packets_in"`
+	PacketsOut int64 `json:"packets_out"`
+	// Датаграммы, для которых не нашлось сессии или бэкенда
+	Dropped int64 `json:"dropped"`
+}
+
+// UDPStatus состояние листенера для админки
+type UDPStatus struct {
+	Name     string          `json:"name"`
+	Listen   string          `json:"listen"`
+	Stats    UDPStats        `json:"stats"`
+	Backends []BackendStatus `json:"backends"`
+}
+
+// Максимальный размер датаграммы UDP
+const maxDatagramSize = 64 * 1024
+
+// Сколько датаграмм клиента копится, пока открывается сессия
+const maxPendingDatagrams = 16
+
+// UDPProxy пересылает датаграммы клиентов бэкендам. Клиент (адрес и порт)
+// закрепляется за бэкендом на время сессии, ответы бэкенда возвращаются
+// клиенту с адреса листенера.
+type UDPProxy struct {
+	cfg      UDPConfig
+	balancer interfaces.Balancer
+	logger   logger.Logger
+	resolve  func(network, addr string) (*net.UDPAddr, error) // Подменяется в тестах
+
+	mu       sync.Mutex
+	conn     *net.UDPConn
+	sessions map[string]*udpSession
+	closed   bool
+	wg       sync.WaitGroup
+
+	created    atomic.Int64
+	expired    atomic.Int64
+	packetsIn  atomic.Int64
+	packetsOut atomic.Int64
+	dropped    atomic.Int64
+}
+
+// udpSession сессия клиента. Сокет к бэкенду открывается в фоне,
+// до этого датаграммы клиента копятся в pending.
+type udpSession struct {
+	client   *net.UDPAddr
+	lastSeen atomic.Int64
+	// Результат для circuit breaker уже учтен
+	settled atomic.Bool
+
+	mu       sync.Mutex
+	backend  *url.URL
+	upstream *net.UDPConn
+	started  time.Time
+	pending  [][]byte
+	failed   bool
+}
+
+func NewUDPProxy(cfg UDPConfig, b interfaces.Balancer, logger logger.Logger) *UDPProxy {
+	return &UDPProxy{
+		cfg:      cfg,
+		balancer: b,
+		logger:   logger,
+		resolve:  net.ResolveUDPAddr,
+		sessions: make(map[string]*udpSession),
+	}
+}
+
+// Start открывает листенер и обрабатывает датаграммы в фоне
+func (p *UDPProxy) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", p.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.conn = conn
+	p.mu.Unlock()
+
+	p.logger.Infof("UDP listener %s started on %s", p.cfg.Name, conn.LocalAddr())
+	go p.serve(conn)
+	return nil
+}
+
+// Addr адрес листенера после Start
+func (p *UDPProxy) Addr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.LocalAddr()
+}
+
+func (p *UDPProxy) serve(conn *net.UDPConn) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, client, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			p.logger.Errorf("UDP listener %s read error: %v", p.cfg.Name, err)
+			continue
+		}
+		p.packetsIn.Add(1)
+
+		s := p.session(client)
+		if s == nil {
+			p.dropped.Add(1)
+			continue
+		}
+		s.lastSeen.Store(time.Now().UnixNano())
+		p.forward(s, buf[:n])
+	}
+}
+
+// forward отправляет датаграмму бэкенду сессии; пока сессия открывается,
+// датаграмма копируется в очередь
+func (p *UDPProxy) forward(s *udpSession, datagram []byte) {
+	s.mu.Lock()
+	upstream, backend := s.upstream, s.backend
+	if upstream == nil {
+		if s.failed || len(s.pending) >= maxPendingDatagrams {
+			p.dropped.Add(1)
+		} else {
+			s.pending = append(s.pending, append([]byte(nil), datagram...))
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	if _, err := upstream.Write(datagram); err != nil {
+		p.dropped.Add(1)
+		p.logger.Errorf("UDP listener %s: error sending to backend %s: %v", p.cfg.Name, backend, err)
+	}
+}
+
+// session возвращает сессию клиента, при необходимости создавая ее.
+// Бэкенд выбирается и сокет к нему открывается в фоне: медленный DNS
+// не задерживает датаграммы других клиентов.
+func (p *UDPProxy) session(client *net.UDPAddr) *udpSession {
+	key := client.String()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.sessions[key]; ok {
+		return s
+	}
+	if p.closed || (p.cfg.MaxSessions > 0 && len(p.sessions) >= p.cfg.MaxSessions) {
+		return nil
+	}
+
+	s := &udpSession{client: client}
+	p.sessions[key] = s
+	p.wg.Add(1)
+	go p.open(key, s)
+	return s
+}
+
+// open подключает сессию к бэкенду, отправляет накопленные датаграммы
+// и пересылает ответы до закрытия сессии
+func (p *UDPProxy) open(key string, s *udpSession) {
+	defer p.wg.Done()
+
+	backendURL, upstream, err := p.dial(s.client)
+	if err != nil {
+		p.logger.Warnf("UDP listener %s: no backend for %s: %v", p.cfg.Name, s.client, err)
+		p.mu.Lock()
+		if p.sessions[key] == s {
+			delete(p.sessions, key)
+		}
+		p.mu.Unlock()
+
+		s.mu.Lock()
+		s.failed = true
+		p.dropped.Add(int64(len(s.pending)))
+		s.pending = nil
+		s.mu.Unlock()
+		return
+	}
+
+	// Порядок датаграмм сохраняется: forward ждет, пока очередь отправляется
+	s.mu.Lock()
+	s.backend, s.upstream, s.started = backendURL, upstream, time.Now()
+	for _, datagram := range s.pending {
+		if _, err := upstream.Write(datagram); err != nil {
+			p.dropped.Add(1)
+			p.logger.Errorf("UDP listener %s: error sending to backend %s: %v", p.cfg.Name, backendURL, err)
+		}
+	}
+	s.pending = nil
+	s.mu.Unlock()
+
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		// Листенер закрыли, пока открывался сокет к бэкенду
+		p.closeSession(key, s)
+		return
+	}
+
+	p.created.Add(1)
+	p.relay(key, s)
+}
+
+// dial выбирает бэкенд и открывает к нему сокет, при ошибке пробует следующий
+func (p *UDPProxy) dial(client *net.UDPAddr) (*url.URL, *net.UDPConn, error) {
+	lastErr := core.ErrNoAvailableBackend
+	for attempt := 0; attempt < len(p.balancer.GetAll()); attempt++ {
+		backendURL, err := p.pick(client)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		addr, err := p.resolve("udp", backendURL.Host)
+		var upstream *net.UDPConn
+		if err == nil {
+			upstream, err = net.DialUDP("udp", nil, addr)
+		}
+		if err == nil {
+			return backendURL, upstream, nil
+		}
+
+		p.logger.Errorf("UDP listener %s: error reaching backend %s: %v", p.cfg.Name, backendURL, err)
+		recordOutcome(p.balancer, backendURL, false, 0)
+		p.balancer.MarkBackendStatus(backendURL.String(), false)
+		release(p.balancer, backendURL)
+		lastErr = err
+	}
+	return nil, nil, lastErr
+}
+
+// pick выбирает бэкенд алгоритмом балансировщика или по хешу IP клиента
+func (p *UDPProxy) pick(client *net.UDPAddr) (*url.URL, error) {
+	if !p.cfg.Hash {
+		return p.balancer.Next(nil)
+	}
+
+	// Rendezvous-хеширование: при изменении набора бэкендов переезжают
+	// только клиенты выпавшего бэкенда. Недоступный бэкенд пропускается.
+	backends := p.balancer.GetAll()
+	type scored struct {
+		backend *core.Backend
+		score   uint64
+	}
+	ranked := make([]scored, 0, len(backends))
+	for _, be := range backends {
+		h := fnv.New64a()
+		h.Write(client.IP)
+		h.Write([]byte(be.URL.String()))
+		ranked = append(ranked, scored{be, h.Sum64()})
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+
+	anyBusy := false
+	for _, r := range ranked {
+		reserved, busy := r.backend.Reserve()
+		if reserved {
+			return r.backend.URL, nil
+		}
+		anyBusy = anyBusy || busy
+	}
+	if anyBusy {
+		return nil, core.ErrAllBackendsBusy
+	}
+	return nil, core.ErrNoAvailableBackend
+}
+
+// relay возвращает ответы бэкенда клиенту и закрывает сессию по таймауту простоя
+func (p *UDPProxy) relay(key string, s *udpSession) {
+	defer p.closeSession(key, s)
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		if p.cfg.SessionTimeout > 0 {
+			s.upstream.SetReadDeadline(time.Now().Add(p.cfg.SessionTimeout))
+		}
+		n, err := s.upstream.Read(buf)
+		if err == nil {
+			s.lastSeen.Store(time.Now().UnixNano())
+			// Первый ответ подтверждает, что бэкенд жив
+			if s.settled.CompareAndSwap(false, true) {
+				recordOutcome(p.balancer, s.backend, true, time.Since(s.started))
+			}
+			if _, err := p.conn.WriteToUDP(buf[:n], s.client); err != nil {
+				p.logger.Errorf("UDP listener %s: error replying to %s: %v", p.cfg.Name, s.client, err)
+				continue
+			}
+			p.packetsOut.Add(1)
+			continue
+		}
+
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			if time.Since(time.Unix(0, s.lastSeen.Load())) < p.cfg.SessionTimeout {
+				continue
+			}
+			p.expired.Add(1)
+		case errors.Is(err, syscall.ECONNREFUSED):
+			// ICMP port unreachable: порт на бэкенде закрыт
+			p.logger.Warnf("UDP listener %s: backend %s refused datagrams", p.cfg.Name, s.backend)
+			s.settled.Store(true)
+			recordOutcome(p.balancer, s.backend, false, time.Since(s.started))
+			p.balancer.MarkBackendStatus(s.backend.String(), false)
+		case !errors.Is(err, net.ErrClosed):
+			p.logger.Errorf("UDP listener %s: error reading from backend %s: %v", p.cfg.Name, s.backend, err)
+		}
+		return
+	}
+}
+
+func (p *UDPProxy) closeSession(key string, s *udpSession) {
+	p.mu.Lock()
+	if p.sessions[key] == s {
+		delete(p.sessions, key)
+	}
+	p.mu.Unlock()
+
+	s.upstream.Close()
+	if !s.settled.Load() {
+		releaseCircuit(p.balancer, s.backend, time.Since(s.started))
+	}
+	release(p.balancer, s.backend)
+}
+
+// Close закрывает листенер и все сессии
+func (p *UDPProxy) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	var err error
+	if p.conn != nil {
+		err = p.conn.Close()
+	}
+	for _, s := range p.sessions {
+		// Сокеты открывающихся сессий закроет open
+		s.mu.Lock()
+		if s.upstream != nil {
+			s.upstream.Close()
+		}
+		s.mu.Unlock()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return err
+}
+
+func (p *UDPProxy) Stats() UDPStats {
+	p.mu.Lock()
+	sessions := len(p.sessions)
+	p.mu.Unlock()
+	return UDPStats{
+		Sessions:   int64(sessions),
+		Created:    p.created.Load(),
+		Expired:    p.expired.Load(),
+		PacketsIn:  p.packetsIn.Load(),
+		PacketsOut: p.packetsOut.Load(),
+		Dropped:    p.dropped.Load(),
+	}
+}
+
+func (p *UDPProxy) Status() UDPStatus {
+	listen := p.cfg.Addr
+	if addr := p.Addr(); addr != nil {
+		listen = addr.String()
+	}
+	return UDPStatus{
+		Name:     p.cfg.Name,
+		Listen:   listen,
+		Stats:    p.Stats(),
+		Backends: backendStatuses(p.balancer),
+	}
+}
@@ -0,0 +1,229 @@
+package l4
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/algorithms"
+)
+
+// udpBackend отвечает на каждую датаграмму своим именем и ее содержимым
+func udpBackend(t *testing.T, name string) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP([]byte(name+":"+string(buf[:n])), addr)
+		}
+	}()
+	return "udp://" + conn.LocalAddr().String()
+}
+
+func startUDPProxy(t *testing.T, cfg UDPConfig, backends ...string) *UDPProxy {
+	t.Helper()
+	cfg.Addr = "127.0.0.1:0"
+	p := NewUDPProxy(cfg, algorithms.NewRoundRobinBalancer(backends, testLogger{}), testLogger{})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func udpClient(t *testing.T, p *UDPProxy) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, p.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// ask отправляет датаграмму и возвращает имя ответившего бэкенда
+func ask(t *testing.T, conn *net.UDPConn, msg string) string {
+	t.Helper()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	name, body, _ := strings.Cut(string(buf[:n]), ":")
+	if body != msg {
+		t.Fatalf("got %q in reply to %q", buf[:n], msg)
+	}
+	return name
+}
+
+func TestUDPProxy_SessionsStickToBackend(t *testing.T) {
+	p := startUDPProxy(t, UDPConfig{Name: "test", SessionTimeout: time.Minute}, udpBackend(t, "a"), udpBackend(t, "b"))
+
+	got := map[string]int{}
+	for i := 0; i < 2; i++ {
+		conn := udpClient(t, p)
+		first := ask(t, conn, "hello")
+		for j := 0; j < 3; j++ {
+			if name := ask(t, conn, "again"); name != first {
+				t.Fatalf("client %d moved from %s to %s", i, first, name)
+			}
+		}
+		got[first]++
+	}
+	if got["a"] != 1 || got["b"] != 1 {
+		t.Fatalf("clients per backend: %v", got)
+	}
+
+	s := p.Stats()
+	if s.Sessions != 2 || s.Created != 2 || s.PacketsIn != 8 || s.PacketsOut != 8 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestUDPProxy_HashIsStable(t *testing.T) {
+	backends := []string{udpBackend(t, "a"), udpBackend(t, "b"), udpBackend(t, "c")}
+	p := startUDPProxy(t, UDPConfig{Name: "test", SessionTimeout: time.Minute, Hash: true}, backends...)
+
+	// Все клиенты с одного IP попадают на один бэкенд
+	want := ask(t, udpClient(t, p), "x")
+	for i := 0; i < 3; i++ {
+		if name := ask(t, udpClient(t, p), "x"); name != want {
+			t.Fatalf("client %d hashed to %s, want %s", i, name, want)
+		}
+	}
+}
+
+func TestUDPProxy_SessionExpires(t *testing.T) {
+	p := startUDPProxy(t, UDPConfig{Name: "test", SessionTimeout: 100 * time.Millisecond}, udpBackend(t, "a"))
+	ask(t, udpClient(t, p), "x")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Stats().Sessions != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("session not expired: %+v", p.Stats())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if s := p.Stats(); s.Expired != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	for _, b := range p.Status().Backends {
+		if b.ActiveConnections != 0 {
+			t.Fatalf("backend %s leaked %d sessions", b.URL, b.ActiveConnections)
+		}
+	}
+}
+
+func TestUDPProxy_RefusedBackendMarkedDown(t *testing.T) {
+	// Порт закрыт: ядро отвечает ICMP port unreachable
+	closed, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := "udp://" + closed.LocalAddr().String()
+	closed.Close()
+
+	p := startUDPProxy(t, UDPConfig{Name: "test", SessionTimeout: time.Minute}, dead, udpBackend(t, "a"))
+
+	// Round-robin отдает закрытый порт каждому второму клиенту,
+	// после отказа бэкенд исключается
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		udpClient(t, p).Write([]byte("x"))
+		down := false
+		for _, b := range p.Status().Backends {
+			down = down || (b.URL == dead && !b.Healthy)
+		}
+		if down {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refusing backend still marked healthy")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Сессия к закрытому порту закрыта, новые датаграммы идут на живой бэкенд
+	for i := 0; i < 2; i++ {
+		if name := ask(t, udpClient(t, p), "y"); name != "a" {
+			t.Fatalf("attempt %d: got reply from %s", i, name)
+		}
+	}
+}
+
+// Медленное разрешение адреса бэкенда не задерживает других клиентов,
+// а датаграммы ожидающего клиента уходят бэкенду после подключения
+func TestUDPProxy_SlowResolveDoesNotBlockOthers(t *testing.T) {
+	live := udpBackend(t, "a")
+	liveAddr, err := net.ResolveUDPAddr("udp", strings.TrimPrefix(live, "udp://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unblock := make(chan struct{})
+	p := NewUDPProxy(UDPConfig{Name: "test", Addr: "127.0.0.1:0", SessionTimeout: time.Minute},
+		algorithms.NewRoundRobinBalancer([]string{"udp://slow.test:9", live}, testLogger{}), testLogger{})
+	p.resolve = func(network, addr string) (*net.UDPAddr, error) {
+		if addr == "slow.test:9" {
+			<-unblock
+			return liveAddr, nil
+		}
+		return net.ResolveUDPAddr(network, addr)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	var once sync.Once
+	release := func() { once.Do(func() { close(unblock) }) }
+	t.Cleanup(release)
+
+	// Round-robin отдает одному из двух клиентов медленный бэкенд
+	replies := make(chan string, 2)
+	for _, msg := range []string{"one", "two"} {
+		conn := udpClient(t, p)
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			buf := make([]byte, 1024)
+			n, _ := conn.Read(buf)
+			replies <- string(buf[:n])
+		}()
+	}
+
+	var first string
+	select {
+	case first = <-replies:
+	case <-time.After(2 * time.Second):
+		t.Fatal("client of live backend waited for slow resolve")
+	}
+	select {
+	case r := <-replies:
+		t.Fatalf("reply %q before backend address resolved", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Датаграмма ожидающего клиента уходит бэкенду после подключения
+	release()
+	second := <-replies
+	if got := first + "," + second; got != "a:one,a:two" && got != "a:two,a:one" {
+		t.Fatalf("replies %s", got)
+	}
+}
@@ -0,0 +1,128 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestLimiter лимитер с ручными часами, выровненными по границе окна
+func newTestLimiter(t *testing.T, cfg RateConfig) (*Limiter, *time.Time) {
+	t.Helper()
+	l := NewLimiter(staticStore{}, cfg)
+	t.Cleanup(func() { l.Stop() })
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+// Общие проверки точности для всех алгоритмов: лимит 10 запросов в секунду
+func TestAlgorithms_Accuracy(t *testing.T) {
+	ctx := context.Background()
+	for _, alg := range Algorithms {
+		t.Run(string(alg), func(t *testing.T) {
+			cfg := RateConfig{Capacity: 10, Window: time.Second, Algorithm: alg}
+
+			t.Run("burst", func(t *testing.T) {
+				l, _ := newTestLimiter(t, cfg)
+				allowed := 0
+				for i := 0; i < 20; i++ {
+					d := l.Allow(ctx, "c")
+					if d.Limit != 10 {
+						t.Fatalf("limit %d", d.Limit)
+					}
+					if d.Allowed {
+						allowed++
+						if d.Remaining != int64(10-allowed) {
+							t.Fatalf("request %d: remaining %d", i, d.Remaining)
+						}
+					}
+				}
+				if allowed != 10 {
+					t.Fatalf("allowed %d of 20 simultaneous requests, want 10", allowed)
+				}
+			})
+
+			t.Run("retry after", func(t *testing.T) {
+				l, now := newTestLimiter(t, cfg)
+				for i := 0; i < 10; i++ {
+					l.Allow(ctx, "c")
+				}
+				d := l.Allow(ctx, "c")
+				if d.Allowed || d.RetryAfter <= 0 || d.RetryAfter > 2*time.Second {
+					t.Fatalf("limited decision %+v", d)
+				}
+				// Чуть раньше срока запрос еще отклоняется, в срок - проходит
+				*now = now.Add(d.RetryAfter - time.Millisecond)
+				if l.Allow(ctx, "c").Allowed {
+					t.Fatal("allowed before Retry-After")
+				}
+				*now = now.Add(time.Millisecond)
+				if !l.Allow(ctx, "c").Allowed {
+					t.Fatal("denied after Retry-After")
+				}
+			})
+
+			t.Run("sustained", func(t *testing.T) {
+				// Минута запросов с двойной скоростью: пропускается около 600
+				l, now := newTestLimiter(t, cfg)
+				var times []time.Time
+				for i := 0; i < 1200; i++ {
+					if l.Allow(ctx, "c").Allowed {
+						times = append(times, *now)
+					}
+					*now = now.Add(50 * time.Millisecond)
+				}
+				// Счетчик скользящего окна - оценка: запросы предыдущего окна
+				// считаются равномерными, и лимит выбирается не полностью
+				lowest := 590
+				if alg == SlidingWindowCounter {
+					lowest = 540
+				}
+				if n := len(times); n < lowest || n > 611 {
+					t.Fatalf("allowed %d requests in 60s, want about 600", n)
+				}
+				if alg != SlidingWindowLog {
+					return
+				}
+				// Журнал точен: ни в одной секунде нет больше 10 запросов
+				for i := 10; i < len(times); i++ {
+					if times[i].Sub(times[i-10]) < time.Second {
+						t.Fatalf("11 requests within %v", times[i].Sub(times[i-10]))
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestLimiter_ConfigChangeResetsState(t *testing.T) {
+	l, _ := newTestLimiter(t, RateConfig{Capacity: 1, Window: time.Second, Algorithm: FixedWindow})
+	ctx := context.Background()
+	l.Allow(ctx, "c")
+	if l.Allow(ctx, "c").Allowed {
+		t.Fatal("limit not applied")
+	}
+
+	// Смена алгоритма клиента применяется без перезапуска
+	l.defaultRate = RateConfig{Capacity: 5, RefillRate: 5, Algorithm: GCRA}
+	if d := l.Allow(ctx, "c"); !d.Allowed || d.Limit != 5 {
+		t.Fatalf("new config not applied: %+v", d)
+	}
+}
+
+func TestLimiter_CleanupIdleStates(t *testing.T) {
+	for _, alg := range Algorithms {
+		l, now := newTestLimiter(t, RateConfig{Capacity: 2, Window: time.Second, Algorithm: alg})
+		l.Allow(context.Background(), "c")
+		l.cleanup()
+		if _, ok := l.states.Load("c"); !ok {
+			t.Fatalf("%s: active state removed", alg)
+		}
+		*now = now.Add(3 * time.Second)
+		l.cleanup()
+		if _, ok := l.states.Load("c"); ok {
+			t.Fatalf("%s: idle state kept", alg)
+		}
+	}
+}
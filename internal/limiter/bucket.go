@@ -1,10 +1,37 @@
 package limiter
 
 import (
+	"math"
 	"sync"
 	"time"
 )
 
+// state состояние лимита одного клиента
+type state interface {
+	allow(now time.Time) Decision
+	// idle состояние вернулось к исходному, и его можно удалить
+	idle(now time.Time) bool
+}
+
+func newState(cfg RateConfig, now time.Time) state {
+	// Без скорости остается только корзина без пополнения:
+	// Capacity запросов на все время
+	if cfg.window() <= 0 {
+		return newBucket(cfg.Capacity, 0, now)
+	}
+	switch cfg.Algorithm {
+	case FixedWindow:
+		return &fixedWindow{limit: cfg.Capacity, window: cfg.window()}
+	case SlidingWindowLog:
+		return &slidingLog{limit: cfg.Capacity, window: cfg.window()}
+	case SlidingWindowCounter:
+		return &slidingCounter{limit: cfg.Capacity, window: cfg.window()}
+	case GCRA:
+		return newGCRA(cfg.Capacity, cfg.rate())
+	}
+	return newBucket(cfg.Capacity, cfg.rate(), now)
+}
+
 type bucket struct {
 	capacity   int64
 	rate       float64
@@ -13,43 +40,55 @@ type bucket struct {
 	mu         sync.Mutex
 }
 
-func newBucket(capacity int64, rate float64) *bucket {
+func newBucket(capacity int64, rate float64, now time.Time) *bucket {
 	return &bucket{
 		capacity:   capacity,
 		rate:       rate,
 		tokens:     float64(capacity),
-		lastRefill: time.Now(),
+		lastRefill: now,
 	}
 }
 
-func (b *bucket) allow(tokens int64) bool {
+func (b *bucket) allow(now time.Time) Decision {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	b.refill(now)
 
-	now := time.Now()
-	elapsed := now.Sub(b.lastRefill).Seconds()
-	b.tokens += elapsed * b.rate
-	if b.tokens > float64(b.capacity) {
-		b.tokens = float64(b.capacity)
-	}
-	b.lastRefill = now
-
-	if b.tokens >= float64(tokens) {
-		b.tokens -= float64(tokens)
-		return true
+	d := Decision{Limit: b.capacity}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = b.refillTime(1 - b.tokens)
 	}
-	return false
+	d.Remaining = int64(b.tokens)
+	d.Reset = b.refillTime(float64(b.capacity) - b.tokens)
+	return d
 }
 
-func (b *bucket) refill() {
+func (b *bucket) idle(now time.Time) bool {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	b.refill(now)
+	return b.tokens >= float64(b.capacity)
+}
 
-	now := time.Now()
+func (b *bucket) refill(now time.Time) {
 	elapsed := now.Sub(b.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
+	}
 	b.tokens += elapsed * b.rate
 	if b.tokens > float64(b.capacity) {
 		b.tokens = float64(b.capacity)
 	}
 	b.lastRefill = now
 }
+
+// refillTime за сколько накопится tokens; без пополнения - 0
+func (b *bucket) refillTime(tokens float64) time.Duration {
+	if b.rate <= 0 || tokens <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(tokens / b.rate * float64(time.Second)))
+}
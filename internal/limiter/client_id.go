@@ -0,0 +1,218 @@
+package limiter
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ClientIDFunc определяет клиента по запросу; у источника цепочки "" - не подошел
+type ClientIDFunc func(r *http.Request) string
+
+// DefaultClientID цепочка по умолчанию: API-ключ, иначе IP клиента
+var DefaultClientID = []string{"header:X-API-Key", "ip"}
+
+// ClientIDOptions настройки IP-источников цепочки
+type ClientIDOptions struct {
+	// Прокси, чьему X-Forwarded-For доверяет источник forwarded_ip
+	TrustedProxies []*net.IPNet
+	// Длина префикса, по которому группируются адреса: клиенты одной
+	// подсети делят лимит. 0 - адрес целиком.
+	IPv4Prefix int
+	IPv6Prefix int
+}
+
+// NewClientID собирает цепочку источников идентификатора; побеждает первый
+// непустой. Если ни один источник не подошел, клиент определяется по адресу
+// соединения: иначе запрос без заголовка обходил бы лимит. Значения всех
+// источников, кроме заголовков, получают префикс, чтобы, например, cookie
+// не совпала с чужим API-ключом или адресом. Источники:
+//   - header:<имя> - значение заголовка как есть, например API-ключ
+//   - bearer - "bearer:" и хеш токена из Authorization: Bearer
+//   - jwt:<claim> - "jwt:<claim>:" и claim из JWT в Authorization: Bearer.
+//     Подпись не проверяется, поэтому токен должен проверять бэкенд или шлюз
+//   - cookie:<имя> - "cookie:<имя>:" и значение cookie
+//   - forwarded_ip - "fwd:" и клиент из X-Forwarded-For, если запрос пришел от доверенного прокси
+//   - ip - "ip:" и адрес соединения без порта
+func NewClientID(sources []string, opts ClientIDOptions) (ClientIDFunc, error) {
+	if len(sources) == 0 {
+		sources = DefaultClientID
+	}
+	if opts.IPv4Prefix < 0 || opts.IPv4Prefix > 32 {
+		return nil, fmt.Errorf("invalid IPv4 prefix length %d", opts.IPv4Prefix)
+	}
+	if opts.IPv6Prefix < 0 || opts.IPv6Prefix > 128 {
+		return nil, fmt.Errorf("invalid IPv6 prefix length %d", opts.IPv6Prefix)
+	}
+
+	chain := make([]ClientIDFunc, 0, len(sources))
+	for _, s := range sources {
+		kind, name, _ := strings.Cut(s, ":")
+		switch strings.ToLower(kind) {
+		case "header":
+			if name == "" {
+				return nil, fmt.Errorf("client id source %q: header name required", s)
+			}
+			chain = append(chain, func(r *http.Request) string {
+				return r.Header.Get(name)
+			})
+		case "bearer":
+			chain = append(chain, func(r *http.Request) string {
+				token := bearerToken(r)
+				if token == "" {
+					return ""
+				}
+				// Сам токен не попадает ни в ключи лимитов, ни в логи
+				sum := sha256.Sum256([]byte(token))
+				return "bearer:" + hex.EncodeToString(sum[:16])
+			})
+		case "jwt":
+			if name == "" {
+				return nil, fmt.Errorf("client id source %q: claim name required", s)
+			}
+			chain = append(chain, prefixed("jwt:"+name+":", func(r *http.Request) string {
+				return jwtClaim(bearerToken(r), name)
+			}))
+		case "cookie":
+			if name == "" {
+				return nil, fmt.Errorf("client id source %q: cookie name required", s)
+			}
+			chain = append(chain, prefixed("cookie:"+name+":", func(r *http.Request) string {
+				if c, err := r.Cookie(name); err == nil {
+					return c.Value
+				}
+				return ""
+			}))
+		case "forwarded_ip":
+			if len(opts.TrustedProxies) == 0 {
+				return nil, fmt.Errorf("client id source %q requires trusted proxies", s)
+			}
+			chain = append(chain, prefixed("fwd:", func(r *http.Request) string {
+				return opts.group(forwardedIP(r, opts.TrustedProxies))
+			}))
+		case "ip":
+			chain = append(chain, prefixed("ip:", func(r *http.Request) string {
+				return opts.group(remoteIP(r))
+			}))
+		default:
+			return nil, fmt.Errorf("unknown client id source %q", s)
+		}
+	}
+
+	return func(r *http.Request) string {
+		for _, source := range chain {
+			if id := source(r); id != "" {
+				return id
+			}
+		}
+		if id := opts.group(remoteIP(r)); id != "" {
+			return "ip:" + id
+		}
+		return "ip:" + r.RemoteAddr
+	}, nil
+}
+
+// prefixed добавляет к непустому значению источника префикс его пространства ключей
+func prefixed(prefix string, source ClientIDFunc) ClientIDFunc {
+	return func(r *http.Request) string {
+		if id := source(r); id != "" {
+			return prefix + id
+		}
+		return ""
+	}
+}
+
+// group заменяет адрес подсетью заданной длины
+func (o ClientIDOptions) group(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		if o.IPv4Prefix == 0 || o.IPv4Prefix == 32 {
+			return v4.String()
+		}
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(o.IPv4Prefix, 32)), Mask: net.CIDRMask(o.IPv4Prefix, 32)}).String()
+	}
+	if o.IPv6Prefix == 0 || o.IPv6Prefix == 128 {
+		return ip.String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(o.IPv6Prefix, 128)), Mask: net.CIDRMask(o.IPv6Prefix, 128)}).String()
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// forwardedIP идет по X-Forwarded-For справа налево, пропуская доверенные
+// прокси. Левее первого недоверенного адреса значения мог подставить клиент.
+func forwardedIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	ip := remoteIP(r)
+	if ip == nil || !inNets(ip, trusted) {
+		return nil
+	}
+	hops := r.Header.Values("X-Forwarded-For")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addrs := strings.Split(hops[i], ",")
+		for j := len(addrs) - 1; j >= 0; j-- {
+			hop := net.ParseIP(strings.TrimSpace(addrs[j]))
+			if hop == nil {
+				return nil
+			}
+			ip = hop
+			if !inNets(hop, trusted) {
+				return hop
+			}
+		}
+	}
+	return ip
+}
+
+func inNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// jwtClaim достает строковый или числовой claim из payload токена
+func jwtClaim(token, claim string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	switch v := claims[claim].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
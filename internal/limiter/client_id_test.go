@@ -0,0 +1,112 @@
+package limiter
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func jwt(payload string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return enc([]byte(`{"alg":"none"}`)) + "." + enc([]byte(payload)) + ".sig"
+}
+
+func TestClientID_Chain(t *testing.T) {
+	_, lb, _ := net.ParseCIDR("10.0.0.0/8")
+	clientID, err := NewClientID(
+		[]string{"header:X-API-Key", "jwt:sub", "cookie:session", "forwarded_ip", "ip"},
+		ClientIDOptions{TrustedProxies: []*net.IPNet{lb}, IPv4Prefix: 24, IPv6Prefix: 64},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		remote string
+		header http.Header
+		want   string
+	}{
+		{"api key wins", "203.0.113.7:1234", http.Header{"X-Api-Key": {"key-1"}, "Authorization": {"Bearer " + jwt(`{"sub":"alice"}`)}}, "key-1"},
+		{"jwt claim", "203.0.113.7:1234", http.Header{"Authorization": {"Bearer " + jwt(`{"sub":"alice"}`)}}, "jwt:sub:alice"},
+		{"token without claim", "203.0.113.7:1234", http.Header{"Authorization": {"Bearer " + jwt(`{"iss":"x"}`)}, "Cookie": {"session=s1"}}, "cookie:session:s1"},
+		{"ip without port, grouped", "203.0.113.7:1234", nil, "ip:203.0.113.0/24"},
+		{"ipv6 grouped", "[2001:db8:1:2:3::7]:1234", nil, "ip:2001:db8:1:2::/64"},
+		{"forwarded from trusted proxy", "10.1.1.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.9, 10.2.2.2"}}, "fwd:198.51.100.0/24"},
+		{"spoofed hop left of client ignored", "10.1.1.1:1234", http.Header{"X-Forwarded-For": {"192.0.2.1, 198.51.100.9"}}, "fwd:198.51.100.0/24"},
+		{"forwarded from untrusted ignored", "203.0.113.7:1234", http.Header{"X-Forwarded-For": {"198.51.100.9"}}, "ip:203.0.113.0/24"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remote
+			for k, v := range tc.header {
+				r.Header[k] = v
+			}
+			if got := clientID(r); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// Без подходящего источника клиент определяется по адресу соединения,
+// и запрос без заголовка не обходит лимит
+func TestClientID_FallsBackToRemoteIP(t *testing.T) {
+	clientID, err := NewClientID([]string{"header:X-API-Key"}, ClientIDOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	if got := clientID(r); got != "ip:203.0.113.7" {
+		t.Fatalf("got %q, want remote IP", got)
+	}
+}
+
+// Одинаковые значения разных источников не делят лимит
+func TestClientID_SourcesDoNotCollide(t *testing.T) {
+	clientID, err := NewClientID([]string{"header:X-API-Key", "cookie:session", "ip"}, ClientIDOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKey := httptest.NewRequest(http.MethodGet, "/", nil)
+	byKey.Header.Set("X-API-Key", "203.0.113.7")
+	byCookie := httptest.NewRequest(http.MethodGet, "/", nil)
+	byCookie.Header.Set("Cookie", "session=203.0.113.7")
+	byIP := httptest.NewRequest(http.MethodGet, "/", nil)
+	byIP.RemoteAddr = "203.0.113.7:1234"
+
+	ids := map[string]bool{clientID(byKey): true, clientID(byCookie): true, clientID(byIP): true}
+	if len(ids) != 3 {
+		t.Fatalf("ids collide: %v", ids)
+	}
+	// Значение заголовка остается как есть: по нему ищутся лимиты в /api/v1/clients
+	if !ids["203.0.113.7"] {
+		t.Fatalf("header value changed: %v", ids)
+	}
+}
+
+func TestClientID_BearerIsHashed(t *testing.T) {
+	clientID, err := NewClientID([]string{"bearer"}, ClientIDOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer secret-token")
+	id := clientID(r)
+	if !strings.HasPrefix(id, "bearer:") || strings.Contains(id, "secret") {
+		t.Fatalf("unexpected id %q", id)
+	}
+}
+
+func TestClientID_InvalidSources(t *testing.T) {
+	for _, sources := range [][]string{{"header"}, {"jwt"}, {"forwarded_ip"}, {"geo"}} {
+		if _, err := NewClientID(sources, ClientIDOptions{}); err == nil {
+			t.Fatalf("%v: expected error", sources)
+		}
+	}
+}
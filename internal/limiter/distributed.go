@@ -0,0 +1,295 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+)
+
+// SharedStore состояние лимитов, общее для нескольких экземпляров
+// балансировщика. Состояние клиента - TAT алгоритма GCRA, поэтому проверка
+// запроса - одна атомарная операция над одним значением. Время запроса
+// передает экземпляр, так что часы экземпляров должны быть синхронизированы.
+type SharedStore interface {
+	// Take выполняет AdvanceTAT над значением ключа и возвращает TAT после
+	// операции и был ли он сдвинут. Ключ без значения равносилен TAT в прошлом.
+	Take(ctx context.Context, key string, now time.Time, cost, tolerance time.Duration) (time.Time, bool, error)
+	Close() error
+}
+
+// SharedOptions настройки распределенного лимита
+type SharedOptions struct {
+	// Префикс ключей в хранилище; у лимитеров маршрутов свой префикс,
+	// чтобы их корзины не смешивались с общими
+	KeyPrefix string
+	// Таймаут операции с хранилищем. При ошибке запрос проверяется
+	// локальным лимитом экземпляра.
+	Timeout time.Duration
+	// Как часто SyncedLimiter отправляет локальный учет в хранилище
+	SyncInterval time.Duration
+}
+
+const (
+	defaultSharedTimeout = 50 * time.Millisecond
+	defaultSyncInterval  = 100 * time.Millisecond
+	// Сколько ключей SyncedLimiter синхронизирует параллельно
+	syncConcurrency = 16
+	// Сколько интервалов синхронизации без запросов SyncedLimiter
+	// хранит оценку клиента, прежде чем удалить ее
+	syncIdleIntervals = 10
+)
+
+// sharedLimiter общая часть распределенных лимитеров
+type sharedLimiter struct {
+	shared      SharedStore
+	store       ConfigStore
+	defaultRate RateConfig
+	opts        SharedOptions
+	logger      logger.Logger
+	// Лимит экземпляра на время недоступности хранилища
+	fallback    *Limiter
+	unavailable atomic.Bool
+	// Часы; подменяются в тестах
+	now func() time.Time
+}
+
+func newSharedLimiter(shared SharedStore, store ConfigStore, defaultRate RateConfig, opts SharedOptions, logger logger.Logger) sharedLimiter {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultSharedTimeout
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = defaultSyncInterval
+	}
+	return sharedLimiter{
+		shared:      shared,
+		store:       store,
+		defaultRate: defaultRate,
+		opts:        opts,
+		logger:      logger,
+		fallback:    NewLimiter(store, defaultRate),
+		now:         time.Now,
+	}
+}
+
+// limit параметры GCRA для клиента. Все алгоритмы в хранилище считаются
+// как GCRA с тем же лимитом: для token_bucket это тот же результат. Оконные
+// алгоритмы конфигурация не допускает, а у персональных лимитов из API
+// они превращаются в равномерный поток со всплеском до Capacity.
+// false - лимит без пополнения, его проверяет только локальный лимитер.
+func (l *sharedLimiter) limit(ctx context.Context, clientID string) (gcraLimit, bool) {
+	config, exists, err := l.store.GetConfig(ctx, clientID)
+	if err != nil || !exists {
+		config = l.defaultRate
+	}
+	if config.Capacity <= 0 || config.rate() <= 0 {
+		return gcraLimit{}, false
+	}
+	return newGCRALimit(config.Capacity, config.rate()), true
+}
+
+// take операция с хранилищем с таймаутом; смена доступности хранилища
+// пишется в лог один раз, а не на каждый запрос
+func (l *sharedLimiter) take(ctx context.Context, key string, now time.Time, cost, tolerance time.Duration) (time.Time, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.opts.Timeout)
+	defer cancel()
+
+	tat, ok, err := l.shared.Take(ctx, l.opts.KeyPrefix+key, now, cost, tolerance)
+	if err != nil {
+		if l.unavailable.CompareAndSwap(false, true) {
+			l.logger.Warnf("Shared rate limit store unavailable, limiting locally: %v", err)
+		}
+		return tat, ok, err
+	}
+	if l.unavailable.CompareAndSwap(true, false) {
+		l.logger.Infof("Shared rate limit store is available again")
+	}
+	return tat, ok, nil
+}
+
+// DistributedLimiter проверяет каждый запрос в общем хранилище: лимит
+// точный для всех экземпляров ценой обращения к хранилищу на запрос.
+type DistributedLimiter struct {
+	sharedLimiter
+}
+
+func NewDistributedLimiter(shared SharedStore, store ConfigStore, defaultRate RateConfig, opts SharedOptions, logger logger.Logger) *DistributedLimiter {
+	return &DistributedLimiter{sharedLimiter: newSharedLimiter(shared, store, defaultRate, opts, logger)}
+}
+
+func (l *DistributedLimiter) Allow(ctx context.Context, clientID string) Decision {
+	g, ok := l.limit(ctx, clientID)
+	if !ok {
+		return l.fallback.Allow(ctx, clientID)
+	}
+	now := l.now()
+	tat, allowed, err := l.take(ctx, clientID, now, g.interval, g.tolerance)
+	if err != nil {
+		return l.fallback.Allow(ctx, clientID)
+	}
+	return g.decision(tat, now, allowed)
+}
+
+// Stop не закрывает SharedStore: он общий для лимитеров маршрутов
+func (l *DistributedLimiter) Stop() error {
+	return l.fallback.Stop()
+}
+
+// SyncedLimiter считает запросы локально и раз в SyncInterval отправляет
+// накопленное в хранилище, получая в ответ общее состояние. Запрос не ждет
+// хранилища, но за интервал синхронизации каждый экземпляр может
+// пропустить лишнее: до rate*SyncInterval запросов сверх лимита на
+// экземпляр плюс всплеск, если клиент пришел на несколько экземпляров сразу.
+type SyncedLimiter struct {
+	sharedLimiter
+	states   sync.Map
+	stopChan chan struct{}
+	done     chan struct{}
+}
+
+// syncedState локальная оценка общего TAT клиента
+type syncedState struct {
+	mu    sync.Mutex
+	limit gcraLimit
+	tat   time.Time
+	// Время запросов, разрешенных после последней синхронизации
+	pending time.Duration
+	// Были ли запросы после последней синхронизации
+	active bool
+	// Сколько синхронизаций подряд у клиента не было запросов
+	idle int
+	// Состояние удалено из кэша; запрос должен взять новое
+	dropped bool
+}
+
+func NewSyncedLimiter(shared SharedStore, store ConfigStore, defaultRate RateConfig, opts SharedOptions, logger logger.Logger) *SyncedLimiter {
+	l := &SyncedLimiter{
+		sharedLimiter: newSharedLimiter(shared, store, defaultRate, opts, logger),
+		stopChan:      make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go l.syncLoop()
+	return l
+}
+
+func (l *SyncedLimiter) Allow(ctx context.Context, clientID string) Decision {
+	g, ok := l.limit(ctx, clientID)
+	if !ok {
+		return l.fallback.Allow(ctx, clientID)
+	}
+	for {
+		now := l.now()
+		val, ok := l.states.Load(clientID)
+		if !ok {
+			// Первый запрос клиента проверяется в хранилище, и локальная
+			// оценка начинается с общего состояния. До ответа хранилища
+			// состояние заблокировано: одновременные первые запросы ждут
+			// его и проверяются локально, а не идут в хранилище сами.
+			st := &syncedState{limit: g}
+			st.mu.Lock()
+			if _, loaded := l.states.LoadOrStore(clientID, st); loaded {
+				st.mu.Unlock()
+				continue
+			}
+			tat, allowed, err := l.take(ctx, clientID, now, g.interval, g.tolerance)
+			if err != nil {
+				st.dropped = true
+				l.states.CompareAndDelete(clientID, st)
+				st.mu.Unlock()
+				return l.fallback.Allow(ctx, clientID)
+			}
+			st.tat, st.active = tat, true
+			st.mu.Unlock()
+			return g.decision(tat, now, allowed)
+		}
+
+		st := val.(*syncedState)
+		st.mu.Lock()
+		if st.dropped {
+			st.mu.Unlock()
+			continue
+		}
+		st.limit = g
+		tat, allowed := g.take(st.tat, now, g.interval)
+		st.tat = tat
+		st.active = true
+		if allowed {
+			st.pending += g.interval
+		}
+		st.mu.Unlock()
+		return g.decision(tat, now, allowed)
+	}
+}
+
+func (l *SyncedLimiter) syncLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.sync()
+		case <-l.stopChan:
+			// Разрешенное перед остановкой тоже попадает в хранилище
+			l.sync()
+			return
+		}
+	}
+}
+
+// sync отправляет локальный учет активных клиентов в хранилище. Клиент
+// удаляется из кэша, когда у него не было запросов syncIdleIntervals
+// интервалов и его TAT прошел: такая оценка не строже новой, а следующий
+// запрос прочитает хранилище заново.
+func (l *SyncedLimiter) sync() {
+	now := l.now()
+	sem := make(chan struct{}, syncConcurrency)
+	var wg sync.WaitGroup
+	l.states.Range(func(key, val interface{}) bool {
+		st := val.(*syncedState)
+		st.mu.Lock()
+		if !st.active {
+			st.idle++
+			if st.idle >= syncIdleIntervals && !now.Before(st.tat) {
+				st.dropped = true
+				l.states.CompareAndDelete(key, val)
+			}
+			st.mu.Unlock()
+			return true
+		}
+		cost := st.pending
+		st.pending, st.active, st.idle = 0, false, 0
+		st.mu.Unlock()
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			// Уже разрешенные запросы записываются без проверки
+			tat, _, err := l.take(context.Background(), key.(string), l.now(), cost, 0)
+
+			st.mu.Lock()
+			defer st.mu.Unlock()
+			if err != nil {
+				st.pending += cost
+				st.active = true
+				return
+			}
+			// Запросы, разрешенные во время синхронизации, уйдут в следующий раз
+			st.tat = tat.Add(st.pending)
+		}()
+		return true
+	})
+	wg.Wait()
+}
+
+// Stop отправляет в хранилище накопленный учет. SharedStore не
+// закрывается: он общий для лимитеров маршрутов.
+func (l *SyncedLimiter) Stop() error {
+	close(l.stopChan)
+	<-l.done
+	return l.fallback.Stop()
+}
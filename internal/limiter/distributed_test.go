@@ -0,0 +1,209 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testLogger struct{}
+
+func (testLogger) Infof(format string, args ...interface{})  {}
+func (testLogger) Warnf(format string, args ...interface{})  {}
+func (testLogger) Errorf(format string, args ...interface{}) {}
+func (testLogger) Fatalf(format string, args ...interface{}) {}
+
+// memoryShared общее хранилище экземпляров внутри теста
+type memoryShared struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+	err  error
+}
+
+func newMemoryShared() *memoryShared {
+	return &memoryShared{tats: make(map[string]time.Time)}
+}
+
+func (s *memoryShared) Take(ctx context.Context, key string, now time.Time, cost, tolerance time.Duration) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return time.Time{}, false, s.err
+	}
+	tat, ok := AdvanceTAT(s.tats[key], now, cost, tolerance)
+	s.tats[key] = tat
+	return tat, ok, nil
+}
+
+func (s *memoryShared) Close() error { return nil }
+
+// Три экземпляра с общим хранилищем вместе пропускают один лимит
+func TestDistributedLimiter_SharedAcrossInstances(t *testing.T) {
+	shared := newMemoryShared()
+	now := time.Unix(1_700_000_000, 0)
+	rate := RateConfig{Capacity: 10, RefillRate: 10}
+
+	var instances []*DistributedLimiter
+	for i := 0; i < 3; i++ {
+		l := NewDistributedLimiter(shared, staticStore{}, rate, SharedOptions{KeyPrefix: "rl:"}, testLogger{})
+		l.now = func() time.Time { return now }
+		t.Cleanup(func() { l.Stop() })
+		instances = append(instances, l)
+	}
+
+	ctx := context.Background()
+	allowed := 0
+	for i := 0; i < 30; i++ {
+		if instances[i%3].Allow(ctx, "c").Allowed {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Fatalf("allowed %d of 30, want 10", allowed)
+	}
+	if _, ok := shared.tats["rl:c"]; !ok {
+		t.Fatal("key prefix not applied")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	d := instances[1].Allow(ctx, "c")
+	if !d.Allowed || d.Remaining != 4 {
+		t.Fatalf("after refill: %+v", d)
+	}
+}
+
+func TestDistributedLimiter_FallbackToLocal(t *testing.T) {
+	shared := newMemoryShared()
+	shared.err = errors.New("connection refused")
+	l := NewDistributedLimiter(shared, staticStore{}, RateConfig{Capacity: 3, RefillRate: 1}, SharedOptions{}, testLogger{})
+	defer l.Stop()
+
+	ctx := context.Background()
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if l.Allow(ctx, "c").Allowed {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Fatalf("local limit allowed %d, want 3", allowed)
+	}
+}
+
+func TestSyncedLimiter_Sync(t *testing.T) {
+	shared := newMemoryShared()
+	now := time.Unix(1_700_000_000, 0)
+	rate := RateConfig{Capacity: 10, RefillRate: 10}
+
+	// Синхронизация только вручную
+	var instances []*SyncedLimiter
+	for i := 0; i < 3; i++ {
+		l := NewSyncedLimiter(shared, staticStore{}, rate, SharedOptions{SyncInterval: time.Hour}, testLogger{})
+		l.now = func() time.Time { return now }
+		t.Cleanup(func() { l.Stop() })
+		instances = append(instances, l)
+	}
+
+	ctx := context.Background()
+	allowed := 0
+	for i := 0; i < 60; i++ {
+		if instances[i%3].Allow(ctx, "c").Allowed {
+			allowed++
+		}
+	}
+	// До синхронизации экземпляры видят только свои запросы после первого
+	if allowed < 10 || allowed > 30 {
+		t.Fatalf("allowed %d before sync", allowed)
+	}
+
+	for _, l := range instances {
+		l.sync()
+	}
+	// Хранилище учло все разрешенные запросы
+	if ahead := shared.tats["c"].Sub(now); ahead != time.Duration(allowed)*100*time.Millisecond {
+		t.Fatalf("shared state %v ahead for %d requests", ahead, allowed)
+	}
+	for _, l := range instances {
+		if d := l.Allow(ctx, "c"); d.Allowed {
+			t.Fatalf("allowed after sync: %+v", d)
+		}
+	}
+
+	// Оценка клиента без запросов хранится, пока не прошел его TAT
+	now = now.Add(time.Second)
+	for _, l := range instances {
+		for i := 0; i < syncIdleIntervals+1; i++ {
+			l.sync()
+		}
+		if _, ok := l.states.Load("c"); !ok {
+			t.Fatal("client with future TAT dropped")
+		}
+	}
+
+	now = shared.tats["c"]
+	for _, l := range instances {
+		l.sync()
+		if _, ok := l.states.Load("c"); ok {
+			t.Fatal("inactive client kept after its TAT passed")
+		}
+	}
+}
+
+// blockingShared считает обращения к хранилищу и задерживает их до release
+type blockingShared struct {
+	*memoryShared
+	takes   atomic.Int64
+	release chan struct{}
+}
+
+func (s *blockingShared) Take(ctx context.Context, key string, now time.Time, cost, tolerance time.Duration) (time.Time, bool, error) {
+	s.takes.Add(1)
+	<-s.release
+	return s.memoryShared.Take(ctx, key, now, cost, tolerance)
+}
+
+// Одновременные первые запросы клиента обращаются к хранилищу один раз
+func TestSyncedLimiter_ConcurrentFirstRequests(t *testing.T) {
+	shared := &blockingShared{memoryShared: newMemoryShared(), release: make(chan struct{})}
+	l := NewSyncedLimiter(shared, staticStore{}, RateConfig{Capacity: 10, RefillRate: 1}, SharedOptions{SyncInterval: time.Hour, Timeout: time.Second}, testLogger{})
+	defer l.Stop()
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.Allow(context.Background(), "c").Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(shared.release)
+	wg.Wait()
+
+	if n := shared.takes.Load(); n != 1 {
+		t.Fatalf("store called %d times for concurrent first requests", n)
+	}
+	if allowed.Load() != 8 {
+		t.Fatalf("allowed %d of 8", allowed.Load())
+	}
+}
+
+func TestSyncedLimiter_StopFlushes(t *testing.T) {
+	shared := newMemoryShared()
+	l := NewSyncedLimiter(shared, staticStore{}, RateConfig{Capacity: 10, RefillRate: 1}, SharedOptions{SyncInterval: time.Hour}, testLogger{})
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		l.Allow(ctx, "c")
+	}
+	before := shared.tats["c"]
+	l.Stop()
+	if got := shared.tats["c"].Sub(before); got != 4*time.Second {
+		t.Fatalf("flushed %v, want 4 requests", got)
+	}
+}
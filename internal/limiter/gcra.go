@@ -0,0 +1,86 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// gcraLimit параметры GCRA (generic cell rate algorithm). Состояние
+// алгоритма - одно значение, теоретическое время прихода следующего
+// запроса (TAT). Запросы идут с интервалом 1/rate, опережение графика
+// допускается на limit интервалов.
+type gcraLimit struct {
+	limit     int64
+	interval  time.Duration
+	tolerance time.Duration
+}
+
+func newGCRALimit(limit int64, rate float64) gcraLimit {
+	interval := time.Duration(float64(time.Second) / rate)
+	return gcraLimit{
+		limit:     limit,
+		interval:  interval,
+		tolerance: interval * time.Duration(limit),
+	}
+}
+
+// take сдвигает tat на cost, если опережение не превысит допустимое
+func (g gcraLimit) take(tat, now time.Time, cost time.Duration) (time.Time, bool) {
+	return AdvanceTAT(tat, now, cost, g.tolerance)
+}
+
+// AdvanceTAT операция SharedStore.Take над значением TAT: сдвигает его на
+// cost от max(tat, now), если опережение после сдвига не больше tolerance.
+// tolerance 0 - сдвинуть без проверки.
+func AdvanceTAT(tat, now time.Time, cost, tolerance time.Duration) (time.Time, bool) {
+	if tat.Before(now) {
+		tat = now
+	}
+	if next := tat.Add(cost); tolerance == 0 || next.Sub(now) <= tolerance {
+		return next, true
+	}
+	return tat, false
+}
+
+// decision ответ по TAT после проверки запроса
+func (g gcraLimit) decision(tat, now time.Time, allowed bool) Decision {
+	d := Decision{Allowed: allowed, Limit: g.limit, Reset: tat.Sub(now)}
+	if d.Reset < 0 {
+		d.Reset = 0
+	}
+	if allowed {
+		if d.Reset < g.tolerance {
+			d.Remaining = int64((g.tolerance - d.Reset) / g.interval)
+		}
+	} else {
+		d.RetryAfter = d.Reset + g.interval - g.tolerance
+	}
+	return d
+}
+
+// gcra локальное состояние GCRA
+type gcra struct {
+	gcraLimit
+
+	mu  sync.Mutex
+	tat time.Time
+}
+
+func newGCRA(limit int64, rate float64) *gcra {
+	return &gcra{gcraLimit: newGCRALimit(limit, rate)}
+}
+
+func (g *gcra) allow(now time.Time) Decision {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tat, ok := g.take(g.tat, now, g.interval)
+	g.tat = tat
+	return g.decision(tat, now, ok)
+}
+
+func (g *gcra) idle(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return !g.tat.After(now)
+}
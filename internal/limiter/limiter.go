@@ -7,72 +7,111 @@ import (
 )
 
 type RateLimiter interface {
-	Allow(ctx context.Context, clientID string) bool
+	Allow(ctx context.Context, clientID string) Decision
 	Stop() error
 }
 
-type TokenBucket struct {
-	buckets     *sync.Map
+// Decision результат проверки лимита для заголовков ответа
+type Decision struct {
+	Allowed bool
+	// Лимит и сколько запросов еще можно сделать сразу
+	Limit     int64
+	Remaining int64
+	// Через сколько лимит восстановится полностью
+	Reset time.Duration
+	// Через сколько появится место для отклоненного запроса;
+	// 0 - неизвестно (лимит не восстанавливается)
+	RetryAfter time.Duration
+}
+
+// Limiter хранит состояние лимита каждого клиента. Лимит и алгоритм
+// клиента берутся из хранилища, для остальных - defaultRate.
+type Limiter struct {
+	states      *sync.Map
 	store       ConfigStore
 	stopChan    chan struct{}
 	mu          sync.RWMutex
 	defaultRate RateConfig
+	// Часы; подменяются в тестах
+	now func() time.Time
 }
 
-func NewTokenBucket(store ConfigStore, defaultRate RateConfig) *TokenBucket {
-	tb := &TokenBucket{
-		buckets:     &sync.Map{},
+// clientState состояние вместе с лимитом, по которому оно создано
+type clientState struct {
+	config RateConfig
+	state  state
+}
+
+func NewLimiter(store ConfigStore, defaultRate RateConfig) *Limiter {
+	l := &Limiter{
+		states:      &sync.Map{},
 		store:       store,
 		stopChan:    make(chan struct{}),
 		defaultRate: defaultRate,
+		now:         time.Now,
 	}
-	go tb.backgroundRefill()
-	return tb
+	go l.backgroundCleanup()
+	return l
 }
 
-func (tb *TokenBucket) Allow(ctx context.Context, clientID string) bool {
-	config, exists, err := tb.store.GetConfig(ctx, clientID)
-	if err != nil {
-		tb.mu.RLock()
-		config = tb.defaultRate
-		tb.mu.RUnlock()
-	} else if !exists {
-		config = tb.defaultRate
+func (l *Limiter) Allow(ctx context.Context, clientID string) Decision {
+	config, exists, err := l.store.GetConfig(ctx, clientID)
+	if err != nil || !exists {
+		l.mu.RLock()
+		config = l.defaultRate
+		l.mu.RUnlock()
 	}
 
-	val, _ := tb.buckets.LoadOrStore(clientID, newBucket(
-		config.Capacity,
-		config.RefillRate,
-	))
+	now := l.now()
+	return l.state(clientID, config, now).allow(now)
+}
 
-	return val.(*bucket).allow(1)
+// state возвращает состояние клиента, созданное по его текущему лимиту
+func (l *Limiter) state(clientID string, config RateConfig, now time.Time) state {
+	for {
+		val, ok := l.states.Load(clientID)
+		if !ok {
+			val, _ = l.states.LoadOrStore(clientID, &clientState{config: config, state: newState(config, now)})
+		}
+		cs := val.(*clientState)
+		if cs.config == config {
+			return cs.state
+		}
+		// Лимит клиента изменили через API: счет начинается заново
+		l.states.CompareAndSwap(clientID, cs, &clientState{config: config, state: newState(config, now)})
+	}
 }
 
-func (tb *TokenBucket) Stop() error {
-	close(tb.stopChan)
-	if storeWithCloser, ok := tb.store.(interface{ Close() error }); ok {
+func (l *Limiter) Stop() error {
+	close(l.stopChan)
+	if storeWithCloser, ok := l.store.(interface{ Close() error }); ok {
 		return storeWithCloser.Close()
 	}
 	return nil
 }
 
-func (tb *TokenBucket) backgroundRefill() {
-	ticker := time.NewTicker(1 * time.Second)
+func (l *Limiter) backgroundCleanup() {
+	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			tb.refillBuckets()
-		case <-tb.stopChan:
+			l.cleanup()
+		case <-l.stopChan:
 			return
 		}
 	}
 }
 
-func (tb *TokenBucket) refillBuckets() {
-	tb.buckets.Range(func(key, value interface{}) bool {
-		value.(*bucket).refill()
+// cleanup удаляет состояния клиентов, чей лимит полностью восстановился:
+// новое состояние для них будет таким же
+func (l *Limiter) cleanup() {
+	now := l.now()
+	l.states.Range(func(key, value interface{}) bool {
+		if value.(*clientState).state.idle(now) {
+			l.states.CompareAndDelete(key, value)
+		}
 		return true
 	})
 }
@@ -1,35 +1,106 @@
 package limiter
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func Middleware(limiter RateLimiter) func(http.Handler) http.Handler {
+// Middleware ограничивает запросы каждого клиента, определенного clientID
+func Middleware(limiter RateLimiter, clientID ClientIDFunc) func(http.Handler) http.Handler {
+	policy := Policy{Limiter: limiter, ClientID: clientID}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			clientID := getClientID(r)
-			ctx := context.Background()
-			if !limiter.Allow(ctx, clientID) {
-				respondRateLimitExceeded(w)
-				return
+			if policy.check(w, r, false) {
+				next.ServeHTTP(w, r)
 			}
-
-			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-func getClientID(r *http.Request) string {
-	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
-		return apiKey
+// Policy лимит группы запросов; Limiter nil - без ограничений
+type Policy struct {
+	Limiter  RateLimiter
+	ClientID ClientIDFunc
+}
+
+// check проверяет лимит и выставляет заголовки RateLimit-*.
+// false - клиенту уже отправлен ответ 429.
+func (p Policy) check(w http.ResponseWriter, r *http.Request, legacyHeaders bool) bool {
+	if p.Limiter == nil {
+		return true
+	}
+	d := p.Limiter.Allow(r.Context(), p.ClientID(r))
+	writeRateLimitHeaders(w.Header(), d, legacyHeaders)
+	if !d.Allowed {
+		respondRateLimitExceeded(w, d)
+		return false
+	}
+	return true
+}
+
+// RoutePolicies выбирает лимит по маршруту запроса: у маршрута может быть
+// свой лимит со своими корзинами или лимит может быть выключен
+type RoutePolicies struct {
+	Default Policy
+	Routes  map[string]Policy
+	// Route возвращает имя маршрута, который обработает запрос
+	Route func(r *http.Request) string
+	// Дублировать заголовки в X-RateLimit-* для старых клиентов
+	LegacyHeaders bool
+}
+
+// Stop останавливает лимитеры маршрутов. Default.Limiter не
+// останавливается: его останавливает сервер, которому он передан.
+func (p *RoutePolicies) Stop() error {
+	var errs []error
+	for _, policy := range p.Routes {
+		if policy.Limiter != nil && policy.Limiter != p.Default.Limiter {
+			errs = append(errs, policy.Limiter.Stop())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *RoutePolicies) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy, ok := p.Routes[p.Route(r)]
+		if !ok {
+			policy = p.Default
+		}
+		if policy.check(w, r, p.LegacyHeaders) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// writeRateLimitHeaders выставляет RateLimit-Limit, RateLimit-Remaining и
+// RateLimit-Reset (секунды до полной корзины). В X-RateLimit-Reset по
+// сложившейся практике передается Unix-время.
+func writeRateLimitHeaders(h http.Header, d Decision, legacy bool) {
+	limit := strconv.FormatInt(d.Limit, 10)
+	remaining := strconv.FormatInt(d.Remaining, 10)
+	h.Set("RateLimit-Limit", limit)
+	h.Set("RateLimit-Remaining", remaining)
+	h.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(d.Reset), 10))
+	if legacy {
+		h.Set("X-RateLimit-Limit", limit)
+		h.Set("X-RateLimit-Remaining", remaining)
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(d.Reset).Unix(), 10))
 	}
-	return r.RemoteAddr
 }
 
-func respondRateLimitExceeded(w http.ResponseWriter) {
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+func respondRateLimitExceeded(w http.ResponseWriter, d Decision) {
+	if d.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(ceilSeconds(d.RetryAfter), 10))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusTooManyRequests)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -0,0 +1,158 @@
+package limiter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countingLimiter struct {
+	limit   int
+	seen    map[string]int
+	stopped int
+}
+
+func (l *countingLimiter) Allow(ctx context.Context, clientID string) Decision {
+	l.seen[clientID]++
+	return Decision{Allowed: l.seen[clientID] <= l.limit, Limit: int64(l.limit)}
+}
+
+func (l *countingLimiter) Stop() error {
+	l.stopped++
+	return nil
+}
+
+func TestRoutePolicies(t *testing.T) {
+	byIP, _ := NewClientID([]string{"ip"}, ClientIDOptions{})
+	byKey, _ := NewClientID([]string{"header:X-API-Key"}, ClientIDOptions{})
+	global := &countingLimiter{limit: 1, seen: map[string]int{}}
+	login := &countingLimiter{limit: 2, seen: map[string]int{}}
+
+	policies := &RoutePolicies{
+		Default: Policy{Limiter: global, ClientID: byIP},
+		Routes: map[string]Policy{
+			"login":  {Limiter: login, ClientID: byKey},
+			"health": {},
+		},
+		Route: func(r *http.Request) string { return strings.TrimPrefix(r.URL.Path, "/") },
+	}
+	h := policies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	status := func(path, key string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "203.0.113.7:1234"
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Лимит по умолчанию: один запрос с IP
+	if status("/api", "") != http.StatusOK || status("/api", "") != http.StatusTooManyRequests {
+		t.Fatal("default policy not applied")
+	}
+	// У маршрута свои корзины и свой идентификатор клиента
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := status("/login", "k"); got != want {
+			t.Fatalf("login request %d: got %d, want %d", i, got, want)
+		}
+	}
+	// Без ключа клиент определяется по IP и тоже ограничивается
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := status("/login", ""); got != want {
+			t.Fatalf("login request without key %d: got %d, want %d", i, got, want)
+		}
+	}
+	// Выключенный маршрут не ограничивается
+	for i := 0; i < 3; i++ {
+		if status("/health", "") != http.StatusOK {
+			t.Fatal("request limited on disabled route")
+		}
+	}
+}
+
+func TestRoutePolicies_Stop(t *testing.T) {
+	global := &countingLimiter{}
+	login := &countingLimiter{}
+	policies := &RoutePolicies{
+		Default: Policy{Limiter: global},
+		Routes: map[string]Policy{
+			"login":  {Limiter: login},
+			"api":    {Limiter: global},
+			"health": {},
+		},
+	}
+	if err := policies.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	// Общий лимитер останавливает сервер
+	if login.stopped != 1 || global.stopped != 0 {
+		t.Fatalf("stopped login %d, default %d times", login.stopped, global.stopped)
+	}
+}
+
+// staticStore хранилище без персональных лимитов
+type staticStore struct{}
+
+func (staticStore) GetConfig(ctx context.Context, clientID string) (RateConfig, bool, error) {
+	return RateConfig{}, false, nil
+}
+func (staticStore) UpsertConfig(ctx context.Context, clientID string, config RateConfig) error {
+	return nil
+}
+func (staticStore) DeleteConfig(ctx context.Context, clientID string) error { return nil }
+func (staticStore) Close() error                                            { return nil }
+
+func TestTokenBucket_Decision(t *testing.T) {
+	tb := NewLimiter(staticStore{}, RateConfig{Capacity: 2, RefillRate: 0.5})
+	defer tb.Stop()
+	ctx := context.Background()
+
+	d := tb.Allow(ctx, "c")
+	if !d.Allowed || d.Limit != 2 || d.Remaining != 1 || d.Reset < 1900*time.Millisecond || d.Reset > 2*time.Second {
+		t.Fatalf("first request: %+v", d)
+	}
+	tb.Allow(ctx, "c")
+	d = tb.Allow(ctx, "c")
+	// Один токен накапливается за 2 секунды
+	if d.Allowed || d.Remaining != 0 || d.RetryAfter < 1900*time.Millisecond || d.RetryAfter > 2*time.Second {
+		t.Fatalf("limited request: %+v", d)
+	}
+}
+
+func TestMiddleware_Headers(t *testing.T) {
+	byIP, _ := NewClientID([]string{"ip"}, ClientIDOptions{})
+	tb := NewLimiter(staticStore{}, RateConfig{Capacity: 1, RefillRate: 0.25})
+	defer tb.Stop()
+	policies := &RoutePolicies{
+		Default:       Policy{Limiter: tb, ClientID: byIP},
+		Route:         func(r *http.Request) string { return "" },
+		LegacyHeaders: true,
+	}
+	h := policies.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+
+	w := do()
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" ||
+		w.Header().Get("RateLimit-Reset") != "4" || w.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Fatalf("allowed response: %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Retry-After") != "" {
+		t.Fatal("Retry-After on allowed response")
+	}
+
+	w = do()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "4" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("limited response: %d %v", w.Code, w.Header())
+	}
+}
@@ -24,6 +24,24 @@ type PostgresStore struct {
 }
 
 func NewPostgresStore(cfg PostgresConfig, defaultConfig limiter.RateConfig) (*PostgresStore, error) {
+	pool, err := connectPostgres(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &PostgresStore{
+		pool:          pool,
+		defaultConfig: defaultConfig,
+	}
+
+	if err := store.initSchema(); err != nil {
+		return nil, fmt.Errorf("schema initialization failed: %w", err)
+	}
+
+	return store, nil
+}
+
+func connectPostgres(cfg PostgresConfig) (*pgxpool.Pool, error) {
 	connStr := fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
@@ -38,17 +56,7 @@ func NewPostgresStore(cfg PostgresConfig, defaultConfig limiter.RateConfig) (*Po
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
-
-	store := &PostgresStore{
-		pool:          pool,
-		defaultConfig: defaultConfig,
-	}
-
-	if err := store.initSchema(); err != nil {
-		return nil, fmt.Errorf("schema initialization failed: %w", err)
-	}
-
-	return store, nil
+	return pool, nil
 }
 
 func (s *PostgresStore) initSchema() error {
@@ -65,6 +73,9 @@ func (s *PostgresStore) initSchema() error {
 		);
 		
 		CREATE INDEX IF NOT EXISTS idx_client_id ON rate_limits (client_id);
+
+		ALTER TABLE rate_limits ADD COLUMN IF NOT EXISTS algorithm TEXT NOT NULL DEFAULT '';
+		ALTER TABLE rate_limits ADD COLUMN IF NOT EXISTS window_ms BIGINT NOT NULL DEFAULT 0;
 	`
 
 	_, err := s.pool.Exec(ctx, createTableQuery)
@@ -74,33 +85,43 @@ func (s *PostgresStore) initSchema() error {
 // GetConfig возвращает конфигурацию для клиента
 func (s *PostgresStore) GetConfig(ctx context.Context, clientID string) (limiter.RateConfig, bool, error) {
 	query := `
-		SELECT capacity, refill_rate 
+		SELECT capacity, refill_rate, algorithm, window_ms
 		FROM rate_limits 
 		WHERE client_id = $1
 	`
 
-	var config limiter.RateConfig
+	var (
+		config    limiter.RateConfig
+		algorithm string
+		windowMs  int64
+	)
 	err := s.pool.QueryRow(ctx, query, clientID).Scan(
 		&config.Capacity,
 		&config.RefillRate,
+		&algorithm,
+		&windowMs,
 	)
 
 	if err != nil {
 		return s.defaultConfig, false, nil
 	}
 
+	config.Algorithm = limiter.Algorithm(algorithm)
+	config.Window = time.Duration(windowMs) * time.Millisecond
 	return config, true, nil
 }
 
 // UpdateConfig обновляет конфигурацию
 func (s *PostgresStore) UpsertConfig(ctx context.Context, clientID string, config limiter.RateConfig) error {
 	query := `
-		INSERT INTO rate_limits (client_id, capacity, refill_rate)
-		VALUES ($1, $2, $3)
+		INSERT INTO rate_limits (client_id, capacity, refill_rate, algorithm, window_ms)
+		VALUES ($1, $2, $3, $4, $5)
 		ON CONFLICT (client_id) 
 		DO UPDATE SET 
 			capacity = EXCLUDED.capacity,
 			refill_rate = EXCLUDED.refill_rate,
+			algorithm = EXCLUDED.algorithm,
+			window_ms = EXCLUDED.window_ms,
 			updated_at = NOW()
 	`
 
@@ -108,6 +129,8 @@ func (s *PostgresStore) UpsertConfig(ctx context.Context, clientID string, confi
 		clientID,
 		config.Capacity,
 		config.RefillRate,
+		string(config.Algorithm),
+		config.Window.Milliseconds(),
 	)
 
 	return err
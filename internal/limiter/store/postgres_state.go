@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+)
+
+// PostgresStateStore общее состояние распределенного лимита в Postgres.
+// Take - один upsert: конфликтующая строка блокируется на время
+// обновления, так что запросы экземпляров к одному клиенту выполняются
+// по очереди без отдельных блокировок.
+type PostgresStateStore struct {
+	pool     *pgxpool.Pool
+	logger   logger.Logger
+	stopChan chan struct{}
+}
+
+func NewPostgresStateStore(cfg PostgresConfig, logger logger.Logger) (*PostgresStateStore, error) {
+	pool, err := connectPostgres(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &PostgresStateStore{
+		pool:     pool,
+		logger:   logger,
+		stopChan: make(chan struct{}),
+	}
+	if err := s.initSchema(); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("schema initialization failed: %w", err)
+	}
+	go s.backgroundCleanup()
+	return s, nil
+}
+
+func (s *PostgresStateStore) initSchema() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// tat_us - TAT в микросекундах Unix-времени
+	_, err := s.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS rate_limit_state (
+			key TEXT PRIMARY KEY,
+			tat_us BIGINT NOT NULL
+		);
+	`)
+	return err
+}
+
+// Take сдвигает TAT ключа, если опережение не превысит tolerance.
+// Отклоненный запрос строку не меняет, и upsert ничего не возвращает.
+func (s *PostgresStateStore) Take(ctx context.Context, key string, now time.Time, cost, tolerance time.Duration) (time.Time, bool, error) {
+	query := `
+		INSERT INTO rate_limit_state AS s (key, tat_us)
+		SELECT $1, $2::bigint + $3::bigint
+		WHERE $4::bigint = 0 OR $3::bigint <= $4::bigint
+		ON CONFLICT (key) DO UPDATE
+		SET tat_us = GREATEST(s.tat_us, $2::bigint) + $3::bigint
+		WHERE $4::bigint = 0 OR GREATEST(s.tat_us, $2::bigint) + $3::bigint - $2::bigint <= $4::bigint
+		RETURNING tat_us
+	`
+
+	nowUs := now.UnixMicro()
+	var tatUs int64
+	err := s.pool.QueryRow(ctx, query, key, nowUs, cost.Microseconds(), tolerance.Microseconds()).Scan(&tatUs)
+	if err == nil {
+		return time.UnixMicro(tatUs), true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, false, err
+	}
+
+	// Запрос отклонен: текущий TAT нужен для Retry-After
+	err = s.pool.QueryRow(ctx, `SELECT tat_us FROM rate_limit_state WHERE key = $1`, key).Scan(&tatUs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return now, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if tatUs < nowUs {
+		tatUs = nowUs
+	}
+	return time.UnixMicro(tatUs), false, nil
+}
+
+// backgroundCleanup удаляет ключи с TAT в прошлом: отсутствие ключа
+// означает то же самое
+func (s *PostgresStateStore) backgroundCleanup() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			_, err := s.pool.Exec(ctx, `DELETE FROM rate_limit_state WHERE tat_us < $1`, time.Now().UnixMicro())
+			cancel()
+			if err != nil {
+				s.logger.Errorf("Failed to clean up rate limit state: %v", err)
+			}
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+func (s *PostgresStateStore) Close() error {
+	close(s.stopChan)
+	s.pool.Close()
+	return nil
+}
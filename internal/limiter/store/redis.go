@@ -0,0 +1,255 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/limiter"
+)
+
+// RedisConfig подключение к Redis или совместимому серверу
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	// Сколько простаивающих соединений держать открытыми
+	PoolSize    int
+	DialTimeout time.Duration
+}
+
+// RedisStateStore общее состояние распределенного лимита в Redis.
+// Take - оптимистичная транзакция WATCH/GET, MULTI/SET/EXEC: если ключ
+// изменил другой экземпляр, EXEC не выполняется и попытка повторяется.
+// Ключи живут до TAT и удаляются сервером.
+type RedisStateStore struct {
+	cfg  RedisConfig
+	idle chan *redisConn
+}
+
+// Сколько раз повторять транзакцию при конкурентных изменениях ключа
+const redisMaxAttempts = 100
+
+var errRedisContention = errors.New("redis: too many concurrent updates")
+
+func NewRedisStateStore(cfg RedisConfig) (*RedisStateStore, error) {
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 16
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	s := &RedisStateStore{cfg: cfg, idle: make(chan *redisConn, cfg.PoolSize)}
+
+	// Проверка адреса и пароля при запуске
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DialTimeout)
+	defer cancel()
+	conn, err := s.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to redis: %w", err)
+	}
+	s.put(conn)
+	return s, nil
+}
+
+func (s *RedisStateStore) Take(ctx context.Context, key string, now time.Time, cost, tolerance time.Duration) (time.Time, bool, error) {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer s.put(conn)
+
+	for attempt := 0; attempt < redisMaxAttempts; attempt++ {
+		replies, err := conn.pipeline(ctx, []string{"WATCH", key}, []string{"GET", key})
+		if err != nil {
+			// WATCH мог остаться активным: такое соединение в пул не возвращается
+			conn.broken = true
+			return time.Time{}, false, err
+		}
+		var tat time.Time
+		if v, ok := replies[1].([]byte); ok {
+			us, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				conn.pipeline(ctx, []string{"UNWATCH"})
+				return time.Time{}, false, fmt.Errorf("redis: invalid state of %s: %q", key, v)
+			}
+			tat = time.UnixMicro(us)
+		}
+
+		next, ok := limiter.AdvanceTAT(tat, now, cost, tolerance)
+		if !ok {
+			if _, err := conn.pipeline(ctx, []string{"UNWATCH"}); err != nil {
+				return time.Time{}, false, err
+			}
+			return next, false, nil
+		}
+
+		ttl := next.Sub(now).Milliseconds() + 1
+		replies, err = conn.pipeline(ctx,
+			[]string{"MULTI"},
+			[]string{"SET", key, strconv.FormatInt(next.UnixMicro(), 10), "PX", strconv.FormatInt(ttl, 10)},
+			[]string{"EXEC"},
+		)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		// Пустой ответ EXEC - ключ изменился после WATCH
+		if replies[2] != nil {
+			return next, true, nil
+		}
+	}
+	return time.Time{}, false, errRedisContention
+}
+
+func (s *RedisStateStore) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: s.cfg.DialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if s.cfg.Password != "" {
+		if _, err := conn.pipeline(ctx, []string{"AUTH", s.cfg.Password}); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	if s.cfg.DB != 0 {
+		if _, err := conn.pipeline(ctx, []string{"SELECT", strconv.Itoa(s.cfg.DB)}); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// put возвращает соединение в пул; сломанное или лишнее закрывается
+func (s *RedisStateStore) put(conn *redisConn) {
+	if conn.broken {
+		conn.conn.Close()
+		return
+	}
+	select {
+	case s.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+func (s *RedisStateStore) Close() error {
+	for {
+		select {
+		case conn := <-s.idle:
+			conn.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// redisError ответ сервера с ошибкой; соединение после него исправно
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// redisConn соединение по протоколу RESP
+type redisConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	broken bool
+}
+
+// pipeline отправляет команды одним пакетом и читает ответы на все.
+// Ответы: string, int64, []byte, []interface{} или nil.
+func (c *redisConn) pipeline(ctx context.Context, cmds ...[]string) ([]interface{}, error) {
+	// Без дедлайна в ctx сбрасывается дедлайн прошлой операции
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+
+	for _, args := range cmds {
+		fmt.Fprintf(c.w, "*%d\r\n", len(args))
+		for _, a := range args {
+			fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(a), a)
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		c.broken = true
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	var firstErr error
+	for i := range cmds {
+		reply, err := readReply(c.r)
+		var redisErr redisError
+		if err != nil && !errors.As(err, &redisErr) {
+			c.broken = true
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			// Ошибки внутри ответа EXEC относятся к отдельным командам
+			if items[i], err = readReply(r); err != nil {
+				var redisErr redisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				items[i] = redisErr
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeRedis сервер RESP в процессе теста с командами, которые использует
+// RedisStateStore: AUTH, SELECT, PING, GET, SET [PX], DEL, WATCH, UNWATCH,
+// MULTI, EXEC, DISCARD. GET ключа из wrongType отвечает ошибкой WRONGTYPE.
+type fakeRedis struct {
+	password string
+	ln       net.Listener
+	// Сколько соединений принял сервер
+	accepted atomic.Int64
+
+	mu        sync.Mutex
+	data      map[string]fakeValue
+	version   map[string]int64
+	wrongType map[string]bool
+}
+
+type fakeValue struct {
+	value    string
+	expireAt time.Time
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		password:  password,
+		ln:        ln,
+		data:      make(map[string]fakeValue),
+		version:   make(map[string]int64),
+		wrongType: make(map[string]bool),
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.accepted.Add(1)
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) addr() string { return f.ln.Addr().String() }
+
+// fakeSession состояние соединения
+type fakeSession struct {
+	authed  bool
+	watched map[string]int64
+	queue   [][]string
+	inMulti bool
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	s := &fakeSession{authed: f.password == "", watched: make(map[string]int64)}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.handle(w, s, args)
+		if r.Buffered() == 0 {
+			w.Flush()
+		}
+	}
+}
+
+func (f *fakeRedis) handle(w *bufio.Writer, s *fakeSession, args []string) {
+	cmd := strings.ToUpper(args[0])
+	if !s.authed && cmd != "AUTH" {
+		io.WriteString(w, "-NOAUTH Authentication required.\r\n")
+		return
+	}
+	if s.inMulti && cmd != "EXEC" && cmd != "DISCARD" && cmd != "MULTI" {
+		s.queue = append(s.queue, args)
+		io.WriteString(w, "+QUEUED\r\n")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch cmd {
+	case "AUTH":
+		if len(args) != 2 || args[1] != f.password {
+			io.WriteString(w, "-WRONGPASS invalid password\r\n")
+			return
+		}
+		s.authed = true
+		io.WriteString(w, "+OK\r\n")
+	case "WATCH":
+		for _, key := range args[1:] {
+			s.watched[key] = f.version[key]
+		}
+		io.WriteString(w, "+OK\r\n")
+	case "UNWATCH":
+		s.watched = make(map[string]int64)
+		io.WriteString(w, "+OK\r\n")
+	case "MULTI":
+		s.inMulti, s.queue = true, nil
+		io.WriteString(w, "+OK\r\n")
+	case "DISCARD":
+		s.inMulti, s.queue = false, nil
+		s.watched = make(map[string]int64)
+		io.WriteString(w, "+OK\r\n")
+	case "EXEC":
+		queue, watched := s.queue, s.watched
+		s.inMulti, s.queue, s.watched = false, nil, make(map[string]int64)
+		for key, v := range watched {
+			if f.version[key] != v {
+				io.WriteString(w, "*-1\r\n")
+				return
+			}
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(queue))
+		for _, q := range queue {
+			f.exec(w, q)
+		}
+	default:
+		f.exec(w, args)
+	}
+}
+
+// exec выполняет команду данных под f.mu
+func (f *fakeRedis) exec(w *bufio.Writer, args []string) {
+	switch strings.ToUpper(args[0]) {
+	case "PING", "SELECT":
+		io.WriteString(w, "+OK\r\n")
+	case "GET":
+		if f.wrongType[args[1]] {
+			io.WriteString(w, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+			return
+		}
+		v, ok := f.data[args[1]]
+		if !ok || (!v.expireAt.IsZero() && time.Now().After(v.expireAt)) {
+			io.WriteString(w, "$-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v.value), v.value)
+	case "SET":
+		v := fakeValue{value: args[2]}
+		if len(args) == 5 && strings.EqualFold(args[3], "PX") {
+			ms, err := strconv.ParseInt(args[4], 10, 64)
+			if err != nil || ms <= 0 {
+				io.WriteString(w, "-ERR invalid expire time\r\n")
+				return
+			}
+			v.expireAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		f.data[args[1]] = v
+		f.version[args[1]]++
+		io.WriteString(w, "+OK\r\n")
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := f.data[key]; ok {
+				delete(f.data, key)
+				f.version[key]++
+				n++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", n)
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad command header %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
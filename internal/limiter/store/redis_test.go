@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/limiter"
+)
+
+type testLogger struct{}
+
+func (testLogger) Infof(format string, args ...interface{})  {}
+func (testLogger) Warnf(format string, args ...interface{})  {}
+func (testLogger) Errorf(format string, args ...interface{}) {}
+func (testLogger) Fatalf(format string, args ...interface{}) {}
+
+func TestRedisStateStore_Take(t *testing.T) {
+	fake := newFakeRedis(t, "secret")
+	if _, err := NewRedisStateStore(RedisConfig{Addr: fake.addr(), Password: "wrong"}); err == nil {
+		t.Fatal("connected with wrong password")
+	}
+	s, err := NewRedisStateStore(RedisConfig{Addr: fake.addr(), Password: "secret", DB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	// Состояние хранится с точностью до микросекунды
+	now := time.Now().Truncate(time.Microsecond)
+	for i := 1; i <= 10; i++ {
+		tat, ok, err := s.Take(ctx, "c", now, 100*time.Millisecond, time.Second)
+		if err != nil || !ok || tat.Sub(now) != time.Duration(i)*100*time.Millisecond {
+			t.Fatalf("request %d: %v %v %v", i, tat.Sub(now), ok, err)
+		}
+	}
+	tat, ok, err := s.Take(ctx, "c", now, 100*time.Millisecond, time.Second)
+	if err != nil || ok || tat.Sub(now) != time.Second {
+		t.Fatalf("over limit: %v %v %v", tat.Sub(now), ok, err)
+	}
+
+	// Без проверки сдвиг выполняется и сверх лимита
+	tat, ok, err = s.Take(ctx, "c", now, time.Second, 0)
+	if err != nil || !ok || tat.Sub(now) != 2*time.Second {
+		t.Fatalf("forced: %v %v %v", tat.Sub(now), ok, err)
+	}
+}
+
+// Соединение с ошибкой после WATCH не возвращается в пул
+func TestRedisStateStore_DropsConnOnWatchError(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	fake.wrongType["h"] = true
+	s, err := NewRedisStateStore(RedisConfig{Addr: fake.addr(), PoolSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+	if _, _, err := s.Take(ctx, "h", now, time.Second, time.Second); err == nil {
+		t.Fatal("expected WRONGTYPE error")
+	}
+	before := fake.accepted.Load()
+	if _, ok, err := s.Take(ctx, "c", now, time.Second, time.Second); err != nil || !ok {
+		t.Fatalf("take after error: %v %v", ok, err)
+	}
+	if fake.accepted.Load() != before+1 {
+		t.Fatal("connection with active WATCH was reused")
+	}
+}
+
+// Экземпляры со своими соединениями вместе пропускают ровно лимит
+func TestRedisStateStore_DistributedLimiter(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	rate := limiter.RateConfig{Capacity: 20, RefillRate: 1}
+
+	var instances []*limiter.DistributedLimiter
+	for i := 0; i < 3; i++ {
+		s, err := NewRedisStateStore(RedisConfig{Addr: fake.addr(), PoolSize: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		l := limiter.NewDistributedLimiter(s, NewInMemoryStore(rate), rate, limiter.SharedOptions{Timeout: 5 * time.Second}, testLogger{})
+		t.Cleanup(func() { l.Stop() })
+		instances = append(instances, l)
+	}
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 60; i++ {
+		wg.Add(1)
+		go func(l *limiter.DistributedLimiter) {
+			defer wg.Done()
+			if l.Allow(context.Background(), "c").Allowed {
+				allowed.Add(1)
+			}
+		}(instances[i%3])
+	}
+	wg.Wait()
+	// Время запросы берут до обращения к хранилищу, и запрос с более
+	// ранним временем может прийти последним и не попасть в лимит. Сверх
+	// лимита за время теста может накопиться еще один запрос.
+	if n := allowed.Load(); n < 15 || n > 21 {
+		t.Fatalf("allowed %d of 60, want 20", n)
+	}
+}
@@ -1,10 +1,77 @@
 package limiter
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
+// Algorithm алгоритм ограничения
+type Algorithm string
+
+const (
+	// TokenBucket корзина емкостью Capacity, пополняемая со скоростью RefillRate
+	TokenBucket Algorithm = "token_bucket"
+	// FixedWindow не больше Capacity запросов в окне, окна выровнены по времени
+	FixedWindow Algorithm = "fixed_window"
+	// SlidingWindowLog точный учет: не больше Capacity запросов за любые Window
+	SlidingWindowLog Algorithm = "sliding_window_log"
+	// SlidingWindowCounter оценка скользящего окна по счетчикам двух фиксированных
+	SlidingWindowCounter Algorithm = "sliding_window_counter"
+	// GCRA равномерный поток со всплеском до Capacity запросов
+	GCRA Algorithm = "gcra"
+)
+
+// Algorithms поддерживаемые алгоритмы
+var Algorithms = []Algorithm{TokenBucket, FixedWindow, SlidingWindowLog, SlidingWindowCounter, GCRA}
+
+// RateConfig лимит клиента. Скорость задается либо RefillRate (запросов
+// в секунду), либо окном: Capacity запросов за Window. Для оконных
+// алгоритмов при пустом Window окно равно Capacity / RefillRate.
 type RateConfig struct {
 	Capacity   int64   `json:"capacity"`
 	RefillRate float64 `json:"refill_rate"`
+	// Пусто - token_bucket
+	Algorithm Algorithm     `json:"algorithm,omitempty"`
+	Window    time.Duration `json:"window,omitempty"`
+}
+
+// Validate проверяет, что лимит задан полностью
+func (c RateConfig) Validate() error {
+	if c.Capacity <= 0 {
+		return fmt.Errorf("capacity must be positive")
+	}
+	if c.RefillRate < 0 || c.Window < 0 {
+		return fmt.Errorf("rate and window must not be negative")
+	}
+	if c.RefillRate == 0 && c.Window == 0 {
+		return fmt.Errorf("either refill rate or window is required")
+	}
+	if c.Algorithm == "" {
+		return nil
+	}
+	for _, a := range Algorithms {
+		if c.Algorithm == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown algorithm %q", c.Algorithm)
+}
+
+// rate запросов в секунду
+func (c RateConfig) rate() float64 {
+	if c.RefillRate > 0 || c.Window <= 0 {
+		return c.RefillRate
+	}
+	return float64(c.Capacity) / c.Window.Seconds()
+}
+
+// window окно, за которое допускается Capacity запросов
+func (c RateConfig) window() time.Duration {
+	if c.Window > 0 || c.RefillRate <= 0 {
+		return c.Window
+	}
+	return time.Duration(float64(c.Capacity) / c.RefillRate * float64(time.Second))
 }
 
 type ConfigStore interface {
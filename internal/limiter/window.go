@@ -0,0 +1,174 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// fixedWindow считает запросы в окнах, выровненных по времени.
+// На стыке окон возможен всплеск до 2*limit.
+type fixedWindow struct {
+	limit  int64
+	window time.Duration
+
+	mu    sync.Mutex
+	start time.Time
+	count int64
+}
+
+func (w *fixedWindow) advance(now time.Time) {
+	if start := now.Truncate(w.window); !start.Equal(w.start) {
+		w.start = start
+		w.count = 0
+	}
+}
+
+func (w *fixedWindow) allow(now time.Time) Decision {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.advance(now)
+
+	d := Decision{Limit: w.limit, Reset: w.start.Add(w.window).Sub(now)}
+	if w.count < w.limit {
+		w.count++
+		d.Allowed = true
+	} else {
+		d.RetryAfter = d.Reset
+	}
+	d.Remaining = w.limit - w.count
+	return d
+}
+
+func (w *fixedWindow) idle(now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.advance(now)
+	return w.count == 0
+}
+
+// slidingLog хранит время каждого разрешенного запроса за последнее окно
+type slidingLog struct {
+	limit  int64
+	window time.Duration
+
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (l *slidingLog) evict(now time.Time) {
+	i := 0
+	for i < len(l.times) && !l.times[i].Add(l.window).After(now) {
+		i++
+	}
+	l.times = l.times[i:]
+}
+
+func (l *slidingLog) allow(now time.Time) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.evict(now)
+
+	d := Decision{Limit: l.limit}
+	if int64(len(l.times)) < l.limit {
+		l.times = append(l.times, now)
+		d.Allowed = true
+	} else {
+		// Место освободится, когда из окна выйдет самый старый запрос
+		d.RetryAfter = l.times[0].Add(l.window).Sub(now)
+	}
+	d.Remaining = l.limit - int64(len(l.times))
+	if n := len(l.times); n > 0 {
+		d.Reset = l.times[n-1].Add(l.window).Sub(now)
+	}
+	return d
+}
+
+func (l *slidingLog) idle(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.evict(now)
+	return len(l.times) == 0
+}
+
+// slidingCounter оценивает число запросов за скользящее окно по счетчикам
+// текущего и предыдущего фиксированных окон: предыдущее учитывается
+// с весом оставшейся в скользящем окне доли
+type slidingCounter struct {
+	limit  int64
+	window time.Duration
+
+	mu    sync.Mutex
+	start time.Time
+	prev  int64
+	curr  int64
+}
+
+func (c *slidingCounter) advance(now time.Time) {
+	start := now.Truncate(c.window)
+	if start.Equal(c.start) {
+		return
+	}
+	if start.Equal(c.start.Add(c.window)) {
+		c.prev = c.curr
+	} else {
+		c.prev = 0
+	}
+	c.curr = 0
+	c.start = start
+}
+
+func (c *slidingCounter) allow(now time.Time) Decision {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance(now)
+
+	w := c.window.Seconds()
+	// Доля текущего окна, которая уже прошла
+	elapsed := now.Sub(c.start).Seconds() / w
+	estimate := float64(c.prev)*(1-elapsed) + float64(c.curr)
+
+	d := Decision{Limit: c.limit}
+	if estimate+1 <= float64(c.limit) {
+		c.curr++
+		estimate++
+		d.Allowed = true
+	} else {
+		d.RetryAfter = c.retryAfter(elapsed)
+	}
+	d.Remaining = max(0, int64(math.Floor(float64(c.limit)-estimate)))
+	switch {
+	case c.curr > 0:
+		d.Reset = seconds(w * (2 - elapsed))
+	case c.prev > 0:
+		d.Reset = seconds(w * (1 - elapsed))
+	}
+	return d
+}
+
+// retryAfter через сколько оценка опустится до limit-1
+func (c *slidingCounter) retryAfter(elapsed float64) time.Duration {
+	w := c.window.Seconds()
+	free := float64(c.limit - 1)
+	if c.curr <= c.limit-1 && c.prev > 0 {
+		// Достаточно, чтобы вес предыдущего окна уменьшился
+		return seconds(w * (1 - elapsed - (free-float64(c.curr))/float64(c.prev)))
+	}
+	// В следующем окне текущее станет предыдущим
+	wait := w * (1 - elapsed)
+	if c.curr > 0 {
+		wait += w * max(0, 1-free/float64(c.curr))
+	}
+	return seconds(wait)
+}
+
+func (c *slidingCounter) idle(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance(now)
+	return c.prev == 0 && c.curr == 0
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -38,6 +38,28 @@ var migrations = []Migration{
 			return err
 		},
 	},
+	{
+		Version: "2024053003",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+				CREATE TABLE IF NOT EXISTS health_events (
+					id BIGSERIAL PRIMARY KEY,
+					occurred_at TIMESTAMPTZ NOT NULL,
+					backend VARCHAR(2048) NOT NULL,
+					old_state VARCHAR(16) NOT NULL,
+					new_state VARCHAR(16) NOT NULL,
+					source VARCHAR(32) NOT NULL,
+					status_code INT,
+					latency_ms DOUBLE PRECISION,
+					error TEXT
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_health_events_backend_time
+				ON health_events (backend, occurred_at)
+			`)
+			return err
+		},
+	},
 }
 
 func Run(ctx context.Context, db *sql.DB) error {
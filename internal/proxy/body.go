@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// bodySource отдает тело запроса для каждой попытки.
+// Тела до MaxReplayBytes держатся в памяти, более крупные либо сбрасываются
+// во временный файл (до MaxSpoolBytes), либо передаются потоком без
+// возможности повтора.
+type bodySource struct {
+	buf    []byte
+	file   *os.File
+	size   int64
+	stream io.ReadCloser
+	tee    *teeBody
+	used   bool
+}
+
+func newBodySource(r *http.Request, cfg Config) (*bodySource, error) {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return &bodySource{}, nil
+	}
+
+	// Потоки gRPC нельзя читать заранее: клиент может ждать ответа
+	// перед отправкой следующего сообщения
+	if isGRPC(r) {
+		return &bodySource{tee: &teeBody{src: r.Body, limit: cfg.MaxReplayBytes}, size: r.ContentLength}, nil
+	}
+
+	// Заранее известно, что тело не влезет в лимит: не читаем его в память
+	if r.ContentLength > cfg.MaxReplayBytes && (!cfg.SpoolLargeBodies || cfg.exceedsSpool(r.ContentLength)) {
+		return &bodySource{stream: r.Body, size: r.ContentLength}, nil
+	}
+
+	var buf bytes.Buffer
+	if r.ContentLength > 0 && r.ContentLength <= cfg.MaxReplayBytes {
+		buf.Grow(int(r.ContentLength))
+	}
+	n, err := buf.ReadFrom(io.LimitReader(r.Body, cfg.MaxReplayBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read request body: %w", err)
+	}
+	if n <= cfg.MaxReplayBytes {
+		return &bodySource{buf: buf.Bytes(), size: n}, nil
+	}
+
+	rest := io.MultiReader(bytes.NewReader(buf.Bytes()), r.Body)
+	if !cfg.SpoolLargeBodies {
+		return &bodySource{stream: readCloser{rest, r.Body}, size: r.ContentLength}, nil
+	}
+
+	file, err := os.CreateTemp(cfg.SpoolDir, "proxy-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("create spool file: %w", err)
+	}
+	// Файл удаляется сразу, дескриптор живет до Close
+	os.Remove(file.Name())
+
+	src := rest
+	if cfg.MaxSpoolBytes > 0 {
+		src = io.LimitReader(rest, cfg.MaxSpoolBytes+1)
+	}
+	size, err := io.Copy(file, src)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("spool request body: %w", err)
+	}
+	if cfg.exceedsSpool(size) {
+		// Записанное начало тела и остаток уходят одним потоком
+		spooled := io.NewSectionReader(file, 0, size)
+		return &bodySource{file: file, stream: readCloser{io.MultiReader(spooled, r.Body), r.Body}, size: r.ContentLength}, nil
+	}
+	return &bodySource{file: file, size: size}, nil
+}
+
+// exceedsSpool больше ли тело размера n лимита временного файла
+func (c Config) exceedsSpool(n int64) bool {
+	return c.MaxSpoolBytes > 0 && n > c.MaxSpoolBytes
+}
+
+// Replayable сообщает, можно ли отправить тело повторно. Потоковое тело
+// gRPC повторяемо, если первая попытка прочитала его целиком в пределах лимита.
+func (b *bodySource) Replayable() bool {
+	if b.tee != nil {
+		return !b.used || b.tee.complete()
+	}
+	return b.stream == nil
+}
+
+// Next возвращает тело и его длину для очередной попытки
+func (b *bodySource) Next() (io.ReadCloser, int64, error) {
+	switch {
+	case b.stream != nil:
+		if b.used {
+			return nil, 0, fmt.Errorf("request body already consumed")
+		}
+		b.used = true
+		return b.stream, b.size, nil
+	case b.tee != nil:
+		if !b.used {
+			b.used = true
+			return b.tee, b.size, nil
+		}
+		if !b.tee.complete() {
+			return nil, 0, fmt.Errorf("request body already consumed")
+		}
+		return io.NopCloser(bytes.NewReader(b.tee.buf.Bytes())), int64(b.tee.buf.Len()), nil
+	case b.file != nil:
+		return io.NopCloser(io.NewSectionReader(b.file, 0, b.size)), b.size, nil
+	case b.size > 0:
+		return io.NopCloser(bytes.NewReader(b.buf)), b.size, nil
+	default:
+		return http.NoBody, 0, nil
+	}
+}
+
+func (b *bodySource) Close() error {
+	if b.file != nil {
+		return b.file.Close()
+	}
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// teeBody передает тело потоком и запоминает первые limit байт для повтора
+type teeBody struct {
+	src   io.Reader
+	limit int64
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	overflow bool
+	eof      bool
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.src.Read(p)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.overflow {
+		if int64(t.buf.Len()+n) > t.limit {
+			t.overflow = true
+			t.buf = bytes.Buffer{}
+		} else {
+			t.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		t.eof = true
+	}
+	return n, err
+}
+
+// Close не закрывает исходное тело: им владеет сервер
+func (t *teeBody) Close() error {
+	return nil
+}
+
+// complete прочитано ли тело целиком и уместилось ли в лимит
+func (t *teeBody) complete() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.eof && !t.overflow
+}
@@ -0,0 +1,273 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionConfig настройки сжатия ответов
+type CompressionConfig struct {
+	// Поддерживаемые кодировки в порядке предпочтения: br, zstd, gzip
+	Encodings []string
+	// Сжимаемые типы; значение с "/" на конце задает префикс ("text/")
+	ContentTypes []string
+	// Ответы меньше этого размера не сжимаются
+	MinSize int
+}
+
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		Encodings: []string{"br", "zstd", "gzip"},
+		ContentTypes: []string{
+			"text/",
+			"application/json",
+			"application/javascript",
+			"application/xml",
+			"application/x-ndjson",
+			"image/svg+xml",
+		},
+		MinSize: 1024,
+	}
+}
+
+// encoder потоковый кодировщик, переиспользуемый через Reset
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}},
+	"br": {New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, 5)
+	}},
+	"zstd": {New: func() interface{} {
+		enc, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return enc
+	}},
+}
+
+// Compressor сжимает ответы по Accept-Encoding клиента
+type Compressor struct {
+	cfg CompressionConfig
+}
+
+func NewCompressor(cfg CompressionConfig) (*Compressor, error) {
+	for _, enc := range cfg.Encodings {
+		if _, ok := encoderPools[enc]; !ok {
+			return nil, fmt.Errorf("unsupported compression encoding %q", enc)
+		}
+	}
+	return &Compressor{cfg: cfg}, nil
+}
+
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// gRPC сжимает сообщения сам (grpc-encoding)
+		if r.Method == http.MethodHead || isUpgradeRequest(r) || isGRPC(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, c: c, encoding: c.negotiate(r.Header.Get("Accept-Encoding"))}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiate выбирает кодировку с наибольшим q; при равенстве - по порядку из конфигурации
+func (c *Compressor) negotiate(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		weights[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range c.cfg.Encodings {
+		q, ok := weights[enc]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+func (c *Compressor) allowedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.cfg.ContentTypes {
+		if strings.HasSuffix(allowed, "/") {
+			if strings.HasPrefix(mediaType, allowed) {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter откладывает решение о сжатии, пока размер ответа неизвестен:
+// первые MinSize байт буферизуются. Flush до решения отправляет буфер
+// клиенту: поток событий сжимается сразу, остальные ответы - без сжатия.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *Compressor
+	encoding string
+
+	status  int
+	decided bool
+	pending []byte
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = code
+
+	if !cw.eligible() {
+		cw.commit(false)
+		return
+	}
+	cw.Header().Add("Vary", "Accept-Encoding")
+	if cw.encoding == "" {
+		cw.commit(false)
+		return
+	}
+	if cl := cw.Header().Get("Content-Length"); cl != "" {
+		n, err := strconv.Atoi(cl)
+		cw.commit(err == nil && n >= cw.c.cfg.MinSize)
+	}
+}
+
+// eligible ответ может быть сжат в принципе (без учета размера)
+func (cw *compressWriter) eligible() bool {
+	h := cw.Header()
+	switch {
+	case cw.status == http.StatusNoContent, cw.status == http.StatusNotModified,
+		cw.status == http.StatusPartialContent:
+		return false
+	case h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+		return false
+	case strings.Contains(h.Get("Cache-Control"), "no-transform"):
+		return false
+	}
+	return cw.c.allowedType(h.Get("Content-Type"))
+}
+
+// commit отправляет заголовки; compress - включить сжатие
+func (cw *compressWriter) commit(compress bool) {
+	cw.decided = true
+	if compress {
+		h := cw.Header()
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		// Сжатое представление отличается побайтно: строгий ETag становится слабым
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.pending) > 0 {
+		pending := cw.pending
+		cw.pending = nil
+		cw.write(pending)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		return cw.write(b)
+	}
+
+	cw.pending = append(cw.pending, b...)
+	if len(cw.pending) >= cw.c.cfg.MinSize {
+		cw.commit(true)
+	}
+	return len(b), nil
+}
+
+func (cw *compressWriter) write(b []byte) (int, error) {
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// FlushError отправляет клиенту накопленные данные. До решения о сжатии
+// поток событий сжимается сразу, а остальные ответы (NDJSON, long polling)
+// уходят без сжатия: короткий фрагмент не стоит задерживать до MinSize байт
+func (cw *compressWriter) FlushError() error {
+	if cw.status != 0 && !cw.decided {
+		cw.commit(isEventStream(cw.Header().Get("Content-Type")))
+	}
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Close завершает поток: короткий ответ отдается как есть
+func (cw *compressWriter) Close() {
+	if cw.status != 0 && !cw.decided {
+		cw.Header().Set("Content-Length", strconv.Itoa(len(cw.pending)))
+		cw.commit(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(io.Discard)
+		encoderPools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+func isEventStream(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/event-stream"
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
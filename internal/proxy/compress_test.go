@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func newTestCompressor(t *testing.T) *Compressor {
+	c, err := NewCompressor(DefaultCompressionConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func decode(t *testing.T, encoding string, r io.Reader) string {
+	var dec io.Reader
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec = gz
+	case "br":
+		dec = brotli.NewReader(r)
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		dec = zr
+	default:
+		dec = r
+	}
+	b, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCompressor_Negotiation(t *testing.T) {
+	body := strings.Repeat(`{"id":1,"name":"item"}`, 200)
+	h := newTestCompressor(t).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(body))
+	}))
+
+	cases := map[string]string{
+		"gzip":                 "gzip",
+		"gzip, br":             "br",
+		"br;q=0.5, zstd;q=0.8": "zstd",
+		"gzip;q=0, identity":   "",
+		"*":                    "br",
+		"":                     "",
+	}
+	for accept, want := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Content-Encoding"); got != want {
+			t.Fatalf("Accept-Encoding %q: expected %q, got %q", accept, want, got)
+		}
+		if rr.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("Accept-Encoding %q: missing Vary", accept)
+		}
+		if got := decode(t, want, rr.Body); got != body {
+			t.Fatalf("Accept-Encoding %q: body mismatch", accept)
+		}
+	}
+}
+
+func TestCompressor_Skips(t *testing.T) {
+	cases := map[string]http.HandlerFunc{
+		"small": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("short"))
+		},
+		"image": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(make([]byte, 4096))
+		},
+		"encoded": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(make([]byte, 4096))
+		},
+	}
+	for name, handler := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		newTestCompressor(t).Middleware(handler).ServeHTTP(rr, req)
+
+		if enc := rr.Header().Get("Content-Encoding"); enc != "" && name != "encoded" {
+			t.Fatalf("%s: response was compressed with %s", name, enc)
+		}
+		if name == "encoded" && rr.Body.Len() != 4096 {
+			t.Fatalf("already encoded response was modified")
+		}
+	}
+}
+
+func TestCompressor_Streaming(t *testing.T) {
+	next := make(chan struct{})
+	srv := httptest.NewServer(newTestCompressor(t).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		http.NewResponseController(w).Flush()
+		<-next
+		w.Write([]byte("data: second\n\n"))
+	})))
+	defer srv.Close()
+	defer close(next)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("stream was not compressed: %v", resp.Header)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Первое событие доходит до клиента до завершения ответа
+	line, err := bufio.NewReader(gz).ReadString('\n')
+	if err != nil || line != "data: first\n" {
+		t.Fatalf("got %q, %v", line, err)
+	}
+}
+
+// Прокси сбрасывает буфер после каждой записи ответа без Content-Length:
+// такой ответ отдается без сжатия
+func TestCompressor_SmallChunkedResponse(t *testing.T) {
+	h := newTestCompressor(t).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		for i := 0; i < 3; i++ {
+			w.Write([]byte(`{"chunk":true}`))
+			http.NewResponseController(w).Flush()
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if enc := rr.Header().Get("Content-Encoding"); enc != "" {
+		t.Fatalf("small chunked response compressed with %s", enc)
+	}
+	if body := rr.Body.String(); body != strings.Repeat(`{"chunk":true}`, 3) {
+		t.Fatalf("got %q", body)
+	}
+}
+
+// Сброс короткого фрагмента доходит до клиента, не дожидаясь MinSize байт
+func TestCompressor_FlushBeforeMinSize(t *testing.T) {
+	next := make(chan struct{})
+	srv := httptest.NewServer(newTestCompressor(t).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{\"heartbeat\":1}\n"))
+		http.NewResponseController(w).Flush()
+		<-next
+		w.Write([]byte("{\"heartbeat\":2}\n"))
+	})))
+	defer srv.Close()
+	defer close(next)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" {
+		t.Fatalf("flushed response compressed with %s", enc)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "{\"heartbeat\":1}\n" {
+		t.Fatalf("got %q, %v", line, err)
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Коды статусов gRPC
+const (
+	grpcInternal    = 13
+	grpcUnavailable = 14
+)
+
+var grpcCodeNames = []string{
+	"ok", "cancelled", "unknown", "invalid_argument", "deadline_exceeded",
+	"not_found", "already_exists", "permission_denied", "resource_exhausted",
+	"failed_precondition", "aborted", "out_of_range", "unimplemented",
+	"internal", "unavailable", "data_loss", "unauthenticated",
+}
+
+// grpcHTTPStatus эквиваленты кодов gRPC в HTTP для circuit breaker
+var grpcHTTPStatus = []int{
+	http.StatusOK, 499, http.StatusInternalServerError, http.StatusBadRequest,
+	http.StatusGatewayTimeout, http.StatusNotFound, http.StatusConflict,
+	http.StatusForbidden, http.StatusTooManyRequests, http.StatusBadRequest,
+	http.StatusConflict, http.StatusBadRequest, http.StatusNotImplemented,
+	http.StatusInternalServerError, http.StatusServiceUnavailable,
+	http.StatusInternalServerError, http.StatusUnauthorized,
+}
+
+// ParseGRPCCodes разбирает имена кодов gRPC (unavailable, resource_exhausted, ...)
+func ParseGRPCCodes(names []string) ([]int, error) {
+	codes := make([]int, 0, len(names))
+	for _, name := range names {
+		code := -1
+		for i, n := range grpcCodeNames {
+			if strings.EqualFold(strings.ReplaceAll(name, "-", "_"), n) {
+				code = i
+				break
+			}
+		}
+		if code < 0 {
+			return nil, fmt.Errorf("unknown gRPC status code: %s", name)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// isGRPC запрос gRPC (в том числе gRPC-Web)
+func isGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// grpcStatus код из grpc-status заголовков или трейлеров
+func grpcStatus(h http.Header) (int, bool) {
+	v := h.Get("Grpc-Status")
+	if v == "" {
+		return 0, false
+	}
+	code, err := strconv.Atoi(v)
+	if err != nil || code < 0 {
+		return grpcUnavailable, true
+	}
+	return code, true
+}
+
+// grpcOutcomeStatus HTTP-эквивалент кода gRPC; неизвестные коды считаются ошибкой сервера
+func grpcOutcomeStatus(code int) int {
+	if code < len(grpcHTTPStatus) {
+		return grpcHTTPStatus[code]
+	}
+	return http.StatusInternalServerError
+}
+
+// respondError отвечает клиенту ошибкой прокси. Клиентам gRPC ответ
+// отдается в формате trailers-only, чтобы они видели код, а не HTTP-статус.
+func respondError(w http.ResponseWriter, r *http.Request, msg string, status int) {
+	if !isGRPC(r) {
+		http.Error(w, msg, status)
+		return
+	}
+	code := grpcUnavailable
+	if status == http.StatusBadRequest {
+		code = grpcInternal
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", msg)
+	w.WriteHeader(http.StatusOK)
+}
@@ -54,7 +54,7 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		copyHeaders(req.Header, r.Header)
 
-		if lc, ok := h.balancer.(interface{ ReleaseConnection(url string) }); ok {
+		if lc, ok := h.balancer.(interfaces.ConnectionTracker); ok {
 			defer lc.ReleaseConnection(backendURL.String())
 		}
 
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// hopHeaders заголовки уровня соединения (RFC 7230, раздел 6.1),
+// которые не передаются следующему узлу
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders удаляет hop-by-hop заголовки, включая перечисленные в Connection
+func removeHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// acceptsTrailers содержит ли TE значение trailers
+func acceptsTrailers(h http.Header) bool {
+	for _, v := range h.Values("Te") {
+		for _, token := range strings.Split(v, ",") {
+			if name, _, _ := strings.Cut(token, ";"); strings.EqualFold(textproto.TrimString(name), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseCIDRs разбирает список подсетей; одиночный IP трактуется как /32 или /128
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address: %s", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s: %w", v, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP возвращает IP непосредственного собеседника без порта
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// prepareRequestHeaders формирует заголовки запроса к бэкенду:
+// убирает hop-by-hop, выставляет X-Forwarded-*, Forwarded и Via.
+// Входящие forwarded-заголовки дополняются только от доверенных прокси,
+// от остальных клиентов они перезаписываются.
+func (h *Handler) prepareRequestHeaders(out http.Header, r *http.Request) {
+	trailers := acceptsTrailers(out)
+	removeHopHeaders(out)
+	if trailers {
+		// TE: trailers нужен gRPC-бэкендам и передается дальше
+		out.Set("Te", "trailers")
+	}
+
+	ip := remoteIP(r)
+	trusted := ip != nil && ipInNets(ip, h.cfg.TrustedProxies)
+
+	clientIP := ""
+	if ip != nil {
+		clientIP = ip.String()
+	}
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	if !trusted {
+		out.Del("X-Forwarded-For")
+		out.Del("X-Forwarded-Proto")
+		out.Del("X-Forwarded-Host")
+		out.Del("Forwarded")
+	}
+
+	if clientIP != "" {
+		if prior := out.Values("X-Forwarded-For"); len(prior) > 0 {
+			clientIP = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		out.Set("X-Forwarded-For", clientIP)
+	}
+	if out.Get("X-Forwarded-Proto") == "" {
+		out.Set("X-Forwarded-Proto", proto)
+	}
+	if out.Get("X-Forwarded-Host") == "" && r.Host != "" {
+		out.Set("X-Forwarded-Host", r.Host)
+	}
+
+	element := forwardedElement(ip, r.Host, proto)
+	if prior := out.Values("Forwarded"); len(prior) > 0 {
+		element = strings.Join(prior, ", ") + ", " + element
+	}
+	out.Set("Forwarded", element)
+
+	appendVia(out, r.ProtoMajor, r.ProtoMinor, h.cfg.Via)
+}
+
+// prepareResponseHeaders убирает hop-by-hop заголовки ответа и добавляет Via
+func (h *Handler) prepareResponseHeaders(out http.Header, resp *http.Response) {
+	removeHopHeaders(out)
+	appendVia(out, resp.ProtoMajor, resp.ProtoMinor, h.cfg.Via)
+}
+
+// forwardedElement собирает элемент заголовка Forwarded (RFC 7239)
+func forwardedElement(ip net.IP, host, proto string) string {
+	parts := make([]string, 0, 3)
+	if ip != nil {
+		node := ip.String()
+		if ip.To4() == nil {
+			node = `"[` + node + `]"`
+		}
+		parts = append(parts, "for="+node)
+	}
+	if host != "" {
+		parts = append(parts, "host="+quoteForwarded(host))
+	}
+	parts = append(parts, "proto="+proto)
+	return strings.Join(parts, ";")
+}
+
+// quoteForwarded берет значение в кавычки, если оно не является token
+func quoteForwarded(v string) string {
+	for _, c := range v {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+		}
+	}
+	return v
+}
+
+func appendVia(h http.Header, major, minor int, pseudonym string) {
+	if pseudonym == "" {
+		return
+	}
+	h.Add("Via", fmt.Sprintf("%d.%d %s", major, minor, pseudonym))
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrepareRequestHeaders(t *testing.T) {
+	trusted, err := ParseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		header        http.Header
+		wantXFF       string
+		wantForwarded string
+		wantProto     string
+	}{
+		{
+			name:          "untrusted client overwrites forwarded headers",
+			remoteAddr:    "203.0.113.7:5555",
+			header:        http.Header{"X-Forwarded-For": {"1.2.3.4"}, "X-Forwarded-Proto": {"https"}, "Forwarded": {"for=1.2.3.4"}},
+			wantXFF:       "203.0.113.7",
+			wantForwarded: "for=203.0.113.7;host=example.com;proto=http",
+			wantProto:     "http",
+		},
+		{
+			name:          "trusted proxy appends to forwarded headers",
+			remoteAddr:    "10.1.2.3:5555",
+			header:        http.Header{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Proto": {"https"}, "Forwarded": {"for=198.51.100.1"}},
+			wantXFF:       "198.51.100.1, 10.1.2.3",
+			wantForwarded: "for=198.51.100.1, for=10.1.2.3;host=example.com;proto=http",
+			wantProto:     "https",
+		},
+		{
+			name:          "ipv6 client is quoted in Forwarded",
+			remoteAddr:    "[2001:db8::1]:5555",
+			header:        http.Header{},
+			wantXFF:       "2001:db8::1",
+			wantForwarded: `for="[2001:db8::1]";host=example.com;proto=http`,
+			wantProto:     "http",
+		},
+	}
+
+	cfg := DefaultConfig()
+	cfg.TrustedProxies = trusted
+	h := &Handler{cfg: cfg}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			out := tt.header.Clone()
+
+			h.prepareRequestHeaders(out, r)
+
+			if got := out.Get("X-Forwarded-For"); got != tt.wantXFF {
+				t.Errorf("X-Forwarded-For = %q, want %q", got, tt.wantXFF)
+			}
+			if got := out.Get("Forwarded"); got != tt.wantForwarded {
+				t.Errorf("Forwarded = %q, want %q", got, tt.wantForwarded)
+			}
+			if got := out.Get("X-Forwarded-Proto"); got != tt.wantProto {
+				t.Errorf("X-Forwarded-Proto = %q, want %q", got, tt.wantProto)
+			}
+			if got := out.Get("Via"); got != "1.1 go-highload-balancer" {
+				t.Errorf("Via = %q", got)
+			}
+		})
+	}
+}
+
+func TestRemoveHopHeaders(t *testing.T) {
+	h := http.Header{
+		"Connection":        {"keep-alive, X-Session"},
+		"Keep-Alive":        {"timeout=5"},
+		"Transfer-Encoding": {"chunked"},
+		"Te":                {"trailers"},
+		"X-Session":         {"abc"},
+		"X-Request-Id":      {"42"},
+	}
+
+	removeHopHeaders(h)
+
+	for _, name := range []string{"Connection", "Keep-Alive", "Transfer-Encoding", "Te", "X-Session"} {
+		if h.Get(name) != "" {
+			t.Errorf("hop-by-hop header %s was not removed", name)
+		}
+	}
+	if h.Get("X-Request-Id") != "42" {
+		t.Error("end-to-end header was removed")
+	}
+}
@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HedgeConfig настройки hedged-запросов маршрута: если первый бэкенд не ответил
+// за Delay, тот же запрос (только GET и HEAD) отправляется второму и берется первый ответ
+type HedgeConfig struct {
+	// Фиксированная задержка перед вторым запросом
+	Delay time.Duration `json:"delay"`
+	// Если задан, задержка равна этому перцентилю недавних латентностей
+	// маршрута (например, 95), а Delay используется, пока статистики мало
+	DelayPercentile float64 `json:"delay_percentile,omitempty"`
+	// Максимальная доля hedged-запросов от подходящего трафика в процентах
+	MaxPercent float64 `json:"max_percent"`
+}
+
+// Hedge политика hedging одного маршрута: настройки, бюджет и окно латентностей
+type Hedge struct {
+	cfg       HedgeConfig
+	latencies *latencyWindow
+	budget    *retryBudget
+}
+
+func NewHedge(cfg HedgeConfig) *Hedge {
+	return &Hedge{
+		cfg:       cfg,
+		latencies: &latencyWindow{},
+		budget:    newRetryBudget(cfg.MaxPercent, 0),
+	}
+}
+
+type hedgeKey struct{}
+
+// Wrap включает hedging для запросов, проходящих через next
+func (hg *Hedge) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), hedgeKey{}, hg)))
+	})
+}
+
+func hedgeFrom(ctx context.Context) *Hedge {
+	hg, _ := ctx.Value(hedgeKey{}).(*Hedge)
+	return hg
+}
+
+func (hg *Hedge) delay() time.Duration {
+	if p := hg.cfg.DelayPercentile; p > 0 {
+		if d, ok := hg.latencies.Percentile(p); ok {
+			return d
+		}
+	}
+	return hg.cfg.Delay
+}
+
+// HedgeStats счетчики hedging
+type HedgeStats struct {
+	Eligible    int64 `json:"eligible"`
+	Hedged      int64 `json:"hedged"`
+	PrimaryWins int64 `json:"primary_wins"`
+	HedgeWins   int64 `json:"hedge_wins"`
+}
+
+type hedgeCounters struct {
+	eligible    atomic.Int64
+	hedged      atomic.Int64
+	primaryWins atomic.Int64
+	hedgeWins   atomic.Int64
+}
+
+func (c *hedgeCounters) snapshot() HedgeStats {
+	return HedgeStats{
+		Eligible:    c.eligible.Load(),
+		Hedged:      c.hedged.Load(),
+		PrimaryWins: c.primaryWins.Load(),
+		HedgeWins:   c.hedgeWins.Load(),
+	}
+}
+
+const (
+	latencyWindowSize   = 1024
+	latencyMinSamples   = 32
+	percentileCacheTime = time.Second
+)
+
+// latencyWindow хранит последние времена ответа для расчета перцентилей
+type latencyWindow struct {
+	mu       sync.Mutex
+	samples  [latencyWindowSize]time.Duration
+	next     int
+	count    int
+	cached   map[float64]time.Duration
+	cachedAt time.Time
+}
+
+func (l *latencyWindow) Observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencyWindowSize
+	if l.count < latencyWindowSize {
+		l.count++
+	}
+}
+
+// Percentile возвращает перцентиль p (0-100); значение кешируется на секунду
+func (l *latencyWindow) Percentile(p float64) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count < latencyMinSamples {
+		return 0, false
+	}
+	if v, ok := l.cached[p]; ok && time.Since(l.cachedAt) < percentileCacheTime {
+		return v, true
+	}
+
+	sorted := make([]time.Duration, l.count)
+	copy(sorted, l.samples[:l.count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	idx := int(p / 100 * float64(len(sorted)-1))
+	if time.Since(l.cachedAt) >= percentileCacheTime {
+		l.cached = make(map[float64]time.Duration)
+		l.cachedAt = time.Now()
+	}
+	l.cached[p] = sorted[idx]
+	return sorted[idx], true
+}
+
+// hedgeEligible возвращает политику маршрута, если запрос можно продублировать
+func (h *Handler) hedgeEligible(r *http.Request, body *bodySource) *Hedge {
+	hg := hedgeFrom(r.Context())
+	if hg == nil || !body.Replayable() {
+		return nil
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return nil
+	}
+	return hg
+}
+
+type hedgeResult struct {
+	resp    *upstreamResponse
+	backend *url.URL
+	err     error
+	hedge   bool
+}
+
+// hedgedRoundTrip отправляет запрос на primary и, если тот не ответил
+// за задержку, на второй бэкенд. Возвращается первый успешный ответ,
+// проигравшая попытка отменяется. При неудаче обеих возвращается ошибка primary.
+func (h *Handler) hedgedRoundTrip(r *http.Request, hg *Hedge, primary *url.URL, body *bodySource) (*upstreamResponse, *url.URL, error) {
+	h.hedgeStats.eligible.Add(1)
+	hg.budget.RecordRequest()
+
+	results := make(chan hedgeResult, 2)
+	primaryCtx, cancelPrimary := context.WithCancel(r.Context())
+	go func() {
+		resp, err := h.roundTrip(primaryCtx, r, primary, body)
+		results <- hedgeResult{resp: resp, backend: primary, err: err}
+	}()
+
+	timer := time.NewTimer(hg.delay())
+	defer timer.Stop()
+
+	select {
+	case res := <-results:
+		if res.err == nil {
+			h.hedgeStats.primaryWins.Add(1)
+		}
+		return finishHedge(res, cancelPrimary)
+	case <-timer.C:
+	}
+
+	hedgeURL := h.pickHedgeBackend(r, primary)
+	if hedgeURL == nil || !hg.budget.AllowRetry() {
+		if hedgeURL != nil {
+			h.discardPick(hedgeURL)
+		}
+		return finishHedge(<-results, cancelPrimary)
+	}
+
+	h.hedgeStats.hedged.Add(1)
+	hedgeCtx, cancelHedge := context.WithCancel(r.Context())
+	go func() {
+		resp, err := h.roundTrip(hedgeCtx, r, hedgeURL, body)
+		results <- hedgeResult{resp: resp, backend: hedgeURL, err: err, hedge: true}
+	}()
+
+	winner := <-results
+	if winner.err != nil {
+		h.reportHedgeFailure(winner)
+		second := <-results
+		h.reportHedgeFailure(second)
+		if second.err != nil {
+			// Обе попытки неудачны: наверх уходит ошибка primary
+			cancelPrimary()
+			cancelHedge()
+			if winner.hedge {
+				winner = second
+			}
+			return nil, winner.backend, winner.err
+		}
+		winner = second
+	} else {
+		// Проигравший отменяется, его ответ освобождается, когда он вернется
+		go func() {
+			if loser := <-results; loser.resp != nil {
+				loser.resp.Close()
+			}
+		}()
+	}
+
+	if winner.hedge {
+		cancelPrimary()
+		h.hedgeStats.hedgeWins.Add(1)
+		return finishHedge(winner, cancelHedge)
+	}
+	cancelHedge()
+	h.hedgeStats.primaryWins.Add(1)
+	return finishHedge(winner, cancelPrimary)
+}
+
+// finishHedge привязывает отмену контекста попытки к закрытию ответа
+func finishHedge(res hedgeResult, cancel context.CancelFunc) (*upstreamResponse, *url.URL, error) {
+	if res.resp == nil {
+		cancel()
+		return nil, res.backend, res.err
+	}
+	res.resp.onClose = cancel
+	return res.resp, res.backend, nil
+}
+
+// reportHedgeFailure помечает бэкенд второй попытки; ошибку primary
+// обрабатывает общий цикл повторов
+func (h *Handler) reportHedgeFailure(res hedgeResult) {
+	if res.err == nil || !res.hedge || errors.Is(res.err, context.Canceled) {
+		return
+	}
+	h.logger.Errorf("Hedged request to backend %s failed: %v", res.backend, res.err)
+	if isConnectionFailure(res.err) {
+		h.balancer.MarkBackendStatus(res.backend.String(), false)
+	}
+}
+
+// pickHedgeBackend выбирает через балансировщик бэкенд, отличный от primary
+func (h *Handler) pickHedgeBackend(r *http.Request, primary *url.URL) *url.URL {
+	for i := 0; i < len(h.balancer.GetAll()); i++ {
+		u, err := h.balancer.Next(r)
+		if err != nil {
+			return nil
+		}
+		if u.String() != primary.String() {
+			return u
+		}
+		h.discardPick(u)
+	}
+	return nil
+}
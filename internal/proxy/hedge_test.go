@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler_HedgeWinsOverSlowBackend(t *testing.T) {
+	cancelled := make(chan struct{}, 1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+			w.Write([]byte("slow"))
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		}
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	// Round robin начинает со второго бэкенда: primary - медленный
+	h := newTestHandler(DefaultConfig(), fast.URL, slow.URL)
+	route := NewHedge(HedgeConfig{Delay: 20 * time.Millisecond, MaxPercent: 100}).Wrap(h)
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	route.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/catalog/items", nil))
+
+	if rr.Body.String() != "fast" {
+		t.Fatalf("expected hedged response from fast backend, got %q", rr.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("hedged request took %s", elapsed)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("losing request to slow backend was not cancelled")
+	}
+
+	stats := h.Stats().Hedge
+	if stats.Hedged != 1 || stats.HedgeWins != 1 {
+		t.Fatalf("unexpected hedge stats: %+v", stats)
+	}
+}
+
+func TestHandler_HedgeOnlyForConfiguredRoutes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	h := newTestHandler(DefaultConfig(), backend.URL, backend.URL)
+
+	// Запрос идет в пул мимо маршрута с hedging
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	if stats := h.Stats().Hedge; stats.Eligible != 0 || stats.Hedged != 0 {
+		t.Fatalf("request outside hedge routes was hedged: %+v", stats)
+	}
+}
+
+func TestHedge_LatencyWindowPerRoute(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	h := newTestHandler(DefaultConfig(), backend.URL)
+	catalog := NewHedge(HedgeConfig{Delay: time.Second, MaxPercent: 100})
+	search := NewHedge(HedgeConfig{Delay: time.Second, MaxPercent: 100})
+
+	route := catalog.Wrap(h)
+	for i := 0; i < 5; i++ {
+		route.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/catalog", nil))
+	}
+
+	catalog.latencies.mu.Lock()
+	observed := catalog.latencies.count
+	catalog.latencies.mu.Unlock()
+	if observed != 5 {
+		t.Fatalf("expected 5 latencies for catalog route, got %d", observed)
+	}
+	search.latencies.mu.Lock()
+	defer search.latencies.mu.Unlock()
+	if search.latencies.count != 0 {
+		t.Fatalf("catalog requests leaked into search latencies: %d", search.latencies.count)
+	}
+}
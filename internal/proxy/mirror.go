@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MirrorConfig настройки зеркалирования запросов в теневой пул
+type MirrorConfig struct {
+	// Доля зеркалируемых запросов в процентах
+	SamplePercent float64 `json:"sample_percent"`
+	// Таймаут теневого запроса, не влияет на основной
+	Timeout time.Duration `json:"timeout"`
+	// Запросы с телом больше лимита не зеркалируются
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+	// Сравнивать коды ответа основного и теневого пула
+	CompareStatus bool `json:"compare_status"`
+	// Максимум одновременных теневых запросов, лишние отбрасываются
+	MaxInFlight int `json:"max_in_flight"`
+}
+
+// MirrorStats счетчики зеркалирования.
+// StatusPairs: "<основной>/<теневой>" -> количество, 0 - теневой запрос не получил ответа.
+type MirrorStats struct {
+	Sampled     int64            `json:"sampled"`
+	Mirrored    int64            `json:"mirrored"`
+	Skipped     int64            `json:"skipped_body_too_large"`
+	Dropped     int64            `json:"dropped"`
+	Failed      int64            `json:"failed"`
+	Compared    int64            `json:"compared"`
+	Mismatches  int64            `json:"mismatches"`
+	StatusPairs map[string]int64 `json:"status_pairs,omitempty"`
+}
+
+// Mirror отправляет копии запросов в теневой обработчик и отбрасывает его ответы.
+// Теневые запросы выполняются в фоне и не задерживают основной ответ.
+type Mirror struct {
+	target   http.Handler
+	cfg      MirrorConfig
+	inFlight atomic.Int64
+
+	sampled    atomic.Int64
+	mirrored   atomic.Int64
+	skipped    atomic.Int64
+	dropped    atomic.Int64
+	failed     atomic.Int64
+	compared   atomic.Int64
+	mismatches atomic.Int64
+
+	mu    sync.Mutex
+	pairs map[string]int64
+}
+
+func NewMirror(target http.Handler, cfg MirrorConfig) *Mirror {
+	return &Mirror{
+		target: target,
+		cfg:    cfg,
+		pairs:  make(map[string]int64),
+	}
+}
+
+func (m *Mirror) Stats() MirrorStats {
+	stats := MirrorStats{
+		Sampled:    m.sampled.Load(),
+		Mirrored:   m.mirrored.Load(),
+		Skipped:    m.skipped.Load(),
+		Dropped:    m.dropped.Load(),
+		Failed:     m.failed.Load(),
+		Compared:   m.compared.Load(),
+		Mismatches: m.mismatches.Load(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.pairs) > 0 {
+		stats.StatusPairs = make(map[string]int64, len(m.pairs))
+		for k, v := range m.pairs {
+			stats.StatusPairs[k] = v
+		}
+	}
+	return stats
+}
+
+// Wrap возвращает обработчик, зеркалирующий выборку запросов перед передачей в primary
+func (m *Mirror) Wrap(primary http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isUpgradeRequest(r) || rand.Float64()*100 >= m.cfg.SamplePercent {
+			primary.ServeHTTP(w, r)
+			return
+		}
+		m.sampled.Add(1)
+
+		body, ok := m.captureBody(r)
+		if !ok {
+			m.skipped.Add(1)
+			primary.ServeHTTP(w, r)
+			return
+		}
+		if n := m.inFlight.Add(1); m.cfg.MaxInFlight > 0 && n > int64(m.cfg.MaxInFlight) {
+			m.inFlight.Add(-1)
+			m.dropped.Add(1)
+			primary.ServeHTTP(w, r)
+			return
+		}
+
+		shadow := r.Clone(context.Background())
+		shadow.Body = http.NoBody
+		if body != nil {
+			shadow.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if !m.cfg.CompareStatus {
+			go m.send(shadow, nil)
+			primary.ServeHTTP(w, r)
+			return
+		}
+
+		primaryStatus := make(chan int, 1)
+		go m.send(shadow, primaryStatus)
+
+		sw := NewStatusWriter(w)
+		defer func() { primaryStatus <- sw.Status }()
+		primary.ServeHTTP(sw, r)
+	})
+}
+
+// captureBody буферизует тело для теневого запроса и подменяет r.Body копией.
+// false - тело больше MaxBodyBytes или идет потоком (неизвестная длина, gRPC):
+// его нельзя дочитать до ответа основного пула, основной запрос получает тело целиком.
+func (m *Mirror) captureBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	if r.ContentLength < 0 || r.ContentLength > m.cfg.MaxBodyBytes || isGRPC(r) {
+		return nil, false
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, m.cfg.MaxBodyBytes+1))
+	if err != nil || int64(len(buf)) > m.cfg.MaxBodyBytes {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil, false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(buf))
+	return buf, true
+}
+
+func (m *Mirror) send(r *http.Request, primaryStatus <-chan int) {
+	defer m.inFlight.Add(-1)
+	m.mirrored.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeout)
+	defer cancel()
+
+	rec := &discardWriter{header: make(http.Header)}
+	m.target.ServeHTTP(rec, r.WithContext(ctx))
+
+	status := rec.status
+	if ctx.Err() != nil {
+		// Ответ не уложился в таймаут
+		status = 0
+	}
+	if status == 0 || status >= http.StatusInternalServerError {
+		m.failed.Add(1)
+	}
+
+	if primaryStatus == nil {
+		return
+	}
+	primary := <-primaryStatus
+	m.compared.Add(1)
+	if primary != status {
+		m.mismatches.Add(1)
+	}
+
+	m.mu.Lock()
+	m.pairs[strconv.Itoa(primary)+"/"+strconv.Itoa(status)]++
+	m.mu.Unlock()
+}
+
+// discardWriter отбрасывает теневой ответ, запоминая только код
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (d *discardWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *discardWriter) WriteHeader(code int) {
+	if d.status == 0 && code >= http.StatusOK {
+		d.status = code
+	}
+}
+
+func (d *discardWriter) Write(b []byte) (int, error) {
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	return len(b), nil
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirror_DoesNotDelayPrimaryAndComparesStatus(t *testing.T) {
+	primary := countingBackend()
+	defer primary.Close()
+
+	bodies := make(chan string, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies <- string(b)
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+
+	m := NewMirror(newTestHandler(DefaultConfig(), shadow.URL), MirrorConfig{
+		SamplePercent: 100,
+		Timeout:       time.Second,
+		MaxBodyBytes:  1024,
+		CompareStatus: true,
+	})
+	h := m.Wrap(newTestHandler(DefaultConfig(), primary.URL))
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("payload")))
+	if rr.Code != http.StatusOK || rr.Body.String() != "7" {
+		t.Fatalf("primary response broken: %d %q", rr.Code, rr.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("mirroring delayed primary response by %s", elapsed)
+	}
+
+	if got := <-bodies; got != "payload" {
+		t.Fatalf("shadow received body %q", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for m.Stats().Compared != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("status comparison not recorded: %+v", m.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := m.Stats()
+	if stats.Mismatches != 1 || stats.StatusPairs["200/500"] != 1 {
+		t.Fatalf("unexpected mirror stats: %+v", stats)
+	}
+}
+
+func TestMirror_SkipsLargeBodies(t *testing.T) {
+	primary := countingBackend()
+	defer primary.Close()
+
+	shadowHits := make(chan struct{}, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shadowHits <- struct{}{}
+	}))
+	defer shadow.Close()
+
+	m := NewMirror(newTestHandler(DefaultConfig(), shadow.URL), MirrorConfig{
+		SamplePercent: 100,
+		Timeout:       time.Second,
+		MaxBodyBytes:  4,
+	})
+	h := m.Wrap(newTestHandler(DefaultConfig(), primary.URL))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("0123456789"))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Body.String() != "10" {
+		t.Fatalf("primary did not receive full body: %q", rr.Body.String())
+	}
+
+	select {
+	case <-shadowHits:
+		t.Fatal("request with large body was mirrored")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if stats := m.Stats(); stats.Skipped != 1 || stats.Mirrored != 0 {
+		t.Fatalf("unexpected mirror stats: %+v", stats)
+	}
+}
+
+// Тело неизвестной длины идет потоком: основной запрос получает его сразу,
+// не дожидаясь конца тела, и не зеркалируется
+func TestMirror_SkipsStreamingBodies(t *testing.T) {
+	firstChunk := make(chan string, 1)
+	primary := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 5)
+		n, _ := io.ReadFull(r.Body, buf)
+		firstChunk <- string(buf[:n])
+		io.Copy(io.Discard, r.Body)
+	})
+
+	shadowHits := make(chan struct{}, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shadowHits <- struct{}{}
+	}))
+	defer shadow.Close()
+
+	m := NewMirror(newTestHandler(DefaultConfig(), shadow.URL), MirrorConfig{
+		SamplePercent: 100,
+		Timeout:       time.Second,
+		MaxBodyBytes:  1024,
+	})
+	h := m.Wrap(primary)
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/stream", pr)
+	req.ContentLength = -1
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	pw.Write([]byte("hello"))
+	select {
+	case got := <-firstChunk:
+		if got != "hello" {
+			t.Fatalf("primary received %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("primary did not receive streamed body before it ended")
+	}
+	pw.Close()
+	<-done
+
+	select {
+	case <-shadowHits:
+		t.Fatal("streaming request was mirrored")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if stats := m.Stats(); stats.Skipped != 1 || stats.Mirrored != 0 {
+		t.Fatalf("unexpected mirror stats: %+v", stats)
+	}
+}
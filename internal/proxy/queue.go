@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errQueueFull    = errors.New("request queue is full")
+	errQueueTimeout = errors.New("request queue timeout")
+)
+
+// QueueConfig настройки очереди запросов, ожидающих свободный слот бэкенда
+type QueueConfig struct {
+	// Максимальная длина очереди, 0 - очередь выключена
+	Size int
+	// Максимальное время ожидания в очереди
+	Timeout time.Duration
+}
+
+// QueueStats состояние очереди
+type QueueStats struct {
+	Depth    int   `json:"depth"`
+	Size     int   `json:"size"`
+	Enqueued int64 `json:"enqueued"`
+	Rejected int64 `json:"rejected"`
+	TimedOut int64 `json:"timed_out"`
+}
+
+// requestQueue ограниченная FIFO-очередь ожидающих запросов.
+// Освобождение слота бэкенда будит первого в очереди; пока разбуженный
+// не занял слот или не вернулся в очередь, передача слота не завершена.
+type requestQueue struct {
+	mu       sync.Mutex
+	size     int
+	waiters  *list.List
+	handoffs int
+
+	enqueued atomic.Int64
+	rejected atomic.Int64
+	timedOut atomic.Int64
+}
+
+func newRequestQueue(size int) *requestQueue {
+	return &requestQueue{
+		size:    size,
+		waiters: list.New(),
+	}
+}
+
+func (q *requestQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiters.Len()
+}
+
+// Idle сообщает, что очередь пуста и ни один разбуженный запрос не ждет
+// своего слота: только тогда новый запрос может занять слот без очереди
+func (q *requestQueue) Idle() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiters.Len() == 0 && q.handoffs == 0
+}
+
+// Wait ставит запрос в очередь и ждет сигнала о свободном слоте.
+// Разбуженный запрос (false, nil) пробует занять слот и завершает передачу
+// через Done, а не получивший бэкенд возвращается в начало очереди (front).
+//
+// Слот мог освободиться между проверкой занятости и постановкой в очередь:
+// сигнал тогда ушел в пустую очередь и потерян. Поэтому первый в очереди
+// после постановки еще раз пробует занять слот через acquire; true -
+// слот занят, ждать не нужно.
+func (q *requestQueue) Wait(ctx context.Context, deadline time.Time, front bool, acquire func() bool) (bool, error) {
+	q.mu.Lock()
+	if !front && q.waiters.Len() >= q.size {
+		q.mu.Unlock()
+		q.rejected.Add(1)
+		return false, errQueueFull
+	}
+	ready := make(chan struct{})
+	var elem *list.Element
+	if front {
+		// Возврат в очередь завершает передачу слота этому запросу
+		q.handoffs--
+		elem = q.waiters.PushFront(ready)
+	} else {
+		elem = q.waiters.PushBack(ready)
+		q.enqueued.Add(1)
+	}
+	first := q.waiters.Front() == elem
+	q.mu.Unlock()
+
+	if first && acquire() {
+		if !q.remove(elem) {
+			// Сигнал о другом слоте уже пришел: он достается следующему
+			q.passOn()
+		}
+		return true, nil
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return false, nil
+	case <-timer.C:
+		if q.remove(elem) {
+			q.timedOut.Add(1)
+			return false, errQueueTimeout
+		}
+		// Сигнал пришел одновременно с таймаутом: передаем его дальше
+		q.passOn()
+		q.timedOut.Add(1)
+		return false, errQueueTimeout
+	case <-ctx.Done():
+		if !q.remove(elem) {
+			q.passOn()
+		}
+		return false, ctx.Err()
+	}
+}
+
+// Notify будит первый запрос в очереди
+func (q *requestQueue) Notify() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.wake()
+}
+
+// Done завершает передачу слота разбуженному запросу, занявшему бэкенд
+func (q *requestQueue) Done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handoffs--
+}
+
+// passOn отдает полученный сигнал следующему в очереди
+func (q *requestQueue) passOn() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handoffs--
+	q.wake()
+}
+
+func (q *requestQueue) wake() {
+	if front := q.waiters.Front(); front != nil {
+		q.waiters.Remove(front)
+		q.handoffs++
+		close(front.Value.(chan struct{}))
+	}
+}
+
+// remove убирает ожидающего из очереди; false - его уже разбудили
+func (q *requestQueue) remove(elem *list.Element) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-elem.Value.(chan struct{}):
+		return false
+	default:
+		q.waiters.Remove(elem)
+		return true
+	}
+}
+
+func (q *requestQueue) stats() QueueStats {
+	return QueueStats{
+		Depth:    q.Len(),
+		Size:     q.size,
+		Enqueued: q.enqueued.Load(),
+		Rejected: q.rejected.Load(),
+		TimedOut: q.timedOut.Load(),
+	}
+}
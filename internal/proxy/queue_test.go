@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/algorithms"
+)
+
+func TestHandler_QueueWhenBackendsAtCapacity(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 4)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	lb := algorithms.NewRoundRobinBalancer([]string{backend.URL}, testLogger{})
+	lb.GetAll()[0].MaxConnections = 1
+
+	cfg := DefaultConfig()
+	cfg.Queue = QueueConfig{Size: 1, Timeout: 2 * time.Second}
+	h := NewHandler(lb, testLogger{}, cfg)
+
+	codes := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			codes[i] = rr.Code
+		}(i)
+		if i == 0 {
+			<-started
+		}
+	}
+
+	// Ждем, пока второй запрос встанет в очередь
+	deadline := time.Now().Add(time.Second)
+	for h.Stats().Queue.Depth != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second request was not queued")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Очередь заполнена: третий запрос получает 503 с Retry-After
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "2" {
+		t.Fatalf("expected 503 with Retry-After on overflow, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("request %d: got %d", i, code)
+		}
+	}
+	if stats := h.Stats().Queue; stats.Enqueued != 1 || stats.Rejected != 1 || stats.Depth != 0 {
+		t.Fatalf("unexpected queue stats: %+v", stats)
+	}
+}
+
+func TestHandler_QueueTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer backend.Close()
+
+	lb := algorithms.NewLeastConnectionsBalancer([]string{backend.URL}, testLogger{})
+	lb.GetAll()[0].MaxConnections = 1
+	// Слот занят "вечным" запросом
+	if _, err := lb.Next(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Queue = QueueConfig{Size: 10, Timeout: 50 * time.Millisecond}
+	h := NewHandler(lb, testLogger{}, cfg)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After on queue timeout, got %d", rr.Code)
+	}
+	if stats := h.Stats().Queue; stats.TimedOut != 1 {
+		t.Fatalf("unexpected queue stats: %+v", stats)
+	}
+}
+
+// Слот освободился после проверки занятости, но до постановки в очередь:
+// сигнал ушел в пустую очередь, и запрос не должен ждать до таймаута
+func TestRequestQueue_ReleaseBeforeEnqueue(t *testing.T) {
+	q := newRequestQueue(1)
+	free := false
+	acquire := func() bool {
+		if free {
+			free = false
+			return true
+		}
+		return false
+	}
+
+	if acquire() {
+		t.Fatal("slot should be busy")
+	}
+	free = true
+	q.Notify()
+
+	start := time.Now()
+	acquired, err := q.Wait(context.Background(), time.Now().Add(time.Second), false, acquire)
+	if err != nil || !acquired {
+		t.Fatalf("lost wakeup: acquired=%v err=%v after %v", acquired, err, time.Since(start))
+	}
+	if q.Len() != 0 {
+		t.Fatalf("waiter left in queue: %d", q.Len())
+	}
+
+	// Занятый слот: запрос ждет сигнала как раньше
+	done := make(chan bool)
+	go func() {
+		acquired, err := q.Wait(context.Background(), time.Now().Add(time.Second), false, acquire)
+		done <- err == nil && !acquired
+	}()
+	for q.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	q.Notify()
+	if !<-done {
+		t.Fatal("waiter was not woken by Notify")
+	}
+}
+
+// Пока разбуженный запрос не занял слот, новые запросы не обходят очередь
+func TestRequestQueue_HandoffBlocksNewcomers(t *testing.T) {
+	q := newRequestQueue(2)
+	woken := make(chan error, 1)
+	go func() {
+		_, err := q.Wait(context.Background(), time.Now().Add(time.Second), false, func() bool { return false })
+		woken <- err
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for q.Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("request was not queued")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	q.Notify()
+	if err := <-woken; err != nil {
+		t.Fatal(err)
+	}
+	if q.Idle() {
+		t.Fatal("queue idle while the freed slot is handed to the woken request")
+	}
+	q.Done()
+	if !q.Idle() {
+		t.Fatal("queue not idle after handoff completed")
+	}
+}
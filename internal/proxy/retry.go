@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	RetryOnConnectFailure = "connect-failure"
+	RetryOnReset          = "reset"
+	RetryOnTimeout        = "timeout"
+)
+
+var errPerTryTimeout = errors.New("per-try timeout exceeded")
+
+// RetryPolicy определяет, когда и как повторять запрос на другом бэкенде
+type RetryPolicy struct {
+	// Максимум попыток, 0 - по количеству бэкендов
+	MaxAttempts int
+	// Ошибки транспорта, после которых допустим повтор
+	RetryOn []string
+	// Статусы ответа, после которых допустим повтор
+	StatusCodes []int
+	// Коды gRPC из trailers-only ответа, после которых допустим повтор.
+	// Вызовы gRPC повторяются независимо от Methods.
+	GRPCStatusCodes []int
+	// Методы, которые можно повторять. Остальные повторяются
+	// только при наличии заголовка Idempotency-Key.
+	Methods []string
+	// Таймаут ожидания заголовков ответа на одну попытку, 0 - без ограничения
+	PerTryTimeout time.Duration
+	// Базовая и максимальная задержка экспоненциального backoff с jitter
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// Доля повторов от живого трафика в процентах
+	BudgetPercent float64
+	// Минимум повторов в секунду, доступный при малом трафике
+	BudgetMinPerSecond float64
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		RetryOn:            []string{RetryOnConnectFailure, RetryOnReset, RetryOnTimeout},
+		StatusCodes:        []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		GRPCStatusCodes:    []int{grpcUnavailable},
+		Methods:            []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace},
+		BackoffBase:        25 * time.Millisecond,
+		BackoffMax:         250 * time.Millisecond,
+		BudgetPercent:      20,
+		BudgetMinPerSecond: 10,
+	}
+}
+
+func (p RetryPolicy) retriesOn(condition string) bool {
+	for _, c := range p.RetryOn {
+		if c == condition {
+			return true
+		}
+	}
+	return false
+}
+
+// methodAllowed проверяет, безопасно ли повторно отправить запрос,
+// который уже мог дойти до бэкенда
+func (p RetryPolicy) methodAllowed(r *http.Request) bool {
+	for _, m := range p.Methods {
+		if strings.EqualFold(m, r.Method) {
+			return true
+		}
+	}
+	return r.Header.Get("Idempotency-Key") != ""
+}
+
+// retriableError решает, можно ли повторить запрос после ошибки транспорта.
+// Неудачное соединение повторяется для любого метода: запрос не был отправлен.
+func (p RetryPolicy) retriableError(r *http.Request, err error) bool {
+	if isConnectError(err) {
+		return p.retriesOn(RetryOnConnectFailure)
+	}
+	if !p.methodAllowed(r) {
+		return false
+	}
+	if isTimeoutError(err) {
+		return p.retriesOn(RetryOnTimeout)
+	}
+	if isResetError(err) {
+		return p.retriesOn(RetryOnReset)
+	}
+	return false
+}
+
+// retriableResponse допустим ли повтор после ответа бэкенда
+func (p RetryPolicy) retriableResponse(r *http.Request, resp *upstreamResponse) bool {
+	if resp.grpcCode >= 0 {
+		for _, c := range p.GRPCStatusCodes {
+			if c == resp.grpcCode {
+				return true
+			}
+		}
+		return false
+	}
+	return p.retriableStatus(r, resp.StatusCode)
+}
+
+func (p RetryPolicy) retriableStatus(r *http.Request, code int) bool {
+	if !p.methodAllowed(r) {
+		return false
+	}
+	for _, c := range p.StatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff ждет перед попыткой attempt (начиная с 1) с полным jitter
+func (p RetryPolicy) backoff(ctx context.Context, attempt int) error {
+	if p.BackoffBase <= 0 {
+		return nil
+	}
+	limit := p.BackoffBase << (attempt - 1)
+	if limit <= 0 || (p.BackoffMax > 0 && limit > p.BackoffMax) {
+		limit = p.BackoffMax
+	}
+	delay := time.Duration(rand.Int63n(int64(limit) + 1))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// isConnectionFailure бэкенд недоступен на уровне соединения: отказ
+// в подключении или сброс. Отмена клиентом, таймаут попытки и
+// брошенная параллельная попытка о состоянии бэкенда не говорят - медленные
+// ответы учитывают circuit breaker и активные проверки.
+func isConnectionFailure(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errPerTryTimeout) {
+		return false
+	}
+	return isConnectError(err) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
+
+func isTimeoutError(err error) bool {
+	if errors.Is(err, errPerTryTimeout) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isResetError(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+const budgetWindowSeconds = 10
+
+// retryBudget ограничивает долю повторов от живого трафика в скользящем
+// окне, чтобы повторы не умножали нагрузку на и так лежащий пул
+type retryBudget struct {
+	mu           sync.Mutex
+	percent      float64
+	minPerSecond float64
+	buckets      [budgetWindowSeconds]budgetBucket
+}
+
+type budgetBucket struct {
+	second   int64
+	requests int64
+	retries  int64
+}
+
+func newRetryBudget(percent, minPerSecond float64) *retryBudget {
+	return &retryBudget{
+		percent:      percent,
+		minPerSecond: minPerSecond,
+	}
+}
+
+func (b *retryBudget) bucket(now int64) *budgetBucket {
+	bk := &b.buckets[now%budgetWindowSeconds]
+	if bk.second != now {
+		*bk = budgetBucket{second: now}
+	}
+	return bk
+}
+
+// RecordRequest учитывает входящий запрос
+func (b *retryBudget) RecordRequest() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bucket(time.Now().Unix()).requests++
+}
+
+// AllowRetry резервирует повтор, если бюджет не исчерпан
+func (b *retryBudget) AllowRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now().Unix()
+	var requests, retries int64
+	for _, bk := range b.buckets {
+		if now-bk.second < budgetWindowSeconds {
+			requests += bk.requests
+			retries += bk.retries
+		}
+	}
+
+	allowed := b.percent / 100 * float64(requests)
+	if floor := b.minPerSecond * budgetWindowSeconds; allowed < floor {
+		allowed = floor
+	}
+	if float64(retries) >= allowed {
+		return false
+	}
+	b.bucket(now).retries++
+	return true
+}
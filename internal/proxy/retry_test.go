@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandler_RetryOnStatus(t *testing.T) {
+	var failingHits atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failingHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ok.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		header     http.Header
+		wantStatus int
+	}{
+		{name: "idempotent method is retried", method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "POST is not retried", method: http.MethodPost, wantStatus: http.StatusServiceUnavailable},
+		{name: "POST with Idempotency-Key is retried", method: http.MethodPost, header: http.Header{"Idempotency-Key": {"abc"}}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Retry.BackoffBase = 0
+			// Round robin начинает со второго бэкенда
+			h := newTestHandler(cfg, ok.URL, failing.URL)
+
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader("payload"))
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(10, 0)
+
+	for i := 0; i < 100; i++ {
+		b.RecordRequest()
+	}
+
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		if b.AllowRetry() {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Fatalf("expected 10 retries for 10%% of 100 requests, got %d", allowed)
+	}
+}
+
+// Из ротации выводит только отказ соединения, а не медленный ответ.
+// Исчерпание попыток по таймауту отдается как 504, отказ соединения - как 503.
+func TestHandler_MarksDownOnlyOnConnectionFailure(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	refused := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	refused.Close()
+
+	for _, tc := range []struct {
+		name       string
+		backend    string
+		wantAlive  bool
+		wantStatus int
+	}{
+		{"per-try timeout", slow.URL, true, http.StatusGatewayTimeout},
+		{"connection refused", refused.URL, false, http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Retry.MaxAttempts = 2
+			cfg.Retry.BackoffBase = 0
+			cfg.Retry.PerTryTimeout = 20 * time.Millisecond
+			h := newTestHandler(cfg, tc.backend)
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", rr.Code, tc.wantStatus)
+			}
+			if alive := h.balancer.GetAll()[0].IsHealthy(); alive != tc.wantAlive {
+				t.Fatalf("backend alive = %v, want %v", alive, tc.wantAlive)
+			}
+		})
+	}
+}
@@ -1,89 +1,467 @@
 package proxy
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/core"
 	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
 )
 
+// Config настройки прокси
+type Config struct {
+	// Тела запросов до этого размера буферизуются в памяти для повторов
+	MaxReplayBytes int64
+	// Тела больше лимита сбрасываются во временный файл вместо отключения повторов
+	SpoolLargeBodies bool
+	// Каталог для временных файлов, пустой - системный по умолчанию
+	SpoolDir string
+	// Максимальный размер тела во временном файле; более крупные тела
+	// передаются потоком без повторов. 0 - без ограничения
+	MaxSpoolBytes int64
+	// Время ожидания заголовков ответа от бэкенда
+	Timeout time.Duration
+	// Максимальный простой соединения после Upgrade (WebSocket и т.п.);
+	// 0 - без ограничения
+	UpgradeIdleTimeout time.Duration
+	// Прокси, чьи X-Forwarded-* и Forwarded дополняются, а не перезаписываются
+	TrustedProxies []*net.IPNet
+	// Передавать бэкенду исходный Host вместо хоста бэкенда
+	PreserveHost bool
+	// Псевдоним прокси в заголовке Via, пустой - Via не добавляется
+	Via string
+	// Политика повторов
+	Retry RetryPolicy
+	// Очередь запросов, когда все бэкенды достигли max_connections
+	Queue QueueConfig
+	// Соединения с бэкендами
+	Upstream UpstreamConfig
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxReplayBytes:     1 << 20,
+		MaxSpoolBytes:      100 << 20,
+		Timeout:            10 * time.Second,
+		UpgradeIdleTimeout: 5 * time.Minute,
+		Via:                "go-highload-balancer",
+		Retry:              DefaultRetryPolicy(),
+		Queue: QueueConfig{
+			Size:    100,
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+const copyBufferSize = 32 * 1024
+
+var copyBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
 type Handler struct {
 	balancer interfaces.Balancer
 	client   *http.Client
 	logger   logger.Logger
+	cfg      Config
+	budget   *retryBudget
+
+	hedgeStats hedgeCounters
+
+	queue *requestQueue
 }
 
-func NewHandler(b interfaces.Balancer, logger interfaces.Logger) *Handler {
+// Stats текущие счетчики прокси
+type Stats struct {
+	Hedge    HedgeStats    `json:"hedge"`
+	Queue    QueueStats    `json:"queue"`
+	Upstream UpstreamStats `json:"upstream"`
+}
+
+func NewHandler(b interfaces.Balancer, logger interfaces.Logger, cfg Config) *Handler {
 	return &Handler{
 		balancer: b,
 		client: &http.Client{
-			Timeout: 10 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConnsPerHost: 100,
-				IdleConnTimeout:     90 * time.Second,
+			Transport: newUpstreamTransport(cfg.Upstream, cfg.Timeout),
+			// Редиректы отдаем клиенту как есть
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
 			},
 		},
+		logger: logger,
+		cfg:    cfg,
+		budget: newRetryBudget(cfg.Retry.BudgetPercent, cfg.Retry.BudgetMinPerSecond),
+		queue:  newRequestQueue(cfg.Queue.Size),
+	}
+}
+
+func (h *Handler) Stats() Stats {
+	return Stats{
+		Hedge:    h.hedgeStats.snapshot(),
+		Queue:    h.queue.stats(),
+		Upstream: h.upstreamStats(),
+	}
+}
+
+// nextBackend выбирает бэкенд, а если все достигли лимита соединений,
+// ждет освобождения слота в FIFO-очереди. Пока очередь не пуста или
+// освободившийся слот передается разбуженному запросу, новые запросы
+// встают в ее конец, а не обгоняют ожидающих.
+func (h *Handler) nextBackend(r *http.Request) (*url.URL, error) {
+	var (
+		backendURL *url.URL
+		err        error
+	)
+	// tryNext false - все бэкенды заняты
+	tryNext := func() bool {
+		backendURL, err = h.balancer.Next(r)
+		return !errors.Is(err, core.ErrAllBackendsBusy)
+	}
+
+	if h.queue.Idle() {
+		if tryNext() || h.cfg.Queue.Size <= 0 {
+			return backendURL, err
+		}
+	}
+
+	deadline := time.Now().Add(h.cfg.Queue.Timeout)
+	front := false
+	for {
+		acquired, waitErr := h.queue.Wait(r.Context(), deadline, front, tryNext)
+		if waitErr != nil {
+			return nil, waitErr
+		}
+		if acquired {
+			return backendURL, err
+		}
+		if tryNext() {
+			h.queue.Done()
+			return backendURL, err
+		}
+		front = true
+	}
+}
+
+// respondUnavailable отвечает 503; при перегрузке добавляет Retry-After
+func (h *Handler) respondUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, core.ErrAllBackendsBusy), errors.Is(err, errQueueFull), errors.Is(err, errQueueTimeout):
+		h.logger.Warnf("Backends overloaded: %v", err)
+		retryAfter := int(math.Ceil(h.cfg.Queue.Timeout.Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		respondError(w, r, "Service overloaded", http.StatusServiceUnavailable)
+	default:
+		h.logger.Warnf("No available backend")
+		respondError(w, r, "Service unavailable", http.StatusServiceUnavailable)
 	}
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var bodyBytes []byte
-	if r.Body != nil {
-		var buf bytes.Buffer
-		tee := io.TeeReader(r.Body, &buf)
-		bodyBytes, _ = io.ReadAll(tee)
-		r.Body.Close()
-		r.Body = io.NopCloser(&buf)
-	}
-
-	// Пытаемся найти рабочий бэкенд за N попыток (N = количество бэкендов)
-	backends := h.balancer.GetAll()
-	maxRetries := len(backends)
-	for i := 0; i < maxRetries; i++ {
-		backendURL, err := h.balancer.Next(r)
+	if isUpgradeRequest(r) {
+		h.serveUpgrade(w, r)
+		return
+	}
+
+	// Тела запросов и ответов идут потоком и могут передаваться дольше
+	// таймаутов сервера: ожидание бэкенда ограничивает Timeout, а
+	// длительность потоков gRPC - клиент через grpc-timeout
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	body, err := newBodySource(r, h.cfg)
+	if err != nil {
+		h.logger.Errorf("Error reading request body: %v", err)
+		respondError(w, r, "Bad request", http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	h.budget.RecordRequest()
+	policy := h.cfg.Retry
+
+	// По умолчанию пробуем не больше раз, чем есть бэкендов.
+	// Непереигрываемое тело отправляется только один раз.
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = len(h.balancer.GetAll())
+	}
+	if !body.Replayable() {
+		maxAttempts = 1
+	}
+
+	// Если все неудачные попытки упали по таймауту, отвечаем 504, а не 503
+	var failures, timeouts int
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := policy.backoff(r.Context(), attempt); err != nil {
+				return
+			}
+		}
+
+		backendURL, err := h.nextBackend(r)
 		if err != nil {
-			h.logger.Warnf("No available backend")
-			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			if r.Context().Err() != nil {
+				return
+			}
+			h.respondUnavailable(w, r, err)
 			return
 		}
 
-		targetURL := backendURL.ResolveReference(&url.URL{
-			Path:     r.URL.Path,
-			RawQuery: r.URL.RawQuery,
-		})
-
-		req, err := http.NewRequest(r.Method, targetURL.String(), bytes.NewReader(bodyBytes))
+		var resp *upstreamResponse
+		if hg := h.hedgeEligible(r, body); hg != nil {
+			resp, backendURL, err = h.hedgedRoundTrip(r, hg, backendURL, body)
+		} else {
+			resp, err = h.roundTrip(r.Context(), r, backendURL, body)
+		}
 		if err != nil {
-			h.logger.Errorf("Error creating request to backend %s: %v", backendURL, err)
+			if r.Context().Err() != nil {
+				// Клиент ушел сам, бэкенд не виноват
+				return
+			}
+			h.logger.Errorf("Error reaching backend %s: %v", backendURL, err)
+			if isConnectionFailure(err) {
+				h.balancer.MarkBackendStatus(backendURL.String(), false)
+			}
+			failures++
+			if isTimeoutError(err) {
+				timeouts++
+			}
+
+			if attempt+1 < maxAttempts && body.Replayable() && policy.retriableError(r, err) && h.budget.AllowRetry() {
+				continue
+			}
+			break
+		}
+
+		if attempt+1 < maxAttempts && body.Replayable() && policy.retriableResponse(r, resp) && h.budget.AllowRetry() {
+			h.logger.Warnf("Retrying after status %d (grpc-status %d) from backend %s", resp.StatusCode, resp.grpcCode, backendURL)
+			resp.Close()
 			continue
 		}
 
-		req.Header = r.Header.Clone()
+		h.writeResponse(w, resp)
+		resp.Close()
+		return
+	}
 
-		resp, err := h.client.Do(req)
-		if err != nil {
-			h.logger.Errorf("Error reaching backend %s: %v", backendURL, err)
-			h.balancer.MarkBackendStatus(backendURL.String(), false)
-			continue
+	if failures > 0 && timeouts == failures {
+		respondError(w, r, "Backend timeout", http.StatusGatewayTimeout)
+		return
+	}
+	respondError(w, r, "All backends unavailable after retries", http.StatusServiceUnavailable)
+}
+
+// upstreamResponse ответ бэкенда вместе с ресурсами попытки
+type upstreamResponse struct {
+	*http.Response
+	cancel  context.CancelFunc
+	release func()
+	onClose func()
+	// Код gRPC из trailers-only ответа, -1 - нет
+	grpcCode int
+	// Учет исхода, известного только после чтения тела (grpc-status в трейлерах)
+	finish func()
+}
+
+// Close освобождает тело ответа, контекст попытки и соединение в балансировщике
+func (u *upstreamResponse) Close() {
+	u.Body.Close()
+	if u.finish != nil {
+		u.finish()
+	}
+	u.cancel()
+	u.release()
+	if u.onClose != nil {
+		u.onClose()
+	}
+}
+
+func (h *Handler) releaseConnection(backendURL *url.URL) {
+	if tracker, ok := h.balancer.(interfaces.ConnectionTracker); ok {
+		tracker.ReleaseConnection(backendURL.String())
+		h.queue.Notify()
+	}
+}
+
+// discardPick возвращает выбранный, но не использованный бэкенд
+func (h *Handler) discardPick(backendURL *url.URL) {
+	h.releaseConnection(backendURL)
+	if backend := h.backendFor(backendURL); backend != nil && backend.Breaker != nil {
+		backend.Breaker.Release(0)
+	}
+}
+
+func (h *Handler) backendFor(backendURL *url.URL) *core.Backend {
+	target := backendURL.String()
+	for _, backend := range h.balancer.GetAll() {
+		if backend.URL.String() == target {
+			return backend
+		}
+	}
+	return nil
+}
+
+// recordOutcome сообщает circuit breaker результат попытки.
+// Отмененные клиентом попытки не считаются ни успехом, ни ошибкой.
+func (h *Handler) recordOutcome(ctx context.Context, backendURL *url.URL, success bool, duration time.Duration) {
+	backend := h.backendFor(backendURL)
+	if backend == nil || backend.Breaker == nil {
+		return
+	}
+	if ctx.Err() != nil {
+		backend.Breaker.Release(duration)
+		return
+	}
+	backend.Breaker.Record(success, duration)
+}
+
+// roundTrip выполняет одну попытку и возвращает ответ с непрочитанным телом.
+// PerTryTimeout ограничивает только ожидание заголовков, тело читается без таймаута.
+func (h *Handler) roundTrip(parent context.Context, r *http.Request, backendURL *url.URL, body *bodySource) (*upstreamResponse, error) {
+	release := func() { h.releaseConnection(backendURL) }
+
+	targetURL := backendURL.ResolveReference(&url.URL{
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+	})
+
+	reqBody, contentLength, err := body.Next()
+	if err != nil {
+		h.discardPick(backendURL)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	req, err := http.NewRequestWithContext(ctx, r.Method, targetURL.String(), reqBody)
+	if err != nil {
+		cancel()
+		h.discardPick(backendURL)
+		return nil, err
+	}
+	req.ContentLength = contentLength
+	req.Header = r.Header.Clone()
+	if len(r.Trailer) > 0 {
+		// Значения трейлеров появятся после чтения тела запроса
+		req.Trailer = r.Trailer
+	}
+	h.prepareRequestHeaders(req.Header, r)
+	if h.cfg.PreserveHost {
+		req.Host = r.Host
+	}
+
+	var timer *time.Timer
+	if h.cfg.Retry.PerTryTimeout > 0 {
+		timer = time.AfterFunc(h.cfg.Retry.PerTryTimeout, cancel)
+	}
+
+	start := time.Now()
+	resp, err := h.client.Do(req)
+	if timer != nil && !timer.Stop() && parent.Err() == nil {
+		// Таймер успел отменить попытку
+		if err == nil {
+			resp.Body.Close()
 		}
-		defer resp.Body.Close()
+		err = errPerTryTimeout
+	}
+	elapsed := time.Since(start)
+	if err != nil {
+		h.recordOutcome(parent, backendURL, false, elapsed)
+		cancel()
+		release()
+		return nil, err
+	}
+	if hg := hedgeFrom(parent); hg != nil {
+		hg.latencies.Observe(elapsed)
+	}
 
-		for k, vs := range resp.Header {
-			for _, v := range vs {
-				w.Header().Add(k, v)
+	u := &upstreamResponse{Response: resp, cancel: cancel, release: release, grpcCode: -1}
+	status := resp.StatusCode
+	if isGRPC(r) && resp.StatusCode == http.StatusOK {
+		code, ok := grpcStatus(resp.Header)
+		if !ok {
+			// Статус придет в трейлерах после тела. Время для breaker -
+			// до заголовков: длительность потока зависит от клиента.
+			u.finish = func() {
+				code, ok := grpcStatus(resp.Trailer)
+				h.recordOutcome(parent, backendURL, ok && grpcOutcomeStatus(code) < http.StatusInternalServerError, elapsed)
 			}
+			return u, nil
 		}
+		u.grpcCode = code
+		status = grpcOutcomeStatus(code)
+	}
+	h.recordOutcome(parent, backendURL, status < http.StatusInternalServerError, elapsed)
+	return u, nil
+}
 
-		w.WriteHeader(resp.StatusCode)
-		if _, err := io.Copy(w, resp.Body); err != nil {
-			h.logger.Errorf("Error copying response body: %v", err)
+func (h *Handler) writeResponse(w http.ResponseWriter, resp *upstreamResponse) {
+	h.prepareResponseHeaders(resp.Header, resp.Response)
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
 		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	if resp.grpcCode < 0 && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/grpc") {
+		// Заголовки потока gRPC уходят клиенту до первого сообщения
+		http.NewResponseController(w).Flush()
+	}
+	if err := copyResponse(w, resp.Response); err != nil {
+		h.logger.Errorf("Error copying response body: %v", err)
 		return
 	}
 
-	http.Error(w, "All backends unavailable after retries", http.StatusServiceUnavailable)
+	// Трейлеры (grpc-status и т.п.) известны только после чтения тела
+	for k, vs := range resp.Trailer {
+		w.Header()[http.TrailerPrefix+k] = vs
+	}
+}
+
+// copyResponse передает тело ответа потоком через буфер фиксированного размера.
+// Ответы без Content-Length (chunked, SSE) сбрасываются клиенту после каждой записи.
+func copyResponse(w http.ResponseWriter, resp *http.Response) error {
+	bufp := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(bufp)
+
+	var dst io.Writer = w
+	if resp.ContentLength == -1 {
+		dst = &flushWriter{w: w, rc: http.NewResponseController(w)}
+	}
+
+	_, err := io.CopyBuffer(dst, resp.Body, *bufp)
+	return err
+}
+
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := f.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
 }
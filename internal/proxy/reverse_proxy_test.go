@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/algorithms"
+)
+
+type testLogger struct{}
+
+func (testLogger) Infof(format string, args ...interface{})  {}
+func (testLogger) Warnf(format string, args ...interface{})  {}
+func (testLogger) Errorf(format string, args ...interface{}) {}
+func (testLogger) Fatalf(format string, args ...interface{}) {}
+
+// countingBackend отвечает количеством прочитанных байт тела
+func countingBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		fmt.Fprintf(w, "%d", n)
+	}))
+}
+
+func newTestHandler(cfg Config, backends ...string) *Handler {
+	lb := algorithms.NewRoundRobinBalancer(backends, testLogger{})
+	return NewHandler(lb, testLogger{}, cfg)
+}
+
+func TestHandler_RetriesSmallBody(t *testing.T) {
+	backend := countingBackend()
+	defer backend.Close()
+
+	cfg := DefaultConfig()
+	// Первый бэкенд недоступен, тело должно уйти на второй целиком
+	h := newTestHandler(cfg, "http://127.0.0.1:1", backend.URL)
+
+	body := strings.Repeat("x", 1024)
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body)))
+
+		if rr.Code != http.StatusOK || rr.Body.String() != "1024" {
+			t.Fatalf("attempt %d: got %d %q", i, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestHandler_LargeBodyIsStreamedWithoutRetry(t *testing.T) {
+	backend := countingBackend()
+	defer backend.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxReplayBytes = 1024
+	h := newTestHandler(cfg, "http://127.0.0.1:1", backend.URL)
+
+	body := bytes.Repeat([]byte("x"), 64*1024)
+
+	// Round robin начинает со второго бэкенда: запрос доходит целиком
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK || rr.Body.String() != "65536" {
+		t.Fatalf("got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// Недоступный бэкенд: тело уже отдано в сокет, повторов нет
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body)))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without retry, got %d", rr.Code)
+	}
+}
+
+func TestHandler_LargeBodySpooledForRetry(t *testing.T) {
+	backend := countingBackend()
+	defer backend.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxReplayBytes = 1024
+	cfg.SpoolLargeBodies = true
+	cfg.SpoolDir = t.TempDir()
+	h := newTestHandler(cfg, "http://127.0.0.1:1", backend.URL)
+
+	body := bytes.Repeat([]byte("x"), 64*1024)
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK || rr.Body.String() != "65536" {
+			t.Fatalf("attempt %d: got %d %q", i, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// Тело больше MaxSpoolBytes не пишется на диск целиком и не повторяется
+func TestHandler_SpoolLimit(t *testing.T) {
+	backend := countingBackend()
+	defer backend.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxReplayBytes = 1024
+	cfg.SpoolLargeBodies = true
+	cfg.SpoolDir = t.TempDir()
+	cfg.MaxSpoolBytes = 8 * 1024
+	h := newTestHandler(cfg, "http://127.0.0.1:1", backend.URL)
+
+	// Длина тела неизвестна заранее: лимит срабатывает при записи в файл
+	body := func() io.Reader { return io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("x"), 64*1024))) }
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", body()))
+	if rr.Code != http.StatusOK || rr.Body.String() != "65536" {
+		t.Fatalf("got %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", body()))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without retry, got %d", rr.Code)
+	}
+}
+
+// Ответ, который передается дольше WriteTimeout сервера, доходит целиком
+func TestHandler_StreamOutlivesServerTimeouts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			w.Write([]byte("chunk;"))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer backend.Close()
+
+	front := httptest.NewUnstartedServer(newTestHandler(DefaultConfig(), backend.URL))
+	front.Config.ReadTimeout = 100 * time.Millisecond
+	front.Config.WriteTimeout = 100 * time.Millisecond
+	front.Start()
+	defer front.Close()
+
+	resp, err := http.Get(front.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil || string(got) != "chunk;chunk;chunk;" {
+		t.Fatalf("stream cut off: %q, %v", got, err)
+	}
+}
+
+func BenchmarkHandler_LargeBody(b *testing.B) {
+	const size = 64 << 20
+
+	backend := countingBackend()
+	defer backend.Close()
+
+	h := newTestHandler(DefaultConfig(), backend.URL)
+	front := httptest.NewServer(h)
+	defer front.Close()
+
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		body := io.LimitReader(zeroReader{}, size)
+		req, _ := http.NewRequest(http.MethodPost, front.URL+"/upload", body)
+		req.ContentLength = size
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			b.Fatalf("unexpected status %d", resp.StatusCode)
+		}
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
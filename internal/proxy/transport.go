@@ -0,0 +1,343 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Протоколы соединений с бэкендами
+const (
+	ProtocolHTTP1 = "http1"
+	// HTTP/2 поверх TLS (ALPN h2)
+	ProtocolH2 = "h2"
+	// HTTP/2 без TLS с prior knowledge
+	ProtocolH2C = "h2c"
+)
+
+// UpstreamConfig настройки соединений с бэкендами пула
+type UpstreamConfig struct {
+	// TLS для https-бэкендов (CA, клиентский сертификат, SNI), nil - по умолчанию
+	TLS *tls.Config
+	// TLSForHost собирает tls.Config под бэкенд, чтобы сертификат
+	// проверялся по его имени; если задан, TLS не используется
+	TLSForHost func(host string) (*tls.Config, error)
+	// Протокол: http1 (по умолчанию), h2 или h2c
+	Protocol string
+	// Максимум одновременных потоков на одно соединение HTTP/2; сверх него
+	// открывается новое соединение. 0 - сколько разрешает бэкенд
+	MaxConcurrentStreams int
+	// PING соединения HTTP/2, от которого нет кадров дольше интервала; 0 - выключено
+	PingInterval time.Duration
+	// Время ожидания ответа на PING, после которого соединение закрывается
+	PingTimeout time.Duration
+}
+
+// UpstreamStats состояние соединений с бэкендами
+type UpstreamStats struct {
+	Protocol      string `json:"protocol"`
+	Connections   int    `json:"connections,omitempty"`
+	ActiveStreams int    `json:"active_streams,omitempty"`
+}
+
+// errResponseHeaderTimeout ответ бэкенда не начался за отведенное время
+var errResponseHeaderTimeout error = &timeoutError{"timeout awaiting response headers"}
+
+type timeoutError struct{ msg string }
+
+func (e *timeoutError) Error() string   { return e.msg }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+var upstreamDialer = &net.Dialer{
+	Timeout:   5 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// newUpstreamTransport создает транспорт, общий для проксируемых запросов
+// и активных проверок пула
+func newUpstreamTransport(cfg UpstreamConfig, responseHeaderTimeout time.Duration) http.RoundTripper {
+	switch cfg.Protocol {
+	case ProtocolH2, ProtocolH2C:
+		return newH2Transport(cfg, responseHeaderTimeout)
+	}
+	t := &http.Transport{
+		DialContext:           upstreamDialer.DialContext,
+		TLSClientConfig:       cfg.TLS,
+		TLSHandshakeTimeout:   5 * time.Second,
+		MaxIdleConnsPerHost:   100,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+	}
+	if cfg.TLSForHost != nil {
+		t.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			tlsCfg, err := cfg.tlsConfig(addr)
+			if err != nil {
+				return nil, err
+			}
+			d := &tls.Dialer{NetDialer: upstreamDialer, Config: tlsCfg}
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	return t
+}
+
+// tlsConfig конфигурация TLS для соединения с бэкендом addr (host:port)
+func (c UpstreamConfig) tlsConfig(addr string) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.TLSForHost != nil {
+		return c.TLSForHost(host)
+	}
+	cfg := &tls.Config{}
+	if c.TLS != nil {
+		cfg = c.TLS.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	return cfg, nil
+}
+
+// Transport возвращает транспорт к бэкендам, например для активных проверок
+func (h *Handler) Transport() http.RoundTripper {
+	return h.client.Transport
+}
+
+func (h *Handler) upstreamStats() UpstreamStats {
+	if t, ok := h.client.Transport.(*h2Transport); ok {
+		return t.stats()
+	}
+	return UpstreamStats{Protocol: ProtocolHTTP1}
+}
+
+// h2Transport HTTP/2 к бэкендам: запросы мультиплексируются в общих
+// соединениях, число потоков на соединение ограничивает h2ConnPool
+type h2Transport struct {
+	t        *http2.Transport
+	pool     *h2ConnPool
+	protocol string
+	// В http2.Transport нет аналога http.Transport.ResponseHeaderTimeout
+	headerTimeout time.Duration
+}
+
+func newH2Transport(cfg UpstreamConfig, responseHeaderTimeout time.Duration) *h2Transport {
+	t := &http2.Transport{
+		AllowHTTP:       cfg.Protocol == ProtocolH2C,
+		IdleConnTimeout: 90 * time.Second,
+		ReadIdleTimeout: cfg.PingInterval,
+		PingTimeout:     cfg.PingTimeout,
+	}
+
+	pool := &h2ConnPool{
+		t:          t,
+		maxStreams: cfg.MaxConcurrentStreams,
+		conns:      make(map[string][]*http2.ClientConn),
+		dialing:    make(map[string]*h2DialCall),
+	}
+	if cfg.Protocol == ProtocolH2C {
+		pool.dial = upstreamDialer.DialContext
+	} else {
+		pool.dial = tlsDialer(cfg)
+	}
+	t.ConnPool = pool
+
+	return &h2Transport{t: t, pool: pool, protocol: cfg.Protocol, headerTimeout: responseHeaderTimeout}
+}
+
+// tlsDialer устанавливает TLS-соединение и требует согласования h2 через ALPN
+func tlsDialer(upstream UpstreamConfig) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		cfg, err := upstream.tlsConfig(addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.NextProtos = []string{http2.NextProtoTLS}
+
+		d := &tls.Dialer{NetDialer: upstreamDialer, Config: cfg}
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if proto := conn.(*tls.Conn).ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+			conn.Close()
+			return nil, fmt.Errorf("backend %s does not support HTTP/2 over TLS (ALPN %q)", addr, proto)
+		}
+		return conn, nil
+	}
+}
+
+func (t *h2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.headerTimeout <= 0 {
+		return t.t.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.headerTimeout, cancel)
+	resp, err := t.t.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		if req.Context().Err() != nil {
+			return nil, req.Context().Err()
+		}
+		return nil, errResponseHeaderTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// Контекст потока живет, пока читается тело
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (t *h2Transport) stats() UpstreamStats {
+	s := t.pool.stats()
+	s.Protocol = t.protocol
+	return s
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// h2ConnPool пул соединений HTTP/2. Новый поток занимает первое соединение
+// со свободным местом, иначе открывается еще одно. Одновременные промахи
+// по одному адресу ждут общего установления соединения.
+type h2ConnPool struct {
+	t          *http2.Transport
+	dial       func(ctx context.Context, network, addr string) (net.Conn, error)
+	maxStreams int
+
+	mu      sync.Mutex
+	conns   map[string][]*http2.ClientConn
+	dialing map[string]*h2DialCall
+}
+
+type h2DialCall struct {
+	done chan struct{}
+	err  error
+}
+
+const h2DialTimeout = 10 * time.Second
+
+func (p *h2ConnPool) GetClientConn(req *http.Request, addr string) (*http2.ClientConn, error) {
+	for {
+		p.mu.Lock()
+		if cc := p.reserveLocked(addr); cc != nil {
+			p.mu.Unlock()
+			return cc, nil
+		}
+		call, ok := p.dialing[addr]
+		if !ok {
+			call = &h2DialCall{done: make(chan struct{})}
+			p.dialing[addr] = call
+			// Соединение общее, поэтому не зависит от контекста запроса
+			go p.dialConn(call, addr)
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-call.done:
+			if call.err != nil {
+				return nil, call.err
+			}
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// reserveLocked резервирует поток в существующем соединении
+func (p *h2ConnPool) reserveLocked(addr string) *http2.ClientConn {
+	for _, cc := range p.conns[addr] {
+		if p.maxStreams > 0 {
+			st := cc.State()
+			if st.StreamsActive+st.StreamsReserved+st.StreamsPending >= p.maxStreams {
+				continue
+			}
+		}
+		if cc.ReserveNewRequest() {
+			return cc
+		}
+	}
+	return nil
+}
+
+func (p *h2ConnPool) dialConn(call *h2DialCall, addr string) {
+	ctx, cancel := context.WithTimeout(context.Background(), h2DialTimeout)
+	defer cancel()
+
+	var cc *http2.ClientConn
+	conn, err := p.dial(ctx, "tcp", addr)
+	if err == nil {
+		cc, err = p.t.NewClientConn(conn)
+		if err != nil {
+			conn.Close()
+		}
+	}
+
+	p.mu.Lock()
+	if err == nil {
+		p.conns[addr] = append(p.conns[addr], cc)
+	}
+	delete(p.dialing, addr)
+	p.mu.Unlock()
+
+	call.err = err
+	close(call.done)
+}
+
+// MarkDead убирает закрытое соединение из пула
+func (p *h2ConnPool) MarkDead(cc *http2.ClientConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for addr, conns := range p.conns {
+		for i, c := range conns {
+			if c != cc {
+				continue
+			}
+			conns = append(conns[:i], conns[i+1:]...)
+			if len(conns) == 0 {
+				delete(p.conns, addr)
+			} else {
+				p.conns[addr] = conns
+			}
+			return
+		}
+	}
+}
+
+func (p *h2ConnPool) stats() UpstreamStats {
+	p.mu.Lock()
+	var conns []*http2.ClientConn
+	for _, cs := range p.conns {
+		conns = append(conns, cs...)
+	}
+	p.mu.Unlock()
+
+	s := UpstreamStats{Connections: len(conns)}
+	for _, cc := range conns {
+		s.ActiveStreams += cc.State().StreamsActive
+	}
+	return s
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestHandler_H2CTrailers(t *testing.T) {
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Header.Get("Te") != "trailers" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte("payload"))
+		w.Header().Set("Grpc-Status", "0")
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	cfg := DefaultConfig()
+	cfg.Upstream.Protocol = ProtocolH2C
+	h := newTestHandler(cfg, backend.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", strings.NewReader("request"))
+	req.Header.Set("Te", "trailers")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	resp := rr.Result()
+	if resp.StatusCode != http.StatusOK || rr.Body.String() != "payload" {
+		t.Fatalf("got %d %q", resp.StatusCode, rr.Body.String())
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Fatalf("trailer grpc-status = %q, want 0", got)
+	}
+	if s := h.Stats().Upstream; s.Protocol != ProtocolH2C || s.Connections != 1 {
+		t.Fatalf("unexpected upstream stats %+v", s)
+	}
+}
+
+func TestHandler_H2MaxConcurrentStreams(t *testing.T) {
+	const requests = 4
+
+	var arrived sync.WaitGroup
+	arrived.Add(requests)
+	var mu sync.Mutex
+	peers := make(map[string]bool)
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		peers[r.RemoteAddr] = true
+		mu.Unlock()
+		// Держим потоки открытыми, пока не придут все запросы
+		arrived.Done()
+		arrived.Wait()
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	cfg := DefaultConfig()
+	cfg.Upstream.Protocol = ProtocolH2C
+	cfg.Upstream.MaxConcurrentStreams = 2
+	h := newTestHandler(cfg, backend.URL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rr.Code != http.StatusOK {
+				t.Errorf("got %d", rr.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(peers) != requests/2 {
+		t.Fatalf("%d requests used %d connections, want %d", requests, len(peers), requests/2)
+	}
+}
+
+func TestHandler_H2OverTLS(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	backend.EnableHTTP2 = true
+	backend.StartTLS()
+	defer backend.Close()
+
+	roots := backend.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	cfg := DefaultConfig()
+	cfg.Upstream = UpstreamConfig{Protocol: ProtocolH2, TLS: &tls.Config{RootCAs: roots}}
+	h := newTestHandler(cfg, backend.URL)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "HTTP/2.0" {
+		t.Fatalf("got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// Бэкенд без h2 в ALPN не подходит для пула h2
+	http1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer http1.Close()
+	cfg.Upstream.TLS = &tls.Config{RootCAs: http1.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	cfg.Retry.MaxAttempts = 1
+	h = newTestHandler(cfg, http1.URL)
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("http1-only backend: got %d", rr.Code)
+	}
+}
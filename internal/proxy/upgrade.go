@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// isUpgradeRequest определяет запросы с Connection: Upgrade (WebSocket, h2c)
+func isUpgradeRequest(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" && headerContainsToken(r.Header, "Connection", "upgrade")
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveUpgrade проксирует запрос на смену протокола: рукопожатие уходит
+// на бэкенд, а после 101 Switching Protocols байты гоняются в обе стороны.
+func (h *Handler) serveUpgrade(w http.ResponseWriter, r *http.Request) {
+	backendURL, err := h.nextBackend(r)
+	if err != nil {
+		h.respondUnavailable(w, r, err)
+		return
+	}
+	// Соединение учитывается балансировщиком все время жизни туннеля
+	defer h.releaseConnection(backendURL)
+
+	start := time.Now()
+	backendConn, err := h.dialBackend(r, backendURL)
+	if err != nil {
+		h.recordOutcome(r.Context(), backendURL, false, time.Since(start))
+		h.logger.Errorf("Error dialing backend %s: %v", backendURL, err)
+		if isConnectionFailure(err) {
+			h.balancer.MarkBackendStatus(backendURL.String(), false)
+		}
+		http.Error(w, "Bad gateway", http.StatusBadGateway)
+		return
+	}
+	defer backendConn.Close()
+
+	outreq := r.Clone(r.Context())
+	outreq.URL = backendURL.ResolveReference(&url.URL{
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+	})
+	outreq.Host = backendURL.Host
+	if h.cfg.PreserveHost {
+		outreq.Host = r.Host
+	}
+	outreq.RequestURI = ""
+	outreq.Header = r.Header.Clone()
+	h.prepareRequestHeaders(outreq.Header, r)
+	outreq.Header.Set("Connection", "Upgrade")
+	outreq.Header.Set("Upgrade", r.Header.Get("Upgrade"))
+
+	if h.cfg.Timeout > 0 {
+		backendConn.SetDeadline(time.Now().Add(h.cfg.Timeout))
+	}
+	if err := outreq.Write(backendConn); err != nil {
+		h.recordOutcome(r.Context(), backendURL, false, time.Since(start))
+		h.logger.Errorf("Error writing upgrade request to %s: %v", backendURL, err)
+		http.Error(w, "Bad gateway", http.StatusBadGateway)
+		return
+	}
+
+	backendReader := bufio.NewReader(backendConn)
+	resp, err := http.ReadResponse(backendReader, outreq)
+	h.recordOutcome(r.Context(), backendURL, err == nil && resp.StatusCode < http.StatusInternalServerError, time.Since(start))
+	if err != nil {
+		h.logger.Errorf("Error reading upgrade response from %s: %v", backendURL, err)
+		http.Error(w, "Bad gateway", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Бэкенд отказал в смене протокола: отдаем обычный ответ
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		h.prepareResponseHeaders(resp.Header, resp)
+		for k, vs := range resp.Header {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		if err := copyResponse(w, resp); err != nil {
+			h.logger.Errorf("Error copying response body: %v", err)
+		}
+		return
+	}
+	backendConn.SetDeadline(time.Time{})
+
+	clientConn, clientBuf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		h.logger.Errorf("Error hijacking client connection: %v", err)
+		http.Error(w, "Upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+	defer clientConn.Close()
+	// Снимаем таймауты http.Server, дальше действует только idle timeout
+	clientConn.SetDeadline(time.Time{})
+
+	upgrade := resp.Header.Get("Upgrade")
+	h.prepareResponseHeaders(resp.Header, resp)
+	resp.Header.Set("Connection", "Upgrade")
+	resp.Header.Set("Upgrade", upgrade)
+	if err := resp.Write(clientConn); err != nil {
+		h.logger.Errorf("Error writing upgrade response to client: %v", err)
+		return
+	}
+
+	h.tunnel(clientConn, clientBuf.Reader, backendConn, backendReader)
+}
+
+func (h *Handler) dialBackend(r *http.Request, backendURL *url.URL) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}
+	host := backendURL.Host
+
+	switch backendURL.Scheme {
+	case "https", "wss":
+		if backendURL.Port() == "" {
+			host = net.JoinHostPort(backendURL.Hostname(), "443")
+		}
+		tlsConfig, err := h.cfg.Upstream.tlsConfig(host)
+		if err != nil {
+			return nil, err
+		}
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		return tlsDialer.DialContext(r.Context(), "tcp", host)
+	case "http", "ws", "":
+		if backendURL.Port() == "" {
+			host = net.JoinHostPort(backendURL.Hostname(), "80")
+		}
+		return dialer.DialContext(r.Context(), "tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported backend scheme: %s", backendURL.Scheme)
+	}
+}
+
+// tunnel копирует байты в обе стороны, пока одна из сторон не закроется
+// или обе не простоят дольше UpgradeIdleTimeout (<= 0 - без ограничения)
+func (h *Handler) tunnel(clientConn net.Conn, clientReader io.Reader, backendConn net.Conn, backendReader io.Reader) {
+	var lastActivity atomic.Int64
+	lastActivity.Store(time.Now().UnixNano())
+
+	errc := make(chan error, 2)
+	go func() { errc <- h.pipe(backendConn, clientConn, clientReader, &lastActivity) }()
+	go func() { errc <- h.pipe(clientConn, backendConn, backendReader, &lastActivity) }()
+
+	if err := <-errc; err != nil && !isClosedConnError(err) {
+		h.logger.Warnf("Upgraded connection closed: %v", err)
+	}
+	// Закрытие обоих соединений завершает вторую горутину
+	clientConn.Close()
+	backendConn.Close()
+	<-errc
+}
+
+func (h *Handler) pipe(dst net.Conn, src net.Conn, srcReader io.Reader, lastActivity *atomic.Int64) error {
+	bufp := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(bufp)
+	buf := *bufp
+
+	idle := h.cfg.UpgradeIdleTimeout
+	for {
+		if idle > 0 {
+			src.SetReadDeadline(time.Now().Add(idle))
+		}
+		n, err := srcReader.Read(buf)
+		if n > 0 {
+			lastActivity.Store(time.Now().UnixNano())
+			if idle > 0 {
+				dst.SetWriteDeadline(time.Now().Add(idle))
+			}
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// Молчит только эта сторона, туннель еще жив
+			if time.Since(time.Unix(0, lastActivity.Load())) < idle {
+				continue
+			}
+			return fmt.Errorf("idle timeout after %s", idle)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+}
+
+func isClosedConnError(err error) bool {
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF)
+}
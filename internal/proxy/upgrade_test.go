@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/algorithms"
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+func wsAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// readFrame читает один WebSocket-фрейм (без фрагментации)
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := hdr[0] & 0x0f
+	masked := hdr[1]&0x80 != 0
+	length := uint64(hdr[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+// writeFrame пишет короткий фрейм; клиент обязан маскировать данные
+func writeFrame(w io.Writer, opcode byte, payload []byte, masked bool) error {
+	frame := []byte{0x80 | opcode, byte(len(payload))}
+	if masked {
+		mask := [4]byte{1, 2, 3, 4}
+		frame[1] |= 0x80
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+func wsEchoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "expected websocket", http.StatusBadRequest)
+			return
+		}
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + wsAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		buf.Flush()
+
+		for {
+			opcode, payload, err := readFrame(buf)
+			if err != nil {
+				return
+			}
+			if err := writeFrame(conn, opcode, payload, false); err != nil || opcode == 0x8 {
+				return
+			}
+		}
+	}))
+}
+
+// dialWebSocket открывает соединение с front и отправляет запрос на Upgrade
+func dialWebSocket(t *testing.T, front *httptest.Server, key string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", front.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, front.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, resp
+}
+
+func TestHandler_WebSocketEcho(t *testing.T) {
+	backend := wsEchoServer(t)
+	defer backend.Close()
+
+	lb := algorithms.NewLeastConnectionsBalancer([]string{backend.URL}, testLogger{})
+	front := httptest.NewServer(NewHandler(lb, testLogger{}, DefaultConfig()))
+	defer front.Close()
+
+	const key = "dGhlIHNhbXBsZSBub25jZQ=="
+	conn, reader, resp := dialWebSocket(t, front, key)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != wsAccept(key) {
+		t.Fatalf("unexpected accept key %q", got)
+	}
+
+	backendState := lb.GetAll()[0]
+	if n := atomic.LoadInt64(&backendState.ActiveConnections); n != 1 {
+		t.Fatalf("expected 1 active connection during tunnel, got %d", n)
+	}
+
+	for _, msg := range []string{"hello", "world"} {
+		if err := writeFrame(conn, 0x1, []byte(msg), true); err != nil {
+			t.Fatal(err)
+		}
+		opcode, payload, err := readFrame(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opcode != 0x1 || string(payload) != msg {
+			t.Fatalf("unexpected echo: opcode=%d payload=%q", opcode, payload)
+		}
+	}
+
+	writeFrame(conn, 0x8, nil, true)
+	readFrame(reader)
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt64(&backendState.ActiveConnections) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("connection was not released after tunnel closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Нулевые Timeout и UpgradeIdleTimeout не ограничивают ни рукопожатие, ни простой туннеля
+func TestHandler_UpgradeWithoutIdleTimeout(t *testing.T) {
+	backend := wsEchoServer(t)
+	defer backend.Close()
+
+	cfg := DefaultConfig()
+	cfg.Timeout = 0
+	cfg.UpgradeIdleTimeout = 0
+	lb := algorithms.NewLeastConnectionsBalancer([]string{backend.URL}, testLogger{})
+	front := httptest.NewServer(NewHandler(lb, testLogger{}, cfg))
+	defer front.Close()
+
+	conn, reader, resp := dialWebSocket(t, front, "dGhlIHNhbXBsZSBub25jZQ==")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if err := writeFrame(conn, 0x1, []byte("ping"), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, payload, err := readFrame(reader); err != nil || string(payload) != "ping" {
+		t.Fatalf("tunnel closed without idle timeout: payload=%q err=%v", payload, err)
+	}
+}
+
+func TestHandler_UpgradeRejectedByBackend(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no upgrade here", http.StatusBadRequest)
+	}))
+	defer backend.Close()
+
+	h := newTestHandler(DefaultConfig(), backend.URL)
+	front := httptest.NewServer(h)
+	defer front.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, front.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected backend status to pass through, got %d", resp.StatusCode)
+	}
+}
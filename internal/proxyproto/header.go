@@ -0,0 +1,207 @@
+// Package proxyproto реализует PROXY protocol v1 и v2 (HAProxy): заголовок,
+// которым L4-балансировщик передает адрес клиента в начале TCP-соединения.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Сигнатура заголовка версии 2
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	// Максимальная длина строки версии 1 вместе с CRLF
+	v1MaxLength = 107
+	v2HeaderLen = 16
+
+	v2CmdLocal = 0x20
+	v2CmdProxy = 0x21
+
+	v2FamilyTCP4 = 0x11
+	v2FamilyTCP6 = 0x21
+)
+
+var ErrNoHeader = errors.New("proxyproto: connection does not start with a PROXY header")
+
+// Header разобранный заголовок. Для соединений без адресов
+// (v1 UNKNOWN, v2 LOCAL - например, проверки здоровья самого
+// балансировщика) Source и Destination равны nil.
+type Header struct {
+	Version     int
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// Read читает заголовок любой версии из начала потока
+func Read(r *bufio.Reader) (*Header, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch first[0] {
+	case 'P':
+		return readV1(r)
+	case '\r':
+		return readV2(r)
+	}
+	return nil, ErrNoHeader
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("proxyproto: v1 header is not terminated by CRLF")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if fields[0] != "PROXY" || len(fields) < 2 {
+		return nil, ErrNoHeader
+	}
+	h := &Header{Version: 1}
+	if fields[1] == "UNKNOWN" {
+		return h, nil
+	}
+	var err error
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("proxyproto: malformed v1 header %q", line)
+	}
+
+	if h.Source, err = parseV1Addr(fields[1], fields[2], fields[4]); err != nil {
+		return nil, err
+	}
+	if h.Destination, err = parseV1Addr(fields[1], fields[3], fields[5]); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func parseV1Addr(family, ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil || (family == "TCP4") == strings.Contains(ip, ":") {
+		return nil, fmt.Errorf("proxyproto: invalid %s address %q", family, ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxyproto: invalid port %q", port)
+	}
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	head, err := r.Peek(v2HeaderLen)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(head[:12], v2Signature) {
+		return nil, ErrNoHeader
+	}
+	cmd, family := head[12], head[13]
+	length := int(binary.BigEndian.Uint16(head[14:16]))
+	if cmd != v2CmdLocal && cmd != v2CmdProxy {
+		return nil, fmt.Errorf("proxyproto: unsupported v2 version/command 0x%02x", cmd)
+	}
+
+	buf := make([]byte, v2HeaderLen+length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	payload := buf[v2HeaderLen:]
+
+	h := &Header{Version: 2}
+	// LOCAL и неизвестные семейства (UDP, unix) адреса клиента не несут;
+	// блок адресов и TLV пропускаются
+	if cmd == v2CmdLocal {
+		return h, nil
+	}
+	switch family {
+	case v2FamilyTCP4:
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("proxyproto: short v2 IPv4 address block")
+		}
+		h.Source = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+	case v2FamilyTCP6:
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("proxyproto: short v2 IPv6 address block")
+		}
+		h.Source = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	}
+	return h, nil
+}
+
+// Format кодирует заголовок версии h.Version. Без адресов получается
+// v1 UNKNOWN или v2 LOCAL.
+func (h *Header) Format() ([]byte, error) {
+	src, dst := h.Source, h.Destination
+	ipv4 := src != nil && dst != nil && src.IP.To4() != nil && dst.IP.To4() != nil
+	if !ipv4 && src != nil && dst != nil && (src.IP.To4() != nil || dst.IP.To4() != nil) {
+		// Адреса разных семейств в один заголовок не кодируются
+		src, dst = nil, nil
+	}
+
+	switch h.Version {
+	case 1:
+		if src == nil || dst == nil {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+		family, srcIP, dstIP := "TCP6", src.IP.To16().String(), dst.IP.To16().String()
+		if ipv4 {
+			family, srcIP, dstIP = "TCP4", src.IP.To4().String(), dst.IP.To4().String()
+		}
+		return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n", family, srcIP, dstIP, src.Port, dst.Port), nil
+	case 2:
+		out := append([]byte(nil), v2Signature...)
+		if src == nil || dst == nil {
+			return append(out, v2CmdLocal, 0, 0, 0), nil
+		}
+		var addrs []byte
+		family := byte(v2FamilyTCP6)
+		if ipv4 {
+			family = v2FamilyTCP4
+			addrs = append(addrs, src.IP.To4()...)
+			addrs = append(addrs, dst.IP.To4()...)
+		} else {
+			addrs = append(addrs, src.IP.To16()...)
+			addrs = append(addrs, dst.IP.To16()...)
+		}
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(src.Port))
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(dst.Port))
+
+		out = append(out, v2CmdProxy, family)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(addrs)))
+		return append(out, addrs...), nil
+	}
+	return nil, fmt.Errorf("proxyproto: unsupported version %d", h.Version)
+}
+
+// ParseVersion разбирает версию из конфигурации: "v1", "v2" или пусто (выключено)
+func ParseVersion(s string) (int, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "v1":
+		return 1, nil
+	case "v2":
+		return 2, nil
+	}
+	return 0, fmt.Errorf("unknown PROXY protocol version %q (expected v1 or v2)", s)
+}
@@ -0,0 +1,106 @@
+package proxyproto
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+// Listener разбирает PROXY-заголовок у соединений от доверенных адресов.
+// Доверенный источник обязан прислать заголовок, иначе соединение
+// отклоняется. От остальных заголовок не ожидается: поддельный
+// заголовок клиента остается обычными данными и адрес не подменяет.
+type Listener struct {
+	net.Listener
+	Trusted []*net.IPNet
+	// Сколько ждать заголовок; 0 - без ограничения
+	HeaderTimeout time.Duration
+}
+
+func NewListener(l net.Listener, trusted []*net.IPNet, headerTimeout time.Duration) *Listener {
+	return &Listener{Listener: l, Trusted: trusted, HeaderTimeout: headerTimeout}
+}
+
+// Accept не читает заголовок сам, чтобы медленный клиент не задерживал
+// прием остальных: разбор происходит при первом обращении к соединению
+// в горутине его обработчика.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn), timeout: l.HeaderTimeout}, nil
+}
+
+func (l *Listener) trusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range l.Trusted {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn соединение от доверенного балансировщика. RemoteAddr и LocalAddr
+// возвращают адреса из заголовка.
+type Conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	header *Header
+	err    error
+}
+
+// Header читает заголовок при первом вызове. Ошибка означает, что
+// соединение нужно закрыть.
+func (c *Conn) Header() (*Header, error) {
+	c.once.Do(func() {
+		if c.timeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		}
+		c.header, c.err = Read(c.reader)
+		if c.timeout > 0 {
+			c.Conn.SetReadDeadline(time.Time{})
+		}
+	})
+	return c.header, c.err
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if _, err := c.Header(); err != nil {
+		return 0, err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	if h, err := c.Header(); err == nil && h.Source != nil {
+		return h.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	if h, err := c.Header(); err == nil && h.Destination != nil {
+		return h.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// CloseWrite нужен для half-close при проксировании TCP
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,120 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatAndRead(t *testing.T) {
+	cases := []struct {
+		name    string
+		version int
+		src     string
+		dst     string
+	}{
+		{"v1 ipv4", 1, "203.0.113.7:51234", "10.0.0.1:443"},
+		{"v1 ipv6", 1, "[2001:db8::7]:51234", "[2001:db8::1]:443"},
+		{"v2 ipv4", 2, "203.0.113.7:51234", "10.0.0.1:443"},
+		{"v2 ipv6", 2, "[2001:db8::7]:51234", "[2001:db8::1]:443"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			src, _ := net.ResolveTCPAddr("tcp", tc.src)
+			dst, _ := net.ResolveTCPAddr("tcp", tc.dst)
+			raw, err := (&Header{Version: tc.version, Source: src, Destination: dst}).Format()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Данные после заголовка остаются в потоке
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(raw), strings.NewReader("GET /")))
+			h, err := Read(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Version != tc.version || h.Source.String() != src.String() || h.Destination.String() != dst.String() {
+				t.Fatalf("got %+v", h)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != "GET /" {
+				t.Fatalf("payload after header: %q", rest)
+			}
+		})
+	}
+}
+
+func TestRead_NoAddresses(t *testing.T) {
+	for _, raw := range []string{"PROXY UNKNOWN\r\n", "\r\n\r\n\x00\r\nQUIT\n\x20\x00\x00\x00"} {
+		h, err := Read(bufio.NewReader(strings.NewReader(raw)))
+		if err != nil {
+			t.Fatalf("%q: %v", raw, err)
+		}
+		if h.Source != nil || h.Destination != nil {
+			t.Fatalf("%q: unexpected addresses %+v", raw, h)
+		}
+	}
+}
+
+func TestRead_Malformed(t *testing.T) {
+	for _, raw := range []string{
+		"GET / HTTP/1.1\r\n",
+		"PROXY TCP4 1.2.3.4\r\n",
+		"PROXY TCP4 ::1 ::1 1 2\r\n",
+		"PROXY TCP4 1.2.3.4 5.6.7.8 1 2" + strings.Repeat(" ", 100) + "\r\n",
+		"\r\n\r\n\x00\r\nQUIT\n\x11\x11\x00\x0c",
+	} {
+		if _, err := Read(bufio.NewReader(strings.NewReader(raw))); err == nil {
+			t.Fatalf("%q: expected error", raw)
+		}
+	}
+}
+
+func TestListener_TrustedOnly(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, other, _ := net.ParseCIDR("10.0.0.0/8")
+
+	accept := func(trusted *net.IPNet, payload string) (net.Addr, string, error) {
+		l := NewListener(inner, []*net.IPNet{trusted}, time.Second)
+		go func() {
+			c, err := net.Dial("tcp", inner.Addr().String())
+			if err == nil {
+				io.WriteString(c, payload)
+				c.Close()
+			}
+		}()
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		data, err := io.ReadAll(conn)
+		return conn.RemoteAddr(), string(data), err
+	}
+
+	header := "PROXY TCP4 203.0.113.7 127.0.0.1 40000 80\r\n"
+
+	// От доверенного адреса заголовок разбирается
+	addr, data, err := accept(loopback, header+"hello")
+	if err != nil || addr.String() != "203.0.113.7:40000" || data != "hello" {
+		t.Fatalf("trusted: %v %q %v", addr, data, err)
+	}
+
+	// Доверенный источник без заголовка отклоняется
+	if _, _, err := accept(loopback, "hello"); err == nil {
+		t.Fatal("trusted connection without header accepted")
+	}
+
+	// От недоверенного заголовок остается данными и адрес не меняется
+	addr, data, err = accept(other, header+"hello")
+	if err != nil || strings.HasPrefix(addr.String(), "203.0.113.7") || data != header+"hello" {
+		t.Fatalf("untrusted: %v %q %v", addr, data, err)
+	}
+}
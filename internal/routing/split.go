@@ -0,0 +1,286 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxy"
+)
+
+// Variant пул-получатель доли трафика
+type Variant struct {
+	Pool   string `json:"pool"`
+	Weight int    `json:"weight"`
+}
+
+// Split распределение трафика маршрута между пулами по весам
+type Split struct {
+	Variants []Variant `json:"variants"`
+	// Заголовок и cookie, значение которых (имя пула) принудительно выбирает вариант
+	OverrideHeader string `json:"override_header,omitempty"`
+	OverrideCookie string `json:"override_cookie,omitempty"`
+	// Источники идентификатора клиента для закрепления за вариантом
+	StickyHeader string `json:"sticky_header,omitempty"`
+	StickyCookie string `json:"sticky_cookie,omitempty"`
+}
+
+// VariantStats показатели варианта; доля ошибок и задержки - по последним запросам
+type VariantStats struct {
+	Pool         string  `json:"pool"`
+	Weight       int     `json:"weight"`
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	LatencyP50Ms float64 `json:"latency_p50_ms"`
+	LatencyP95Ms float64 `json:"latency_p95_ms"`
+	LatencyP99Ms float64 `json:"latency_p99_ms"`
+	Window       int     `json:"window"`
+}
+
+type SplitStats struct {
+	Route    string         `json:"route"`
+	Variants []VariantStats `json:"variants"`
+}
+
+type variant struct {
+	pool   *Pool
+	weight int
+	stats  *variantStats
+}
+
+// splitter выбирает вариант для запроса; веса меняются на лету
+type splitter struct {
+	cfg Split
+
+	mu       sync.RWMutex
+	variants []*variant
+	total    int
+}
+
+func newSplitter(route string, cfg Split, pools map[string]*Pool) (*splitter, error) {
+	s := &splitter{cfg: cfg}
+	weights := make(map[string]int, len(cfg.Variants))
+	for _, v := range cfg.Variants {
+		pool, ok := pools[v.Pool]
+		if !ok {
+			return nil, fmt.Errorf("route %s: unknown pool %s", route, v.Pool)
+		}
+		if _, dup := weights[v.Pool]; dup {
+			return nil, fmt.Errorf("route %s: duplicate split pool %s", route, v.Pool)
+		}
+		weights[v.Pool] = v.Weight
+		s.variants = append(s.variants, &variant{pool: pool, stats: newVariantStats(variantWindow)})
+	}
+	if err := s.setWeights(weights); err != nil {
+		return nil, fmt.Errorf("route %s: %w", route, err)
+	}
+	return s, nil
+}
+
+// setWeights заменяет веса; пулы, не указанные в weights, сохраняют прежний вес
+func (s *splitter) setWeights(weights map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known := make(map[string]bool, len(s.variants))
+	total := 0
+	for _, v := range s.variants {
+		known[v.pool.Name] = true
+		w := v.weight
+		if nw, ok := weights[v.pool.Name]; ok {
+			w = nw
+		}
+		if w < 0 {
+			return fmt.Errorf("negative weight for pool %s", v.pool.Name)
+		}
+		total += w
+	}
+	for name := range weights {
+		if !known[name] {
+			return fmt.Errorf("pool %s is not a variant of this route", name)
+		}
+	}
+	if total == 0 {
+		return errors.New("split weights sum to zero")
+	}
+
+	for _, v := range s.variants {
+		if nw, ok := weights[v.pool.Name]; ok {
+			v.weight = nw
+		}
+	}
+	s.total = total
+	return nil
+}
+
+func (s *splitter) choose(r *http.Request) *variant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if v := s.override(r); v != nil {
+		return v
+	}
+
+	var n int
+	if id := s.clientID(r); id != "" {
+		h := fnv.New32a()
+		h.Write([]byte(id))
+		n = int(h.Sum32() % uint32(s.total))
+	} else {
+		n = rand.Intn(s.total)
+	}
+
+	for _, v := range s.variants {
+		if n < v.weight {
+			return v
+		}
+		n -= v.weight
+	}
+	return s.variants[len(s.variants)-1]
+}
+
+// override ищет вариант, явно запрошенный клиентом (вес не учитывается)
+func (s *splitter) override(r *http.Request) *variant {
+	var name string
+	if s.cfg.OverrideHeader != "" {
+		name = r.Header.Get(s.cfg.OverrideHeader)
+	}
+	if name == "" && s.cfg.OverrideCookie != "" {
+		if c, err := r.Cookie(s.cfg.OverrideCookie); err == nil {
+			name = c.Value
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	for _, v := range s.variants {
+		if v.pool.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+func (s *splitter) clientID(r *http.Request) string {
+	if s.cfg.StickyHeader != "" {
+		if id := r.Header.Get(s.cfg.StickyHeader); id != "" {
+			return id
+		}
+	}
+	if s.cfg.StickyCookie != "" {
+		if c, err := r.Cookie(s.cfg.StickyCookie); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func (s *splitter) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	v := s.choose(r)
+	sw := proxy.NewStatusWriter(w)
+	start := time.Now()
+	v.pool.Handler.ServeHTTP(sw, r)
+	v.stats.observe(time.Since(start), sw.Status >= http.StatusInternalServerError)
+}
+
+// current возвращает конфигурацию с действующими весами
+func (s *splitter) current() Split {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	split := s.cfg
+	split.Variants = make([]Variant, 0, len(s.variants))
+	for _, v := range s.variants {
+		split.Variants = append(split.Variants, Variant{Pool: v.pool.Name, Weight: v.weight})
+	}
+	return split
+}
+
+func (s *splitter) stats(route string) SplitStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := SplitStats{Route: route, Variants: make([]VariantStats, 0, len(s.variants))}
+	for _, v := range s.variants {
+		st := v.stats.snapshot()
+		st.Pool = v.pool.Name
+		st.Weight = v.weight
+		result.Variants = append(result.Variants, st)
+	}
+	return result
+}
+
+// variantWindow количество последних запросов для доли ошибок и перцентилей
+const variantWindow = 1024
+
+type sample struct {
+	latency time.Duration
+	failed  bool
+}
+
+type variantStats struct {
+	mu       sync.Mutex
+	requests int64
+	errors   int64
+	samples  []sample
+	next     int
+	filled   bool
+}
+
+func newVariantStats(size int) *variantStats {
+	return &variantStats{samples: make([]sample, size)}
+}
+
+func (vs *variantStats) observe(latency time.Duration, failed bool) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.requests++
+	if failed {
+		vs.errors++
+	}
+	vs.samples[vs.next] = sample{latency: latency, failed: failed}
+	vs.next = (vs.next + 1) % len(vs.samples)
+	if vs.next == 0 {
+		vs.filled = true
+	}
+}
+
+func (vs *variantStats) snapshot() VariantStats {
+	vs.mu.Lock()
+	n := vs.next
+	if vs.filled {
+		n = len(vs.samples)
+	}
+	latencies := make([]time.Duration, 0, n)
+	failed := 0
+	for _, s := range vs.samples[:n] {
+		latencies = append(latencies, s.latency)
+		if s.failed {
+			failed++
+		}
+	}
+	st := VariantStats{Requests: vs.requests, Errors: vs.errors, Window: n}
+	vs.mu.Unlock()
+
+	if n == 0 {
+		return st
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	st.ErrorRate = float64(failed) * 100 / float64(n)
+	st.LatencyP50Ms = percentileMs(latencies, 50)
+	st.LatencyP95Ms = percentileMs(latencies, 95)
+	st.LatencyP99Ms = percentileMs(latencies, 99)
+	return st
+}
+
+func percentileMs(sorted []time.Duration, p float64) float64 {
+	idx := int(float64(len(sorted)-1) * p / 100)
+	return float64(sorted[idx].Microseconds()) / 1000
+}
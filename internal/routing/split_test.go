@@ -0,0 +1,116 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/algorithms"
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxy"
+)
+
+type testLogger struct{}
+
+func (testLogger) Infof(string, ...interface{})  {}
+func (testLogger) Warnf(string, ...interface{})  {}
+func (testLogger) Errorf(string, ...interface{}) {}
+func (testLogger) Fatalf(string, ...interface{}) {}
+
+func testPool(t *testing.T, name string, status int) *Pool {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(backend.Close)
+
+	lb := algorithms.NewRoundRobinBalancer([]string{backend.URL}, testLogger{})
+	return &Pool{Name: name, Balancer: lb, Handler: proxy.NewHandler(lb, testLogger{}, proxy.DefaultConfig())}
+}
+
+func serve(table *Table, req *http.Request) string {
+	rr := httptest.NewRecorder()
+	table.ServeHTTP(rr, req)
+	return rr.Body.String()
+}
+
+func TestSplit_WeightsOverrideAndSticky(t *testing.T) {
+	pools := []*Pool{testPool(t, "stable", http.StatusOK), testPool(t, "canary", http.StatusBadGateway)}
+	table, err := NewTable([]Route{{
+		Name: "checkout",
+		Split: &Split{
+			Variants:       []Variant{{Pool: "stable", Weight: 100}, {Pool: "canary", Weight: 0}},
+			OverrideHeader: "X-Variant",
+			StickyHeader:   "X-User-ID",
+		},
+	}}, pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if got := serve(table, httptest.NewRequest(http.MethodGet, "/", nil)); got != "stable" {
+			t.Fatalf("zero-weight variant received traffic: %q", got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Variant", "canary")
+	if got := serve(table, req); got != "canary" {
+		t.Fatalf("override header ignored, got %q", got)
+	}
+
+	if _, err := table.SetSplitWeights("checkout", map[string]int{"stable": 50, "canary": 50}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		id := strconv.Itoa(i)
+		first := ""
+		for j := 0; j < 5; j++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-User-ID", id)
+			got := serve(table, req)
+			if first == "" {
+				first = got
+			} else if got != first {
+				t.Fatalf("client %s switched variant: %s -> %s", id, first, got)
+			}
+		}
+	}
+
+	stats, err := table.SplitStats("checkout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	canary := stats.Variants[1]
+	if canary.Weight != 50 || canary.Requests == 0 || canary.ErrorRate != 100 {
+		t.Fatalf("unexpected canary stats: %+v", canary)
+	}
+	if stable := stats.Variants[0]; stable.Errors != 0 || stable.Requests == 0 {
+		t.Fatalf("unexpected stable stats: %+v", stable)
+	}
+}
+
+func TestSplit_InvalidWeights(t *testing.T) {
+	pools := []*Pool{{Name: "a"}, {Name: "b"}}
+	table, err := NewTable([]Route{
+		{Name: "split", Split: &Split{Variants: []Variant{{Pool: "a", Weight: 1}, {Pool: "b", Weight: 1}}}},
+		{Name: "plain", Pool: "a"},
+	}, pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := table.SetSplitWeights("split", map[string]int{"a": 0, "b": 0}); err == nil {
+		t.Fatal("expected error for zero total weight")
+	}
+	if _, err := table.SetSplitWeights("split", map[string]int{"c": 1}); err == nil {
+		t.Fatal("expected error for unknown variant")
+	}
+	if _, err := table.SetSplitWeights("plain", map[string]int{"a": 1}); err != ErrNotSplitRoute {
+		t.Fatalf("expected ErrNotSplitRoute, got %v", err)
+	}
+	if split := table.Routes()[0].Split; split.Variants[0].Weight != 1 {
+		t.Fatalf("failed update changed weights: %+v", split)
+	}
+}
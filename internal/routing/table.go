@@ -0,0 +1,294 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxy"
+)
+
+var (
+	ErrRouteNotFound    = errors.New("route not found")
+	ErrNotSplitRoute    = errors.New("route has no traffic split")
+	ErrNotMirroredRoute = errors.New("route has no mirror")
+)
+
+// Pool именованная группа бэкендов со своим балансировщиком и прокси
+type Pool struct {
+	Name      string
+	Algorithm interfaces.AlgorithmType
+	Balancer  interfaces.Balancer
+	Handler   *proxy.Handler
+}
+
+// Match условия маршрута; пустые поля не проверяются
+type Match struct {
+	// Host точное имя или шаблон вида *.example.com
+	Host       string   `json:"host,omitempty"`
+	PathPrefix string   `json:"path_prefix,omitempty"`
+	PathRegex  string   `json:"path_regex,omitempty"`
+	Methods    []string `json:"methods,omitempty"`
+	// Headers значение "" проверяет только наличие заголовка
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Route маршрут на пул бэкендов
+type Route struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Match    Match  `json:"match"`
+	// Pool или Split: маршрут ведет в один пул либо делит трафик между несколькими
+	Pool  string `json:"pool,omitempty"`
+	Split *Split `json:"split,omitempty"`
+	// Mirror копирует выборку запросов маршрута в теневой пул
+	Mirror *Mirror `json:"mirror,omitempty"`
+	// Hedge дублирует медленные GET/HEAD запросы маршрута на второй бэкенд
+	Hedge *proxy.HedgeConfig `json:"hedge,omitempty"`
+}
+
+// Mirror зеркалирование запросов маршрута; ответы теневого пула отбрасываются
+type Mirror struct {
+	Pool string `json:"pool"`
+	proxy.MirrorConfig
+}
+
+type compiledRoute struct {
+	Route
+	pathRegex *regexp.Regexp
+	pool      *Pool
+	split     *splitter
+	mirror    *proxy.Mirror
+	handler   http.Handler
+}
+
+// Table таблица маршрутизации: маршруты проверяются по убыванию приоритета,
+// при равном приоритете - в порядке объявления
+type Table struct {
+	routes []*compiledRoute
+	pools  []*Pool
+}
+
+func NewTable(routes []Route, pools []*Pool) (*Table, error) {
+	byName := make(map[string]*Pool, len(pools))
+	for _, p := range pools {
+		if _, dup := byName[p.Name]; dup {
+			return nil, fmt.Errorf("duplicate pool name: %s", p.Name)
+		}
+		byName[p.Name] = p
+	}
+
+	compiled := make([]*compiledRoute, 0, len(routes))
+	names := make(map[string]bool, len(routes))
+	for _, r := range routes {
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate route name: %s", r.Name)
+		}
+		names[r.Name] = true
+
+		cr := &compiledRoute{Route: r}
+		if r.Split != nil {
+			split, err := newSplitter(r.Name, *r.Split, byName)
+			if err != nil {
+				return nil, err
+			}
+			cr.split = split
+		} else {
+			pool, ok := byName[r.Pool]
+			if !ok {
+				return nil, fmt.Errorf("route %s: unknown pool %s", r.Name, r.Pool)
+			}
+			cr.pool = pool
+		}
+
+		if cr.split != nil {
+			cr.handler = http.HandlerFunc(cr.split.serveHTTP)
+		} else {
+			cr.handler = cr.pool.Handler
+		}
+		if r.Hedge != nil {
+			// У каждого маршрута свое окно латентностей и бюджет
+			cr.handler = proxy.NewHedge(*r.Hedge).Wrap(cr.handler)
+		}
+		if r.Mirror != nil {
+			shadow, ok := byName[r.Mirror.Pool]
+			if !ok {
+				return nil, fmt.Errorf("route %s: unknown mirror pool %s", r.Name, r.Mirror.Pool)
+			}
+			cr.mirror = proxy.NewMirror(shadow.Handler, r.Mirror.MirrorConfig)
+			cr.handler = cr.mirror.Wrap(cr.handler)
+		}
+		if r.Match.PathRegex != "" {
+			re, err := regexp.Compile(r.Match.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: invalid path_regex: %w", r.Name, err)
+			}
+			cr.pathRegex = re
+		}
+		compiled = append(compiled, cr)
+	}
+
+	sort.SliceStable(compiled, func(i, j int) bool {
+		return compiled[i].Priority > compiled[j].Priority
+	})
+
+	return &Table{routes: compiled, pools: pools}, nil
+}
+
+func (t *Table) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := t.match(r)
+	if route == nil {
+		http.Error(w, "No route for request", http.StatusNotFound)
+		return
+	}
+	route.handler.ServeHTTP(w, r)
+}
+
+func (t *Table) match(r *http.Request) *compiledRoute {
+	for _, route := range t.routes {
+		if route.matches(r) {
+			return route
+		}
+	}
+	return nil
+}
+
+// RouteName имя маршрута, который обработает запрос; "" - ни один не подходит
+func (t *Table) RouteName(r *http.Request) string {
+	if route := t.match(r); route != nil {
+		return route.Name
+	}
+	return ""
+}
+
+// Routes возвращает действующие маршруты в порядке проверки
+func (t *Table) Routes() []Route {
+	routes := make([]Route, 0, len(t.routes))
+	for _, r := range t.routes {
+		route := r.Route
+		if r.split != nil {
+			split := r.split.current()
+			route.Split = &split
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// SetSplitWeights меняет веса вариантов маршрута без перезапуска
+func (t *Table) SetSplitWeights(route string, weights map[string]int) (Split, error) {
+	split, err := t.splitter(route)
+	if err != nil {
+		return Split{}, err
+	}
+	if err := split.setWeights(weights); err != nil {
+		return Split{}, err
+	}
+	return split.current(), nil
+}
+
+// SplitStats возвращает показатели вариантов маршрута
+func (t *Table) SplitStats(route string) (SplitStats, error) {
+	split, err := t.splitter(route)
+	if err != nil {
+		return SplitStats{}, err
+	}
+	return split.stats(route), nil
+}
+
+// MirrorStats возвращает счетчики зеркалирования маршрута
+func (t *Table) MirrorStats(name string) (proxy.MirrorStats, error) {
+	route := t.route(name)
+	if route == nil {
+		return proxy.MirrorStats{}, ErrRouteNotFound
+	}
+	if route.mirror == nil {
+		return proxy.MirrorStats{}, ErrNotMirroredRoute
+	}
+	return route.mirror.Stats(), nil
+}
+
+func (t *Table) splitter(name string) (*splitter, error) {
+	route := t.route(name)
+	if route == nil {
+		return nil, ErrRouteNotFound
+	}
+	if route.split == nil {
+		return nil, ErrNotSplitRoute
+	}
+	return route.split, nil
+}
+
+func (t *Table) route(name string) *compiledRoute {
+	for _, r := range t.routes {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+func (t *Table) Pools() []*Pool {
+	return t.pools
+}
+
+func (r *compiledRoute) matches(req *http.Request) bool {
+	m := r.Match
+	if m.Host != "" && !matchHost(m.Host, req.Host) {
+		return false
+	}
+	if m.PathPrefix != "" && !strings.HasPrefix(req.URL.Path, m.PathPrefix) {
+		return false
+	}
+	if r.pathRegex != nil && !r.pathRegex.MatchString(req.URL.Path) {
+		return false
+	}
+	if len(m.Methods) > 0 && !containsFold(m.Methods, req.Method) {
+		return false
+	}
+	for name, value := range m.Headers {
+		values := req.Header.Values(name)
+		if len(values) == 0 || (value != "" && !contains(values, value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHost сравнивает хост без порта; *.example.com совпадает
+// с любым поддоменом, но не с самим example.com
+func matchHost(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	pattern = strings.ToLower(pattern)
+
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:]) && len(host) > len(pattern)-1
+	}
+	return host == pattern
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
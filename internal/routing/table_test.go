@@ -0,0 +1,71 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxy"
+)
+
+func TestTable_Match(t *testing.T) {
+	pools := []*Pool{{Name: "api"}, {Name: "static"}, {Name: "default"}}
+	table, err := NewTable([]Route{
+		{Name: "default", Priority: -1, Pool: "default"},
+		{Name: "api", Priority: 10, Pool: "api", Match: Match{Host: "*.example.com", PathPrefix: "/api/", Methods: []string{"GET"}}},
+		{Name: "beta", Priority: 20, Pool: "static", Match: Match{PathPrefix: "/api/", Headers: map[string]string{"X-Beta": "1"}}},
+		{Name: "static", Priority: 10, Pool: "static", Match: Match{PathRegex: `\.css$`}},
+	}, pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		method, target string
+		header         http.Header
+		want           string
+	}{
+		{http.MethodGet, "http://eu.example.com:8080/api/users", nil, "api"},
+		{http.MethodPost, "http://eu.example.com/api/users", nil, "default"},
+		{http.MethodGet, "http://example.com/api/users", nil, "default"},
+		{http.MethodGet, "http://eu.example.com/api/users", http.Header{"X-Beta": {"1"}}, "beta"},
+		{http.MethodGet, "http://any/site.css", nil, "static"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, nil)
+		for k, v := range c.header {
+			req.Header[k] = v
+		}
+		route := table.match(req)
+		if route == nil || route.Name != c.want {
+			t.Fatalf("%s %s: expected route %s, got %+v", c.method, c.target, c.want, route)
+		}
+	}
+}
+
+func TestNewTable_UnknownPool(t *testing.T) {
+	if _, err := NewTable([]Route{{Name: "r", Pool: "missing"}}, nil); err == nil {
+		t.Fatal("expected error for unknown pool")
+	}
+}
+
+func TestTable_HedgePerRoute(t *testing.T) {
+	pool := testPool(t, "api", http.StatusOK)
+	table, err := NewTable([]Route{
+		{Name: "catalog", Pool: "api", Match: Match{PathPrefix: "/catalog"},
+			Hedge: &proxy.HedgeConfig{Delay: time.Second, MaxPercent: 100}},
+		{Name: "orders", Pool: "api", Match: Match{PathPrefix: "/orders"}},
+	}, []*Pool{pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve(table, httptest.NewRequest(http.MethodGet, "/catalog/items", nil))
+	serve(table, httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+
+	// Пул общий, но hedging включен только на маршруте catalog
+	if stats := pool.Handler.Stats().Hedge; stats.Eligible != 1 {
+		t.Fatalf("expected one hedge-eligible request, got %+v", stats)
+	}
+}
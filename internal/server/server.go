@@ -2,49 +2,109 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/xhaklaaa/go-highload-balancer/internal/api/handler"
-	"github.com/xhaklaaa/go-highload-balancer/internal/balancer/interfaces"
+	"github.com/xhaklaaa/go-highload-balancer/internal/core"
 	"github.com/xhaklaaa/go-highload-balancer/internal/limiter"
 	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+	"github.com/xhaklaaa/go-highload-balancer/internal/proxyproto"
+	"github.com/xhaklaaa/go-highload-balancer/internal/routing"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type Server struct {
 	router              *mux.Router
-	balancer            interfaces.Balancer
-	proxyHandler        http.Handler
+	routes              *routing.Table
 	port                int
 	logger              logger.Logger
-	rateLimiter         *limiter.TokenBucket
+	rateLimiter         limiter.RateLimiter
 	httpServer          *http.Server
 	rateLimiterStore    limiter.ConfigStore
 	rateLimitingEnabled bool
+	adminRoutes         []RouteRegistrar
+	proxyMiddlewares    []mux.MiddlewareFunc
+
+	tlsConfig    *tls.Config
+	tlsPort      int
+	redirectHTTP bool
+	httpsServer  *http.Server
+
+	h2c bool
+
+	proxyProtocolTrusted []*net.IPNet
+	proxyHeaderTimeout   time.Duration
 }
 
-func NewServer(lb interfaces.Balancer, proxyHandler http.Handler, port int, log logger.Logger, rateLimiter *limiter.TokenBucket, store limiter.ConfigStore, rateLimitingEnabled bool) *Server {
+// RouteRegistrar регистрирует свои маршруты на переданном роутере
+type RouteRegistrar interface {
+	RegisterRoutes(router *mux.Router)
+}
+
+func NewServer(routes *routing.Table, port int, log logger.Logger, rateLimiter limiter.RateLimiter, store limiter.ConfigStore, rateLimitingEnabled bool) *Server {
 	router := mux.NewRouter()
 	s := &Server{
 		router:              router,
-		balancer:            lb,
-		proxyHandler:        proxyHandler,
+		routes:              routes,
 		port:                port,
 		logger:              log,
 		rateLimiter:         rateLimiter,
 		rateLimiterStore:    store,
 		rateLimitingEnabled: rateLimitingEnabled,
 	}
-	s.setupRoutes()
 	return s
 }
 
+// RegisterAdminRoutes добавляет обработчики под префиксом /admin.
+// Вызывается до Start.
+func (s *Server) RegisterAdminRoutes(r RouteRegistrar) {
+	s.adminRoutes = append(s.adminRoutes, r)
+}
+
+// UseProxyMiddleware оборачивает проксируемый трафик (кэш и т.п.).
+// Первый добавленный обработчик выполняется первым. Вызывается до Start.
+func (s *Server) UseProxyMiddleware(mw mux.MiddlewareFunc) {
+	s.proxyMiddlewares = append(s.proxyMiddlewares, mw)
+}
+
+// EnableTLS добавляет HTTPS-листенер на tlsPort. При redirectHTTP
+// обычный порт только перенаправляет на HTTPS. Вызывается до Start.
+func (s *Server) EnableTLS(cfg *tls.Config, tlsPort int, redirectHTTP bool) {
+	s.tlsConfig = cfg
+	s.tlsPort = tlsPort
+	s.redirectHTTP = redirectHTTP
+}
+
+// EnableH2C принимает HTTP/2 без TLS на обычном порту (prior knowledge
+// и Upgrade: h2c), например от клиентов gRPC. Вызывается до Start.
+func (s *Server) EnableH2C() {
+	s.h2c = true
+}
+
+// EnableProxyProtocol принимает PROXY-заголовок v1/v2 от L4-балансировщиков
+// из trusted на обоих портах: адрес клиента из заголовка становится
+// RemoteAddr запросов. Вызывается до Start.
+func (s *Server) EnableProxyProtocol(trusted []*net.IPNet, headerTimeout time.Duration) {
+	s.proxyProtocolTrusted = trusted
+	s.proxyHeaderTimeout = headerTimeout
+}
+
 func (s *Server) setupRoutes() {
 	adminRouter := s.router.PathPrefix("/admin").Subrouter()
 	adminRouter.HandleFunc("/backend-status", s.handleBackendStatus).Methods("POST")
+	adminRouter.HandleFunc("/backends", s.handleListBackends).Methods("GET")
+	for _, r := range s.adminRoutes {
+		r.RegisterRoutes(adminRouter)
+	}
 
 	// Регистрируем API маршруты только если rate limiting включен
 	if s.rateLimitingEnabled {
@@ -61,8 +121,12 @@ func (s *Server) setupRoutes() {
 		s.logger.Infof("API endpoints disabled")
 	}
 
-	// Все остальные запросы идут в прокси
-	s.router.PathPrefix("/").Handler(s.proxyHandler)
+	// Все остальные запросы маршрутизируются в пулы бэкендов
+	var proxyHandler http.Handler = s.routes
+	for i := len(s.proxyMiddlewares) - 1; i >= 0; i-- {
+		proxyHandler = s.proxyMiddlewares[i](proxyHandler)
+	}
+	s.router.PathPrefix("/").Handler(proxyHandler)
 }
 
 func (s *Server) setupAPIRoutes(router *mux.Router) {
@@ -74,6 +138,8 @@ func (s *Server) handleBackendStatus(w http.ResponseWriter, r *http.Request) {
 	var request struct {
 		URL   string `json:"url"`
 		Alive bool   `json:"alive"`
+		// Pool ограничивает изменение одним пулом; пусто - все пулы
+		Pool string `json:"pool"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -81,11 +147,43 @@ func (s *Server) handleBackendStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.balancer.MarkBackendStatus(request.URL, request.Alive)
+	for _, pool := range s.routes.Pools() {
+		if request.Pool == "" || request.Pool == pool.Name {
+			pool.Balancer.MarkBackendStatus(request.URL, request.Alive)
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Backend status updated"))
 }
 
+type backendStatusResponse struct {
+	Pool              string            `json:"pool"`
+	URL               string            `json:"url"`
+	Healthy           bool              `json:"healthy"`
+	ActiveConnections int64             `json:"active_connections"`
+	MaxConnections    int64             `json:"max_connections"`
+	CircuitState      core.BreakerState `json:"circuit_state"`
+}
+
+func (s *Server) handleListBackends(w http.ResponseWriter, r *http.Request) {
+	response := make([]backendStatusResponse, 0)
+	for _, pool := range s.routes.Pools() {
+		for _, b := range pool.Balancer.GetAll() {
+			response = append(response, backendStatusResponse{
+				Pool:              pool.Name,
+				URL:               b.URL.String(),
+				Healthy:           b.IsHealthy(),
+				ActiveConnections: atomic.LoadInt64(&b.ActiveConnections),
+				MaxConnections:    b.MaxConnections,
+				CircuitState:      b.CircuitState(),
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 func jsonMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -101,21 +199,89 @@ func (s *Server) Start() error {
 		return nil
 	})
 
-	s.httpServer = &http.Server{
-		Addr:         ":" + strconv.Itoa(s.port),
-		Handler:      s.router,
+	var handler http.Handler = s.router
+	if s.h2c {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	s.httpServer = s.newHTTPServer(s.port, handler)
+	httpListener, err := s.listen(s.port)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig == nil {
+		s.logger.Infof("Starting server on port %d", s.port)
+		return s.httpServer.Serve(httpListener)
+	}
+
+	if s.redirectHTTP {
+		s.httpServer.Handler = http.HandlerFunc(s.redirectToHTTPS)
+	}
+	s.httpsServer = s.newHTTPServer(s.tlsPort, s.router)
+	s.httpsServer.TLSConfig = s.tlsConfig
+	httpsListener, err := s.listen(s.tlsPort)
+	if err != nil {
+		httpListener.Close()
+		return err
+	}
+
+	errCh := make(chan error, 2)
+	go func() {
+		s.logger.Infof("Starting HTTPS server on port %d", s.tlsPort)
+		// Сертификаты берутся из TLSConfig.GetCertificate
+		errCh <- s.httpsServer.ServeTLS(httpsListener, "", "")
+	}()
+	go func() {
+		s.logger.Infof("Starting server on port %d (redirect to HTTPS: %t)", s.port, s.redirectHTTP)
+		errCh <- s.httpServer.Serve(httpListener)
+	}()
+	return <-errCh
+}
+
+// listen открывает порт; PROXY-заголовок разбирается до TLS
+func (s *Server) listen(port int) (net.Listener, error) {
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, err
+	}
+	if len(s.proxyProtocolTrusted) > 0 {
+		s.logger.Infof("PROXY protocol enabled on port %d for %d trusted networks", port, len(s.proxyProtocolTrusted))
+		l = proxyproto.NewListener(l, s.proxyProtocolTrusted, s.proxyHeaderTimeout)
+	}
+	return l, nil
+}
+
+func (s *Server) newHTTPServer(port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         ":" + strconv.Itoa(port),
+		Handler:      handler,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  15 * time.Second,
 	}
+}
 
-	s.logger.Infof("Starting server on port %d", s.port)
-	return s.httpServer.ListenAndServe()
+// redirectToHTTPS перенаправляет на тот же путь по HTTPS с сохранением метода
+func (s *Server) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if s.tlsPort != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(s.tlsPort))
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
 }
 
+// Stop дожидается обработки текущих запросов и останавливает лимитер:
+// учет, накопленный до конца запросов, успевает попасть в хранилище
 func (s *Server) Stop(ctx context.Context) error {
-	if err := s.rateLimiter.Stop(); err != nil {
-		s.logger.Errorf("Rate limiter shutdown error: %v", err)
+	var httpsErr error
+	if s.httpsServer != nil {
+		httpsErr = s.httpsServer.Shutdown(ctx)
+	}
+	err := errors.Join(s.httpServer.Shutdown(ctx), httpsErr)
+	if stopErr := s.rateLimiter.Stop(); stopErr != nil {
+		s.logger.Errorf("Rate limiter shutdown error: %v", stopErr)
 	}
-	return s.httpServer.Shutdown(ctx)
+	return err
 }
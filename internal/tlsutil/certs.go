@@ -0,0 +1,204 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+)
+
+// CertPair пути к сертификату и ключу в PEM
+type CertPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertStore набор сертификатов с выбором по SNI и перечитыванием с диска
+type CertStore struct {
+	pairs  []CertPair
+	logger logger.Logger
+
+	mu     sync.RWMutex
+	certs  []*tls.Certificate
+	byName map[string]*tls.Certificate
+}
+
+func NewCertStore(pairs []CertPair, logger logger.Logger) (*CertStore, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("no certificates configured")
+	}
+	s := &CertStore{pairs: pairs, logger: logger}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload перечитывает все сертификаты; при ошибке остаются прежние
+func (s *CertStore) Reload() error {
+	certs := make([]*tls.Certificate, 0, len(s.pairs))
+	byName := make(map[string]*tls.Certificate)
+	for _, p := range s.pairs {
+		cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load certificate %s: %w", p.CertFile, err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("parse certificate %s: %w", p.CertFile, err)
+		}
+		cert.Leaf = leaf
+
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			// При совпадении имен побеждает сертификат, объявленный раньше
+			if _, ok := byName[name]; !ok {
+				byName[name] = &cert
+			}
+		}
+		certs = append(certs, &cert)
+	}
+
+	s.mu.Lock()
+	s.certs = certs
+	s.byName = byName
+	s.mu.Unlock()
+	return nil
+}
+
+// GetCertificate выбирает сертификат по SNI: точное имя, затем wildcard,
+// иначе первый из списка
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := s.byName[name]; ok {
+		return cert, nil
+	}
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if cert, ok := s.byName["*."+parent]; ok {
+			return cert, nil
+		}
+	}
+	return s.certs[0], nil
+}
+
+// Watch перечитывает сертификаты при изменении файлов до отмены ctx
+func (s *CertStore) Watch(ctx context.Context) error {
+	files := make([]string, 0, len(s.pairs)*2)
+	for _, p := range s.pairs {
+		files = append(files, p.CertFile, p.KeyFile)
+	}
+	return watchFiles(ctx, files, s.Reload, s.logger)
+}
+
+// watchFiles вызывает reload при изменении файлов. Следит за каталогами,
+// чтобы переживать атомарную замену файлов; при ошибке reload остаются
+// прежние сертификаты.
+func watchFiles(ctx context.Context, files []string, reload func() error, log logger.Logger) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		dir := filepath.Dir(f)
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("watch %s: %w", dir, err)
+		}
+		dirs[dir] = true
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		// Сертификат и ключ обычно меняются парой: ждем, пока запись затихнет
+		const debounce = 200 * time.Millisecond
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+					timer.Reset(debounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("Certificate watcher error: %v", err)
+			case <-timer.C:
+				if err := reload(); err != nil {
+					log.Errorf("Certificate reload failed, keeping previous certificates: %v", err)
+					continue
+				}
+				log.Infof("Certificates reloaded")
+			}
+		}
+	}()
+	return nil
+}
+
+// ParseVersion переводит "1.0".."1.3" в константу tls.VersionTLS*
+func ParseVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(v), "tls") {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q", v)
+}
+
+// ParseCipherSuites переводит имена наборов шифров (TLS_ECDHE_...) в идентификаторы.
+// Пустой список - наборы Go по умолчанию.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+	for _, cs := range tls.InsecureCipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,127 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testLogger struct{}
+
+func (testLogger) Infof(string, ...interface{})  {}
+func (testLogger) Warnf(string, ...interface{})  {}
+func (testLogger) Errorf(string, ...interface{}) {}
+func (testLogger) Fatalf(string, ...interface{}) {}
+
+// writeCert создает самоподписанный сертификат для names
+func writeCert(t *testing.T, dir, name string, serial int64, names ...string) CertPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair := CertPair{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	// Ключ пишется первым: сертификат без ключа не загрузится
+	if err := os.WriteFile(pair.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+func serialFor(t *testing.T, s *CertStore, serverName string) int64 {
+	t.Helper()
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestCertStore_SelectsBySNI(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewCertStore([]CertPair{
+		writeCert(t, dir, "a", 1, "a.example.com"),
+		writeCert(t, dir, "b", 2, "*.b.example.com"),
+	}, testLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]int64{
+		"a.example.com":     1,
+		"A.Example.com":     1,
+		"api.b.example.com": 2,
+		"b.example.com":     1,
+		"unknown.test":      1,
+	}
+	for name, want := range cases {
+		if got := serialFor(t, s, name); got != want {
+			t.Fatalf("%s: expected certificate %d, got %d", name, want, got)
+		}
+	}
+}
+
+func TestCertStore_WatchReloads(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewCertStore([]CertPair{writeCert(t, dir, "a", 1, "a.example.com")}, testLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Watch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCert(t, dir, "a", 5, "a.example.com")
+
+	deadline := time.Now().Add(3 * time.Second)
+	for serialFor(t, s, "a.example.com") != 5 {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate was not reloaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil || len(ids) != 1 || ids[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Fatalf("unexpected result: %v %v", ids, err)
+	}
+	if _, err := ParseCipherSuites([]string{"TLS_NOPE"}); err == nil {
+		t.Fatal("expected error for unknown suite")
+	}
+}
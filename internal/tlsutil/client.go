@@ -0,0 +1,153 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/xhaklaaa/go-highload-balancer/internal/logger"
+)
+
+// ClientConfig настройки TLS к бэкендам
+type ClientConfig struct {
+	// PEM-бандл доверенных CA; пусто - системные
+	CAFile string
+	// Клиентский сертификат для mTLS
+	CertFile string
+	KeyFile  string
+	// Имя для SNI и проверки сертификата бэкенда вместо хоста из URL
+	ServerName string
+	// Не проверять сертификат бэкенда (только для разработки)
+	InsecureSkipVerify bool
+}
+
+// ClientTLS TLS-настройки исходящих соединений с перечитыванием CA и
+// клиентского сертификата. Проверка сертификата бэкенда выполняется
+// в VerifyConnection по текущему набору CA.
+type ClientTLS struct {
+	cfg    ClientConfig
+	logger logger.Logger
+
+	mu    sync.RWMutex
+	roots *x509.CertPool
+	cert  *tls.Certificate
+}
+
+func NewClientTLS(cfg ClientConfig, logger logger.Logger) (*ClientTLS, error) {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("client cert_file and key_file must be set together")
+	}
+	c := &ClientTLS{cfg: cfg, logger: logger}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload перечитывает CA-бандл и клиентский сертификат; при ошибке остаются прежние
+func (c *ClientTLS) Reload() error {
+	var roots *x509.CertPool
+	if c.cfg.CAFile != "" {
+		pem, err := os.ReadFile(c.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("read CA bundle: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA bundle %s", c.cfg.CAFile)
+		}
+	}
+
+	var cert *tls.Certificate
+	if c.cfg.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load client certificate: %w", err)
+		}
+		cert = &pair
+	}
+
+	c.mu.Lock()
+	c.roots = roots
+	c.cert = cert
+	c.mu.Unlock()
+	return nil
+}
+
+// Watch перечитывает файлы при изменении до отмены ctx
+func (c *ClientTLS) Watch(ctx context.Context) error {
+	var files []string
+	for _, f := range []string{c.cfg.CAFile, c.cfg.CertFile, c.cfg.KeyFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return watchFiles(ctx, files, c.Reload, c.logger)
+}
+
+// ConfigFor возвращает tls.Config для соединений с бэкендом host.
+// Сертификат проверяется по имени, к которому подключаемся: ServerName из
+// настроек, иначе host из URL бэкенда (имя или IP-адрес). Без имени
+// проверка невозможна, и конфигурация не выдается.
+func (c *ClientTLS) ConfigFor(host string) (*tls.Config, error) {
+	name := c.cfg.ServerName
+	if name == "" {
+		name = host
+	}
+	if name == "" && !c.cfg.InsecureSkipVerify {
+		return nil, errors.New("backend name for certificate verification is unknown")
+	}
+	return &tls.Config{
+		ServerName: name,
+		// Стандартная проверка заменена VerifyConnection, чтобы учитывать перечитанные CA
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return c.verify(cs, name)
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			if c.cert == nil {
+				// Пустой сертификат: сервер сам решит, допустимо ли соединение без него
+				return &tls.Certificate{}, nil
+			}
+			return c.cert, nil
+		},
+	}, nil
+}
+
+// verify проверяет цепочку и имя. cs.ServerName для IP-адресов пуст
+// (SNI с адресом не отправляется), поэтому имя передается явно.
+func (c *ClientTLS) verify(cs tls.ConnectionState, name string) error {
+	if c.cfg.InsecureSkipVerify {
+		return nil
+	}
+	if name == "" {
+		return errors.New("backend name for certificate verification is unknown")
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("backend presented no certificate")
+	}
+
+	c.mu.RLock()
+	roots := c.roots
+	c.mu.RUnlock()
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       name,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
@@ -0,0 +1,204 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue выпускает сертификат, подписанный CA, на имена и IP-адреса
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage, names ...string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func writePair(t *testing.T, dir, name string, cert tls.Certificate) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600)
+	return certFile, keyFile
+}
+
+// clientFor HTTP-клиент, который, как транспорт пулов, собирает
+// tls.Config под хост каждого соединения
+func clientFor(c *ClientTLS) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			cfg, err := c.ConfigFor(host)
+			if err != nil {
+				return nil, err
+			}
+			d := &tls.Dialer{Config: cfg}
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+func TestClientTLS_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	backend.TLS = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, x509.ExtKeyUsageServerAuth, "backend.mesh.local")},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	backend.StartTLS()
+	defer backend.Close()
+
+	certFile, keyFile := writePair(t, dir, "client", ca.issue(t, x509.ExtKeyUsageClientAuth, "balancer"))
+
+	get := func(cfg ClientConfig) (string, error) {
+		c, err := NewClientTLS(cfg, testLogger{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := clientFor(c).Get(backend.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		buf := make([]byte, 64)
+		n, _ := resp.Body.Read(buf)
+		return string(buf[:n]), nil
+	}
+
+	// SNI переопределен: сертификат бэкенда выписан на имя в mesh, а не на 127.0.0.1
+	body, err := get(ClientConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "backend.mesh.local"})
+	if err != nil || body != "balancer" {
+		t.Fatalf("mTLS request failed: %q %v", body, err)
+	}
+
+	if _, err := get(ClientConfig{CAFile: caFile, ServerName: "backend.mesh.local"}); err == nil {
+		t.Fatal("request without client certificate succeeded")
+	}
+	if _, err := get(ClientConfig{CertFile: certFile, KeyFile: keyFile, ServerName: "backend.mesh.local"}); err == nil {
+		t.Fatal("backend certificate from unknown CA was accepted")
+	}
+	if _, err := get(ClientConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "other.local"}); err == nil {
+		t.Fatal("certificate for another name was accepted")
+	}
+	if _, err := get(ClientConfig{CertFile: certFile, KeyFile: keyFile, InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("insecure mode rejected backend: %v", err)
+	}
+}
+
+// Бэкенд, заданный IP-адресом, проверяется по этому адресу
+func TestClientTLS_IPBackendName(t *testing.T) {
+	ca := newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClientTLS(ClientConfig{CAFile: caFile}, testLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(cert tls.Certificate) error {
+		backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		backend.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		backend.StartTLS()
+		defer backend.Close()
+		resp, err := clientFor(c).Get(backend.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(ca.issue(t, x509.ExtKeyUsageServerAuth, "127.0.0.1")); err != nil {
+		t.Fatalf("certificate for the dialed IP rejected: %v", err)
+	}
+	if err := get(ca.issue(t, x509.ExtKeyUsageServerAuth, "10.0.0.9")); err == nil {
+		t.Fatal("certificate for another IP accepted")
+	}
+	if err := get(ca.issue(t, x509.ExtKeyUsageServerAuth, "backend.mesh.local")); err == nil {
+		t.Fatal("certificate for another name accepted")
+	}
+	if _, err := c.ConfigFor(""); err == nil {
+		t.Fatal("config without a backend name issued")
+	}
+}